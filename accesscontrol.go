@@ -0,0 +1,392 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultRulesReloadInterval is the default interval of checking the rules file for changes.
+const defaultRulesReloadInterval = 10 * time.Second
+
+// Reasons of blocking requests by AccessControl.
+const (
+	BlockReasonDenied       = "denied"
+	BlockReasonNotAllowed   = "not_allowed"
+	BlockReasonLookupFailed = "lookup_failed"
+)
+
+// AccessRule matches lookup results. The rule matches if all of its non-empty fields match,
+// and the field matches if any of its values equals the result value. Strings are compared case-insensitively.
+type AccessRule struct {
+	// Countries are ISO 3166-1 alpha-2 country codes matching Location.Country
+	Countries []string `json:"countries,omitempty"`
+
+	// ASNs are autonomous system numbers matching AS.ASN
+	ASNs []int `json:"asns,omitempty"`
+
+	// ASTypes are autonomous system types matching AS.Type, e.g. "Content" for hosting providers
+	ASTypes []string `json:"asTypes,omitempty"`
+
+	// ConnectionTypes are connection types matching ConnectionType, e.g. "mobile"
+	ConnectionTypes []string `json:"connectionTypes,omitempty"`
+
+	// Expr is the expression matching the lookup result, see Expr
+	Expr string `json:"expr,omitempty"`
+
+	// expr is Expr compiled by AccessRules.Compile
+	expr *Expr
+}
+
+// Match reports whether the rule matches the lookup result.
+func (r AccessRule) Match(resp *GeoIPResponse) bool {
+	if resp == nil {
+		return false
+	}
+
+	if !matchString(r.Countries, resp.Location.Country) ||
+		!matchInt(r.ASNs, resp.AS.ASN) ||
+		!matchString(r.ASTypes, resp.AS.Type) ||
+		!matchString(r.ConnectionTypes, resp.ConnectionType) {
+		return false
+	}
+
+	if r.Expr == "" {
+		return true
+	}
+
+	expr := r.expr
+	if expr == nil {
+		// the rule isn't compiled, the invalid expression matches nothing
+		var err error
+		if expr, err = CompileExpr(r.Expr); err != nil {
+			return false
+		}
+	}
+
+	return expr.Eval(resp)
+}
+
+// matchString reports whether the values are empty or contain the value.
+func matchString(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchInt reports whether the values are empty or contain the value.
+func matchInt(values []int, value int) bool {
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AccessRules are allow and deny rules, e.g.
+//
+//	{
+//	  "allow": [{"countries": ["US", "CA"]}],
+//	  "deny": [{"asTypes": ["Content"]}, {"asns": [64496]}]
+//	}
+type AccessRules struct {
+	// Allow rules are checked if there are any, the lookup result must match one of them
+	Allow []AccessRule `json:"allow,omitempty"`
+
+	// Deny rules block the lookup results matching any of them even if they are allowed
+	Deny []AccessRule `json:"deny,omitempty"`
+}
+
+// Compile compiles expressions of the rules. Rules are compiled by LoadAccessRules and AccessControl,
+// otherwise expressions are compiled on every match.
+func (r *AccessRules) Compile() error {
+	for _, kind := range []string{"allow", "deny"} {
+		rules := r.Allow
+		if kind == "deny" {
+			rules = r.Deny
+		}
+
+		for i := range rules {
+			if rules[i].Expr == "" {
+				continue
+			}
+
+			expr, err := CompileExpr(rules[i].Expr)
+			if err != nil {
+				return fmt.Errorf("cannot compile %s rule %d: %w", kind, i+1, err)
+			}
+
+			rules[i].expr = expr
+		}
+	}
+
+	return nil
+}
+
+// Check returns the reason of blocking the lookup result or the empty string if it's allowed.
+func (r *AccessRules) Check(resp *GeoIPResponse) string {
+	for _, rule := range r.Deny {
+		if rule.Match(resp) {
+			return BlockReasonDenied
+		}
+	}
+
+	if len(r.Allow) == 0 {
+		return ""
+	}
+
+	for _, rule := range r.Allow {
+		if rule.Match(resp) {
+			return ""
+		}
+	}
+
+	return BlockReasonNotAllowed
+}
+
+// LoadAccessRules reads the JSON rules file.
+func LoadAccessRules(path string) (*AccessRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read access rules: %w", err)
+	}
+
+	var rules AccessRules
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("cannot parse access rules %s: %w", path, err)
+	}
+
+	if err := rules.Compile(); err != nil {
+		return nil, fmt.Errorf("cannot parse access rules %s: %w", path, err)
+	}
+
+	return &rules, nil
+}
+
+// AccessControlParams is used to create AccessControl. Middleware and either Rules or RulesFile are mandatory.
+type AccessControlParams struct {
+	// Middleware looks up client IP addresses. Its result is reused if the request has passed through it already
+	Middleware *Middleware
+
+	// Rules are the access rules if RulesFile is not set
+	Rules *AccessRules
+
+	// RulesFile is the JSON file with access rules, see AccessRules. It's reloaded when it changes
+	RulesFile string
+
+	// ReloadInterval is the interval of checking RulesFile for changes. Default: 10 seconds
+	ReloadInterval time.Duration
+
+	// OnReloadError is called if the changed RulesFile cannot be loaded, the previous rules are kept then
+	OnReloadError func(err error)
+
+	// FailClosed blocks requests if the lookup fails, exceeds the budget or the client IP is unknown or private.
+	// Otherwise such requests are allowed
+	FailClosed bool
+
+	// Blocked handles blocked requests, e.g. to show the challenge. BlockReasonFromContext returns the reason.
+	// Default: 403 Forbidden
+	Blocked http.Handler
+}
+
+// AccessControl is the net/http middleware blocking requests by the client location, see AccessRules.
+type AccessControl struct {
+	params AccessControlParams
+	rules  atomic.Pointer[AccessRules]
+
+	// reloadMu guards modTime and size identifying the loaded version of RulesFile
+	reloadMu sync.Mutex
+	modTime  time.Time
+	size     int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// blockReasonKey is the context key of the block reason.
+type blockReasonKey struct{}
+
+// NewAccessControl creates AccessControl with specified parameters. If RulesFile is set then it's watched
+// for changes until Close is called.
+func NewAccessControl(params AccessControlParams) (*AccessControl, error) {
+	if params.Middleware == nil {
+		return nil, &ArgError{Name: "Middleware", Message: "cannot be nil"}
+	}
+
+	if params.Rules == nil && params.RulesFile == "" {
+		return nil, &ArgError{Name: "Rules", Message: "or RulesFile must be set"}
+	}
+
+	if params.ReloadInterval <= 0 {
+		params.ReloadInterval = defaultRulesReloadInterval
+	}
+
+	if params.Blocked == nil {
+		params.Blocked = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+
+	a := &AccessControl{params: params, stop: make(chan struct{})}
+
+	if params.RulesFile == "" {
+		if err := a.SetRules(params.Rules); err != nil {
+			return nil, err
+		}
+
+		return a, nil
+	}
+
+	if _, err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	go a.watch()
+
+	return a, nil
+}
+
+// Rules returns the current rules.
+func (a *AccessControl) Rules() *AccessRules {
+	return a.rules.Load()
+}
+
+// SetRules compiles and replaces the rules. The previous rules are kept if the rules cannot be compiled.
+func (a *AccessControl) SetRules(rules *AccessRules) error {
+	if rules == nil {
+		return &ArgError{Name: "rules", Message: "cannot be nil"}
+	}
+
+	if err := rules.Compile(); err != nil {
+		return err
+	}
+
+	a.rules.Store(rules)
+
+	return nil
+}
+
+// Reload loads RulesFile if it has changed since the last load and reports whether the rules are replaced.
+// The previous rules are kept if the file cannot be loaded.
+func (a *AccessControl) Reload() (bool, error) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	info, err := os.Stat(a.params.RulesFile)
+	if err != nil {
+		return false, fmt.Errorf("cannot read access rules: %w", err)
+	}
+
+	if a.rules.Load() != nil && info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+		return false, nil
+	}
+
+	// the broken version is not loaded again, so its error is reported once
+	a.modTime, a.size = info.ModTime(), info.Size()
+
+	rules, err := LoadAccessRules(a.params.RulesFile)
+	if err != nil {
+		return false, err
+	}
+
+	a.rules.Store(rules)
+
+	return true, nil
+}
+
+// watch reloads RulesFile until Close is called.
+func (a *AccessControl) watch() {
+	ticker := time.NewTicker(a.params.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := a.Reload(); err != nil && a.params.OnReloadError != nil {
+				a.params.OnReloadError(err)
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Close stops watching RulesFile.
+func (a *AccessControl) Close() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+	})
+}
+
+// Handler returns the handler calling next for allowed requests and the Blocked handler for others.
+func (a *AccessControl) Handler(next http.Handler) http.Handler {
+	check := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reason := a.check(req.Context())
+		if reason == "" {
+			next.ServeHTTP(w, req)
+
+			return
+		}
+
+		a.params.Blocked.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), blockReasonKey{}, reason)))
+	})
+
+	lookup := a.params.Middleware.Handler(check)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Context().Value(geoContextKey{}).(*geoContext); ok {
+			check.ServeHTTP(w, req)
+
+			return
+		}
+
+		lookup.ServeHTTP(w, req)
+	})
+}
+
+// check returns the reason of blocking the request with the lookup result in the context.
+func (a *AccessControl) check(ctx context.Context) string {
+	resp := GeoIPFromContext(ctx)
+	if resp == nil {
+		if a.params.FailClosed {
+			return BlockReasonLookupFailed
+		}
+
+		return ""
+	}
+
+	return a.rules.Load().Check(resp)
+}
+
+// BlockReasonFromContext returns the reason of blocking the request by AccessControl:
+// BlockReasonDenied, BlockReasonNotAllowed or BlockReasonLookupFailed.
+func BlockReasonFromContext(ctx context.Context) string {
+	reason, _ := ctx.Value(blockReasonKey{}).(string)
+
+	return reason
+}
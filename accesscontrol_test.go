@@ -0,0 +1,344 @@
+package simplegeoip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// locationService is the GeoipService answering with the responses by the queried IP address.
+type locationService map[string]*GeoIPResponse
+
+// Get returns the response of the queried IP address or ErrNotFound.
+func (s locationService) Get(_ context.Context, opts ...Option) (*GeoIPResponse, *Response, error) {
+	values := url.Values{}
+	for _, opt := range opts {
+		opt(values)
+	}
+
+	resp, ok := s[values.Get("ipAddress")]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	return resp, &Response{}, nil
+}
+
+// GetRaw is not used by AccessControl.
+func (s locationService) GetRaw(ctx context.Context, opts ...Option) (*Response, error) {
+	_, resp, err := s.Get(ctx, opts...)
+
+	return resp, err
+}
+
+// newLocationService returns the service with the US residential, US hosting and German mobile addresses.
+func newLocationService() locationService {
+	us := &GeoIPResponse{}
+	us.Location.Country = "US"
+	us.AS.ASN = 7922
+	us.AS.Type = "Cable/DSL/ISP"
+
+	hosting := &GeoIPResponse{}
+	hosting.Location.Country = "US"
+	hosting.AS.ASN = 16509
+	hosting.AS.Type = "Content"
+
+	de := &GeoIPResponse{ConnectionType: "mobile"}
+	de.Location.Country = "DE"
+	de.AS.ASN = 3320
+
+	return locationService{"1.1.1.1": us, "2.2.2.2": hosting, "3.3.3.3": de}
+}
+
+// TestAccessRules tests allow and deny rules.
+func TestAccessRules(t *testing.T) {
+	service := newLocationService()
+
+	rules := &AccessRules{
+		Allow: []AccessRule{{Countries: []string{"us"}}, {ConnectionTypes: []string{"mobile"}, ASNs: []int{3320}}},
+		Deny:  []AccessRule{{ASTypes: []string{"content"}}},
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "allowed country", ip: "1.1.1.1", want: ""},
+		{name: "denied AS type", ip: "2.2.2.2", want: BlockReasonDenied},
+		{name: "allowed connection type and ASN", ip: "3.3.3.3", want: ""},
+		{name: "not allowed", ip: "4.4.4.4", want: BlockReasonNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := service[tt.ip]
+			if resp == nil {
+				resp = &GeoIPResponse{}
+				resp.Location.Country = "FR"
+			}
+
+			if got := rules.Check(resp); got != tt.want {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := (&AccessRules{}).Check(service["1.1.1.1"]); got != "" {
+		t.Errorf("Check() without rules = %q, want allowed", got)
+	}
+
+	exprRules := &AccessRules{Deny: []AccessRule{{Countries: []string{"DE"}, Expr: `connectionType == "mobile"`}}}
+
+	// the rule is compiled on the fly
+	if got := exprRules.Check(service["3.3.3.3"]); got != BlockReasonDenied {
+		t.Errorf("Check() of the expression = %q, want %q", got, BlockReasonDenied)
+	}
+
+	if err := exprRules.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := exprRules.Check(service["3.3.3.3"]); got != BlockReasonDenied {
+		t.Errorf("Check() of the compiled expression = %q, want %q", got, BlockReasonDenied)
+	}
+
+	if got := exprRules.Check(service["1.1.1.1"]); got != "" {
+		t.Errorf("Check() of the expression = %q, want allowed", got)
+	}
+
+	exprRules.Deny = append(exprRules.Deny, AccessRule{Expr: `connectionType = "mobile"`})
+	checkErr(t, exprRules.Compile(),
+		`cannot compile deny rule 2: invalid expression at column 16: unexpected character '=', use "==" to compare`)
+}
+
+// TestAccessControl tests blocking requests and the lookup failure policy.
+func TestAccessControl(t *testing.T) {
+	middleware, err := NewMiddleware(MiddlewareParams{Service: newLocationService(), Budget: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := &AccessRules{Deny: []AccessRule{{Countries: []string{"DE"}}}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		failClosed bool
+		wantStatus int
+		wantReason string
+	}{
+		{name: "allowed", remoteAddr: "1.1.1.1:1234", wantStatus: http.StatusOK},
+		{name: "denied", remoteAddr: "3.3.3.3:1234", wantStatus: http.StatusForbidden, wantReason: BlockReasonDenied},
+		{name: "fail open", remoteAddr: "4.4.4.4:1234", wantStatus: http.StatusOK},
+		{
+			name:       "fail closed",
+			remoteAddr: "4.4.4.4:1234",
+			failClosed: true,
+			wantStatus: http.StatusForbidden,
+			wantReason: BlockReasonLookupFailed,
+		},
+		{
+			name:       "private fail closed",
+			remoteAddr: "10.0.0.1:1234",
+			failClosed: true,
+			wantStatus: http.StatusForbidden,
+			wantReason: BlockReasonLookupFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reason string
+
+			access, err := NewAccessControl(AccessControlParams{
+				Middleware: middleware,
+				Rules:      rules,
+				FailClosed: tt.failClosed,
+				Blocked: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					reason = BlockReasonFromContext(req.Context())
+					w.WriteHeader(http.StatusForbidden)
+				}),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler := access.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus || reason != tt.wantReason {
+				t.Errorf("got %d %q, want %d %q", rec.Code, reason, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+
+	_, err = NewAccessControl(AccessControlParams{Rules: rules})
+	checkErr(t, err, `invalid argument: "Middleware" cannot be nil`)
+
+	_, err = NewAccessControl(AccessControlParams{Middleware: middleware})
+	checkErr(t, err, `invalid argument: "Rules" or RulesFile must be set`)
+
+	access, err := NewAccessControl(AccessControlParams{Middleware: middleware, Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkErr(t, access.SetRules(nil), `invalid argument: "rules" cannot be nil`)
+
+	if access.Rules() != rules {
+		t.Error("SetRules(nil) replaced the rules")
+	}
+}
+
+// TestAccessControlReload tests reloading the rules file.
+func TestAccessControlReload(t *testing.T) {
+	middleware, err := NewMiddleware(MiddlewareParams{Service: newLocationService(), Budget: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "access.json")
+
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write(`{"deny": [{"countries": ["DE"]}]}`, start)
+
+	var reloadErr error
+
+	access, err := NewAccessControl(AccessControlParams{
+		Middleware:     middleware,
+		RulesFile:      path,
+		ReloadInterval: time.Hour,
+		OnReloadError:  func(err error) { reloadErr = err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+
+	status := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "3.3.3.3:1234"
+
+		rec := httptest.NewRecorder()
+		access.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	if got := status(); got != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", got, http.StatusForbidden)
+	}
+
+	if reloaded, err := access.Reload(); reloaded || err != nil {
+		t.Errorf("Reload() of the same file = %v, %v", reloaded, err)
+	}
+
+	write(`{"deny": [{"countries": ["FR"]}]}`, start.Add(time.Minute))
+
+	if reloaded, err := access.Reload(); !reloaded || err != nil {
+		t.Errorf("Reload() of the changed file = %v, %v", reloaded, err)
+	}
+
+	if got := status(); got != http.StatusOK {
+		t.Errorf("status after reload = %d, want %d", got, http.StatusOK)
+	}
+
+	write(`{"deny": [{"country": ["DE"]}]}`, start.Add(2*time.Minute))
+
+	_, err = access.Reload()
+	checkErr(t, err, "cannot parse access rules "+path+`: json: unknown field "country"`)
+
+	if got := status(); got != http.StatusOK {
+		t.Errorf("status after the broken file = %d, want the previous rules", got)
+	}
+
+	if reloaded, err := access.Reload(); reloaded || err != nil {
+		t.Errorf("Reload() of the same broken file = %v, %v", reloaded, err)
+	}
+
+	if reloadErr != nil {
+		t.Errorf("OnReloadError is called by Reload: %v", reloadErr)
+	}
+
+	_, err = NewAccessControl(AccessControlParams{Middleware: middleware, RulesFile: path})
+	checkErr(t, err, "cannot parse access rules "+path+`: json: unknown field "country"`)
+}
+
+// TestAccessControlWatch tests that the changed rules file is reloaded in the background.
+func TestAccessControlWatch(t *testing.T) {
+	middleware, err := NewMiddleware(MiddlewareParams{Service: newLocationService(), Budget: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "access.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 10)
+
+	access, err := NewAccessControl(AccessControlParams{
+		Middleware:     middleware,
+		RulesFile:      path,
+		ReloadInterval: 5 * time.Millisecond,
+		OnReloadError:  func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer access.Close()
+
+	if err := os.WriteFile(path, []byte(`{"deny": [{"countries": ["DE"]}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(access.Rules().Deny) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if len(access.Rules().Deny) != 1 {
+		t.Fatalf("Rules() = %+v, want the changed rules", access.Rules())
+	}
+
+	if err := os.WriteFile(path, []byte(`{`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("OnReloadError() is called without the error")
+		}
+	case <-time.After(time.Second):
+		t.Error("OnReloadError() is not called for the broken file")
+	}
+
+	if len(access.Rules().Deny) != 1 {
+		t.Errorf("Rules() = %+v, want the previous rules", access.Rules())
+	}
+}
@@ -0,0 +1,150 @@
+package simplegeoip
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultBatchConcurrency is the default number of concurrent batch lookups.
+const defaultBatchConcurrency = 4
+
+// BatchParams is used to run Batch. None of parameters are mandatory.
+type BatchParams struct {
+	// Concurrency is the number of concurrent lookups. Default: 4
+	Concurrency int
+
+	// RequestsPerSecond limits the rate of lookups. Lookups answered by the service from its cache are not limited
+	// if the service is Cache. If it's zero then the rate is not limited
+	RequestsPerSecond float64
+
+	// Options are added to the query of every lookup, e.g. OptionReverseIP(0)
+	Options []Option
+
+	// MetricsSink receives the time spent waiting for the rate limiter. If it's nil then nothing is recorded
+	MetricsSink MetricsSink
+}
+
+// BatchResult is the result of the batch lookup of a single target.
+type BatchResult struct {
+	// Index is the position of the target in the input
+	Index int
+
+	// Target is the IP address, the domain or the email looked up
+	Target string
+
+	// Response is the parsed response. It's nil on error
+	Response *GeoIPResponse
+
+	// Err is the lookup error
+	Err error
+}
+
+// Batch looks up the targets concurrently. Targets are IP addresses, domains or emails, see OptionTarget.
+// Results are sent to the returned channel in the completion order, it's closed after the targets channel is
+// closed and all lookups are done, or after ctx is done. Targets left unread when ctx is done are not looked up.
+func Batch(ctx context.Context, service GeoipService, targets <-chan string, params BatchParams) (<-chan BatchResult, error) {
+	if service == nil {
+		return nil, &ArgError{Name: "service", Message: "cannot be nil"}
+	}
+
+	if params.Concurrency <= 0 {
+		params.Concurrency = defaultBatchConcurrency
+	}
+
+	var limiter *RateLimiter
+
+	if params.RequestsPerSecond > 0 {
+		var err error
+
+		limiter, err = NewRateLimiter(RateLimiterParams{
+			RequestsPerSecond: params.RequestsPerSecond,
+			MetricsSink:       params.MetricsSink,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jobs := make(chan BatchResult)
+	results := make(chan BatchResult)
+
+	go func() {
+		defer close(jobs)
+
+		for index := 0; ; index++ {
+			select {
+			case target, ok := <-targets:
+				if !ok {
+					return
+				}
+
+				select {
+				case jobs <- BatchResult{Index: index, Target: target}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < params.Concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				job.Response, job.Err = lookupTarget(ctx, service, limiter, job.Target, params.Options)
+
+				select {
+				case results <- job:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results, nil
+}
+
+// lookupTarget waits for the rate limiter unless the target is cached and looks up the target.
+func lookupTarget(ctx context.Context, service GeoipService, limiter *RateLimiter, target string, opts []Option) (*GeoIPResponse, error) {
+	option, err := OptionTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]Option{option}, opts...)
+
+	if limiter != nil && !isCached(service, opts) {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, _, err := service.Get(ctx, opts...)
+
+	return resp, err
+}
+
+// isCached reports whether the service is Cache holding the response of the query.
+func isCached(service GeoipService, opts []Option) bool {
+	cache, ok := service.(*Cache)
+	if !ok {
+		return false
+	}
+
+	_, ok = cache.Peek(opts...)
+
+	return ok
+}
@@ -0,0 +1,177 @@
+package simplegeoip
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchService is the GeoipService answering with the queried IP address.
+type batchService struct {
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+// Get returns the response with the queried IP address, 0.0.0.0 is not found.
+func (s *batchService) Get(ctx context.Context, opts ...Option) (*GeoIPResponse, *Response, error) {
+	values := url.Values{}
+	for _, opt := range opts {
+		opt(values)
+	}
+
+	s.mu.Lock()
+	s.queries = append(s.queries, values)
+	s.mu.Unlock()
+
+	if values.Get("ipAddress") == "0.0.0.0" {
+		return nil, nil, ErrNotFound
+	}
+
+	return &GeoIPResponse{IP: values.Get("ipAddress")}, &Response{}, nil
+}
+
+// GetRaw is not used by Batch.
+func (s *batchService) GetRaw(ctx context.Context, opts ...Option) (*Response, error) {
+	_, resp, err := s.Get(ctx, opts...)
+
+	return resp, err
+}
+
+// sendTargets returns the closed channel with the targets.
+func sendTargets(targets ...string) <-chan string {
+	ch := make(chan string, len(targets))
+	for _, target := range targets {
+		ch <- target
+	}
+
+	close(ch)
+
+	return ch
+}
+
+// TestBatch tests results, errors and options of batch lookups.
+func TestBatch(t *testing.T) {
+	service := &batchService{}
+
+	results, err := Batch(context.Background(), service, sendTargets("8.8.8.8", "not a host", "1.1.1.1", "0.0.0.0"),
+		BatchParams{Concurrency: 2, Options: []Option{OptionReverseIP(0)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []BatchResult
+	for result := range results {
+		got = append(got, result)
+	}
+
+	sort.Slice(got, func(i, j int) bool {
+		return got[i].Index < got[j].Index
+	})
+
+	if len(got) != 4 {
+		t.Fatalf("got %d results, want 4", len(got))
+	}
+
+	for i, want := range []string{"8.8.8.8", "", "1.1.1.1", ""} {
+		if got[i].Index != i {
+			t.Errorf("result %d index = %d", i, got[i].Index)
+		}
+
+		if want == "" {
+			if got[i].Err == nil || got[i].Response != nil {
+				t.Errorf("result %d = %+v, want error", i, got[i])
+			}
+
+			continue
+		}
+
+		if got[i].Err != nil || got[i].Response.IP != want {
+			t.Errorf("result %d = %+v, want %s", i, got[i], want)
+		}
+	}
+
+	checkErr(t, got[1].Err, `invalid argument: "target" is not an IP address, a domain or an email: "not a host"`)
+	checkErr(t, got[3].Err, ErrNotFound.Error())
+
+	if len(service.queries) != 3 {
+		t.Fatalf("got %d queries, want 3", len(service.queries))
+	}
+
+	for _, query := range service.queries {
+		if query.Get("reverseIp") != "0" {
+			t.Errorf("query = %s, want reverseIp=0", query.Encode())
+		}
+	}
+
+	_, err = Batch(context.Background(), nil, sendTargets(), BatchParams{})
+	checkErr(t, err, `invalid argument: "service" cannot be nil`)
+}
+
+// TestBatchRate tests the rate limit and the cancellation of batch lookups.
+func TestBatchRate(t *testing.T) {
+	start := time.Now()
+
+	results, err := Batch(context.Background(), &batchService{}, sendTargets("8.8.8.8", "8.8.4.4", "1.1.1.1"),
+		BatchParams{Concurrency: 3, RequestsPerSecond: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range results {
+	}
+
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("3 lookups at 50 rps took %v", elapsed)
+	}
+
+	// cached lookups don't wait for the rate limiter
+	cache := NewCache(&batchService{}, CacheParams{})
+	targets := []string{"8.8.8.8", "8.8.4.4", "1.1.1.1", "1.0.0.1", "9.9.9.9"}
+
+	for _, target := range targets {
+		if _, _, err := cache.Get(context.Background(), OptionIPAddress(target)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start = time.Now()
+
+	results, err = Batch(context.Background(), cache, sendTargets(targets...), BatchParams{Concurrency: 1, RequestsPerSecond: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for result := range results {
+		if result.Err != nil {
+			t.Errorf("Batch() got error %v for %s", result.Err, result.Target)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("5 cached lookups at 1 rps took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pending := make(chan string)
+
+	results, err = Batch(ctx, &batchService{}, pending, BatchParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending <- "8.8.8.8"
+	<-results
+	cancel()
+
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Error("got the result after cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Error("results are not closed after cancellation")
+	}
+}
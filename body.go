@@ -0,0 +1,187 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// defaultMaxBodySize is the default maximum size of the response body.
+const defaultMaxBodySize = 1 << 20
+
+// ErrBodyTooLarge is returned when the response body exceeds ClientParams.MaxBodySize.
+var ErrBodyTooLarge = errors.New("response body is too large")
+
+// maxPooledBuffer is the maximum capacity of buffers returned to bufferPool.
+// Larger buffers are dropped to avoid keeping rare large responses in memory.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool keeps buffers the response body is read into by GetInto.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// apiResponsePool keeps responses decoded by GetInto. They are copied to the caller's GeoIPResponse
+// once the call is over, so hedged attempts still running never write to it.
+var apiResponsePool = sync.Pool{
+	New: func() interface{} {
+		return new(apiResponse)
+	},
+}
+
+// decodeFunc decodes the response body while it's read.
+type decodeFunc func(r io.Reader) (interface{}, error)
+
+// decodePooled reads the body into the pooled buffer and parses it into the pooled response.
+func decodePooled(body io.Reader) (interface{}, error) {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+
+	defer func() {
+		if b.Cap() <= maxPooledBuffer {
+			bufferPool.Put(b)
+		}
+	}()
+
+	if _, err := b.ReadFrom(body); err != nil {
+		return nil, fmt.Errorf("cannot read response: %w", err)
+	}
+
+	response := apiResponsePool.Get().(*apiResponse)
+	*response = apiResponse{GeoIPResponse: GeoIPResponse{Domains: response.Domains[:0]}}
+
+	if err := json.Unmarshal(b.Bytes(), response); err != nil {
+		apiResponsePool.Put(response)
+
+		return nil, fmt.Errorf("cannot parse response: %w", err)
+	}
+
+	return response, nil
+}
+
+// copyInto copies the response to dst reusing dst.Domains.
+func (r *apiResponse) copyInto(dst *GeoIPResponse) {
+	domains := append(dst.Domains[:0], r.Domains...)
+
+	*dst = r.GeoIPResponse
+	dst.Domains = domains
+}
+
+// decodeAPIResponse decodes IP Geolocation API response.
+func decodeAPIResponse(r io.Reader) (interface{}, error) {
+	var response apiResponse
+
+	err := json.NewDecoder(r).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// parse parses raw IP Geolocation API response.
+func parse(raw []byte) (*apiResponse, error) {
+	response, err := decodeAPIResponse(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(*apiResponse), nil
+}
+
+// apiResponse returns the response decoded while reading, or parses the body if it hasn't been decoded,
+// e.g. when the response is returned by an interceptor.
+func (r *Response) apiResponse() (*apiResponse, error) {
+	if r.decodeErr != nil {
+		return nil, r.decodeErr
+	}
+
+	if decoded, ok := r.decoded.(*apiResponse); ok {
+		return decoded, nil
+	}
+
+	return parse(r.Body)
+}
+
+// size returns the number of body bytes read.
+func (r *Response) size() int64 {
+	if r.bytesRead > 0 {
+		return r.bytesRead
+	}
+
+	return int64(len(r.Body))
+}
+
+// readBody reads the body of the call response into the response. The body is decoded straight from the reader
+// if the call has the decoder and the body is not retained.
+func (c *Client) readBody(body io.Reader, call *Call, response *Response) error {
+	limited := &limitedReader{r: body, n: c.maxBodySize}
+
+	defer func() {
+		response.bytesRead = limited.read
+	}()
+
+	if call.decode == nil || c.retainBody {
+		var b bytes.Buffer
+
+		_, err := b.ReadFrom(limited)
+
+		response.Body = b.Bytes()
+
+		if err != nil || call.decode == nil {
+			return err
+		}
+
+		response.decoded, response.decodeErr = call.decode(bytes.NewReader(response.Body))
+
+		return nil
+	}
+
+	response.decoded, response.decodeErr = call.decode(limited)
+	if errors.Is(response.decodeErr, ErrBodyTooLarge) {
+		return ErrBodyTooLarge
+	}
+
+	// the rest of the body is read to reuse the connection
+	_, err := io.Copy(io.Discard, limited)
+
+	return err
+}
+
+// limitedReader reads at most n bytes and returns ErrBodyTooLarge if there are more.
+type limitedReader struct {
+	r io.Reader
+
+	// n is the number of bytes left, read is the number of bytes read
+	n    int64
+	read int64
+}
+
+// Read reads from the underlying reader up to the limit.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var probe [1]byte
+
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	l.read += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,290 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// bodyTransport answers every request with the body.
+type bodyTransport struct {
+	body []byte
+}
+
+// RoundTrip returns the response with the body.
+func (t bodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+// newBodyClient creates Client answering with the body.
+func newBodyClient(body string, params ClientParams) *Client {
+	params.HTTPClient = &http.Client{Transport: bodyTransport{body: []byte(body)}}
+	params.GeoipBaseURL = &url.URL{Scheme: "http", Host: "geoip.test"}
+
+	return NewClient(apiKey, params)
+}
+
+// TestBody tests streaming decoding, body retention and the body size limit.
+func TestBody(t *testing.T) {
+	small := `{"ip":"8.8.8.8","isp":"Google"}`
+	large := `{"ip":"8.8.8.8","domains":["` + strings.Repeat("a", 100) + `"]}`
+
+	tests := []struct {
+		name     string
+		body     string
+		params   ClientParams
+		wantBody string
+		wantErr  error
+	}{
+		{
+			name: "streaming",
+			body: small,
+		},
+		{
+			name:     "retained",
+			body:     small,
+			params:   ClientParams{RetainBody: true},
+			wantBody: small,
+		},
+		{
+			name:   "exact limit",
+			body:   small,
+			params: ClientParams{MaxBodySize: int64(len(small))},
+		},
+		{
+			name:    "too large",
+			body:    large,
+			params:  ClientParams{MaxBodySize: 64},
+			wantErr: ErrBodyTooLarge,
+		},
+		{
+			name:    "too large retained",
+			body:    large,
+			params:  ClientParams{MaxBodySize: 64, RetainBody: true},
+			wantErr: ErrBodyTooLarge,
+		},
+		{
+			name:    "trailing data over limit",
+			body:    small + strings.Repeat(" ", 100),
+			params:  ClientParams{MaxBodySize: 64},
+			wantErr: ErrBodyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newBodyClient(tt.body, tt.params)
+
+			geoipResp, resp, err := client.Get(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if geoipResp.IP != "8.8.8.8" {
+				t.Errorf("IP = %s, want 8.8.8.8", geoipResp.IP)
+			}
+
+			if string(resp.Body) != tt.wantBody {
+				t.Errorf("Body = %s, want %s", resp.Body, tt.wantBody)
+			}
+
+			if resp.size() != int64(len(tt.body)) {
+				t.Errorf("size() = %d, want %d", resp.size(), len(tt.body))
+			}
+
+			raw, err := client.GetRaw(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(raw.Body) != tt.body {
+				t.Errorf("GetRaw() Body = %s, want %s", raw.Body, tt.body)
+			}
+		})
+	}
+}
+
+// TestBodyDecodeError tests the decoding error of the streamed body.
+func TestBodyDecodeError(t *testing.T) {
+	client := newBodyClient(`<html>`, ClientParams{})
+
+	_, _, err := client.Get(context.Background())
+	checkErr(t, err, "cannot parse response: invalid character '<' looking for beginning of value")
+}
+
+// benchmarkBody is the typical API response.
+const benchmarkBody = `{"ip":"8.8.8.8","location":{"country":"US","region":"California",` +
+	`"city":"Mountain View","lat":37.40599,"lng":-122.078514,"postalCode":"94043","timezone":"-08:00",` +
+	`"geonameId":5375481},"domains":["0--9.ru","000.lyxhwy.xyz","000180.top"],` +
+	`"as":{"asn":15169,"name":"Google LLC","route":"8.8.8.0/24","domain":"https://about.google/intl/en/","type":"Content"},` +
+	`"isp":"Google LLC","connectionType":""}`
+
+// BenchmarkGet compares allocations of Get with the streamed and the retained body.
+// The retained body is decoded the way it was before streaming.
+func BenchmarkGet(b *testing.B) {
+	for _, bm := range []struct {
+		name   string
+		params ClientParams
+	}{
+		{name: "streamed", params: ClientParams{}},
+		{name: "retained", params: ClientParams{RetainBody: true}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			client := newBodyClient(benchmarkBody, bm.params)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, _, err := client.Get(ctx, OptionIPAddress("8.8.8.8")); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetInto measures allocations of GetInto reusing the response.
+func BenchmarkGetInto(b *testing.B) {
+	client := newBodyClient(benchmarkBody, ClientParams{})
+	ctx := context.Background()
+
+	var dst GeoIPResponse
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := client.GetInto(ctx, &dst, OptionIPAddress("8.8.8.8")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestGetInto tests that GetInto resets and reuses the caller's response.
+func TestGetInto(t *testing.T) {
+	client := newBodyClient(benchmarkBody, ClientParams{})
+	ctx := context.Background()
+
+	dst := GeoIPResponse{ISP: "stale", Domains: make([]string, 0, 8)}
+	backing := &dst.Domains[:1][0]
+
+	resp, err := client.GetInto(ctx, &dst, OptionIPAddress("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GetInto() response = %+v", resp)
+	}
+
+	if dst.IP != "8.8.8.8" || dst.ISP != "Google LLC" || dst.Location.City != "Mountain View" || dst.AS.ASN != 15169 {
+		t.Errorf("GetInto() = %+v", dst)
+	}
+
+	if len(dst.Domains) != 3 || &dst.Domains[:1][0] != backing {
+		t.Errorf("Domains = %v, want 3 domains in the reused slice", dst.Domains)
+	}
+
+	// fields missing in the next response are reset
+	client = newBodyClient(`{"ip":"1.1.1.1"}`, ClientParams{})
+
+	if _, err := client.GetInto(ctx, &dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.IP != "1.1.1.1" || dst.ISP != "" || len(dst.Domains) != 0 || dst.Location.City != "" {
+		t.Errorf("GetInto() = %+v, want reset fields", dst)
+	}
+}
+
+// TestGetIntoErrors tests errors of GetInto.
+func TestGetIntoErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		dst     *GeoIPResponse
+		wantErr string
+	}{
+		{
+			name:    "nil dst",
+			body:    benchmarkBody,
+			wantErr: `invalid argument: "dst" is nil`,
+		},
+		{
+			name:    "API error",
+			body:    `{"code":422,"error":"invalid IP"}`,
+			dst:     &GeoIPResponse{},
+			wantErr: "API error: [422] invalid IP",
+		},
+		{
+			name:    "invalid body",
+			body:    `<html>`,
+			dst:     &GeoIPResponse{},
+			wantErr: "cannot parse response: invalid character '<' looking for beginning of value",
+		},
+		{
+			name:    "too large",
+			body:    `{"ip":"` + strings.Repeat("1", defaultMaxBodySize) + `"}`,
+			dst:     &GeoIPResponse{},
+			wantErr: "cannot read response: response body is too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newBodyClient(tt.body, ClientParams{}).GetInto(context.Background(), tt.dst)
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+// maxGetIntoAllocs is the allocations budget of GetInto. Most of them are made by net/http.
+const maxGetIntoAllocs = 45
+
+// TestGetIntoAllocs guards allocations of GetInto against regressions.
+func TestGetIntoAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with the race detector")
+	}
+
+	client := newBodyClient(benchmarkBody, ClientParams{})
+	ctx := context.Background()
+
+	var dst GeoIPResponse
+
+	getInto := testing.AllocsPerRun(100, func() {
+		if _, err := client.GetInto(ctx, &dst, OptionIPAddress("8.8.8.8")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	get := testing.AllocsPerRun(100, func() {
+		if _, _, err := client.Get(ctx, OptionIPAddress("8.8.8.8")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if getInto > maxGetIntoAllocs {
+		t.Errorf("GetInto() makes %.0f allocations, want at most %d", getInto, maxGetIntoAllocs)
+	}
+
+	if getInto >= get {
+		t.Errorf("GetInto() makes %.0f allocations, want less than Get() with %.0f", getInto, get)
+	}
+}
@@ -0,0 +1,327 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCacheTTL is the default time to keep responses in Cache.
+	defaultCacheTTL = time.Hour
+
+	// defaultCacheMaxEntries is the default maximum number of responses in Cache.
+	defaultCacheMaxEntries = 10000
+)
+
+// CacheBackend is the Response.Backend value of responses served by Cache.
+const CacheBackend = "cache"
+
+// CacheParams is used to create Cache. None of parameters are mandatory.
+type CacheParams struct {
+	// TTL is the time to keep responses. Default: 1 hour
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of responses to keep.
+	// The least recently used response is evicted when it's exceeded. Default: 10000
+	MaxEntries int
+
+	// Logger logs cache hits and misses at debug level. If it's nil then nothing is logged
+	Logger *slog.Logger
+
+	// Tracer starts spans around Get calls reporting cache hits. If it's nil then nothing is traced
+	Tracer Tracer
+
+	// MetricsSink receives cache hits and misses. If it's nil then nothing is recorded
+	MetricsSink MetricsSink
+}
+
+// Cache is the GeoipService keeping parsed responses of the wrapped service in memory.
+// Only successful Get responses are cached, GetRaw requests are passed through.
+type Cache struct {
+	service GeoipService
+	params  CacheParams
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+
+	// now returns the current time, it's replaced in tests
+	now func() time.Time
+}
+
+var _ GeoipService = &Cache{}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	key     string
+	resp    GeoIPResponse
+	body    []byte
+	expires time.Time
+}
+
+// NewCache creates Cache wrapping the service with specified parameters.
+func NewCache(service GeoipService, params CacheParams) *Cache {
+	if params.TTL <= 0 {
+		params.TTL = defaultCacheTTL
+	}
+
+	if params.MaxEntries <= 0 {
+		params.MaxEntries = defaultCacheMaxEntries
+	}
+
+	return &Cache{
+		service: service,
+		params:  params,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// cacheKey returns the cache key for the options. The output format is ignored as Get always uses JSON.
+func cacheKey(opts []Option) string {
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+
+	query.Del("outputFormat")
+
+	return query.Encode()
+}
+
+// Get returns the cached response or the response of the wrapped service.
+func (c *Cache) Get(
+	ctx context.Context,
+	opts ...Option,
+) (geoipResponse *GeoIPResponse, resp *Response, err error) {
+	ctx, span := startSpan(ctx, c.params.Tracer, "geoip.Cache.Get", opts)
+
+	defer func() {
+		endSpan(span, resp, err)
+	}()
+
+	key := cacheKey(opts)
+
+	if geoipResponse, body, ok := c.lookup(key); ok {
+		c.log(ctx, "geoip cache hit", key)
+		span.SetAttributes(Attribute{Key: TraceKeyCacheHit, Value: true})
+		c.record("hit")
+
+		// the body is copied, so callers modifying it don't corrupt the cached one
+		return geoipResponse, &Response{Body: bytes.Clone(body), Backend: CacheBackend}, nil
+	}
+
+	c.log(ctx, "geoip cache miss", key)
+	span.SetAttributes(Attribute{Key: TraceKeyCacheHit, Value: false})
+	c.record("miss")
+
+	geoipResponse, resp, err = c.service.Get(ctx, opts...)
+	if err != nil {
+		return geoipResponse, resp, err
+	}
+
+	var body []byte
+	if resp != nil {
+		body = bytes.Clone(resp.Body)
+	}
+
+	c.store(key, geoipResponse, body)
+
+	return geoipResponse, resp, nil
+}
+
+// Peek returns the cached response without calling the wrapped service. Hits and misses are not recorded.
+func (c *Cache) Peek(opts ...Option) (*GeoIPResponse, bool) {
+	geoipResponse, _, ok := c.lookup(cacheKey(opts))
+
+	return geoipResponse, ok
+}
+
+// GetRaw returns the raw response of the wrapped service.
+func (c *Cache) GetRaw(
+	ctx context.Context,
+	opts ...Option,
+) (resp *Response, err error) {
+	return c.service.GetRaw(ctx, opts...)
+}
+
+// log writes the debug log record about the cache key.
+func (c *Cache) log(ctx context.Context, msg, key string) {
+	if c.params.Logger != nil {
+		c.params.Logger.LogAttrs(ctx, slog.LevelDebug, msg, slog.String(LogKeyCacheKey, key))
+	}
+}
+
+// record counts the cache lookup with the result.
+func (c *Cache) record(result string) {
+	if c.params.MetricsSink != nil {
+		c.params.MetricsSink.AddCounter(MetricCacheRequests, 1, Label{Name: "result", Value: result})
+	}
+}
+
+// Len returns the number of cached responses including expired ones not evicted yet.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Purge removes all cached responses.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// savedEntry is the cached response in the saved cache.
+type savedEntry struct {
+	Key      string          `json:"key"`
+	Response GeoIPResponse   `json:"response"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Expires  time.Time       `json:"expires"`
+}
+
+// Save writes responses which are not expired as JSON, so they can be loaded by the next run with Load.
+func (c *Cache) Save(w io.Writer) error {
+	c.mu.Lock()
+
+	now := c.now()
+	entries := make([]savedEntry, 0, c.lru.Len())
+
+	// the least recently used response goes first, so Load restores the order
+	for elem := c.lru.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*cacheEntry)
+		if !now.Before(entry.expires) {
+			continue
+		}
+
+		saved := savedEntry{Key: entry.key, Response: entry.resp, Expires: entry.expires}
+		if json.Valid(entry.body) {
+			saved.Body = entry.body
+		}
+
+		entries = append(entries, saved)
+	}
+
+	c.mu.Unlock()
+
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		return fmt.Errorf("cannot save cache: %w", err)
+	}
+
+	return nil
+}
+
+// Load adds responses saved with Save. Expired responses are skipped, the others keep their expiration time.
+func (c *Cache) Load(r io.Reader) error {
+	var entries []savedEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return fmt.Errorf("cannot load cache: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for _, saved := range entries {
+		if !now.Before(saved.Expires) {
+			continue
+		}
+
+		entry := &cacheEntry{key: saved.Key, resp: saved.Response, body: saved.Body, expires: saved.Expires}
+
+		if elem, ok := c.items[saved.Key]; ok {
+			elem.Value = entry
+			c.lru.MoveToFront(elem)
+
+			continue
+		}
+
+		c.items[saved.Key] = c.lru.PushFront(entry)
+	}
+
+	for c.lru.Len() > c.params.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+
+	return nil
+}
+
+// lookup returns a copy of the cached response if it's not expired.
+func (c *Cache) lookup(key string) (*GeoIPResponse, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.items, key)
+
+		return nil, nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	resp := entry.resp
+	if entry.resp.Domains != nil {
+		resp.Domains = append([]string(nil), entry.resp.Domains...)
+	}
+
+	return &resp, entry.body, true
+}
+
+// store adds the response to the cache evicting the least recently used one if needed.
+func (c *Cache) store(key string, geoipResponse *GeoIPResponse, body []byte) {
+	if geoipResponse == nil {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:     key,
+		resp:    *geoipResponse,
+		body:    body,
+		expires: c.now().Add(c.params.TTL),
+	}
+
+	if geoipResponse.Domains != nil {
+		entry.resp.Domains = append([]string(nil), geoipResponse.Domains...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.params.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,140 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCache tests the cache hits, expiration and eviction.
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	service := &stubService{resp: &GeoIPResponse{IP: "8.8.8.8", Domains: []string{"dns.google"}}}
+
+	now := time.Now()
+	cache := NewCache(service, CacheParams{TTL: time.Minute, MaxEntries: 2})
+	cache.now = func() time.Time { return now }
+
+	get := func(ip string) *Response {
+		t.Helper()
+
+		got, resp, err := cache.Get(ctx, OptionIPAddress(ip), OptionOutputFormat("XML"))
+		if err != nil || got == nil {
+			t.Fatalf("Get() got = %v, error = %v", got, err)
+		}
+
+		got.Domains[0] = "modified"
+
+		if len(resp.Body) > 0 {
+			resp.Body[0] = 'x'
+		}
+
+		return resp
+	}
+
+	if resp := get("8.8.8.8"); resp.Backend == CacheBackend || service.calls != 1 {
+		t.Errorf("first Get() must miss, calls = %d", service.calls)
+	}
+
+	if resp := get("8.8.8.8"); resp.Backend != CacheBackend || service.calls != 1 {
+		t.Errorf("second Get() must hit, calls = %d", service.calls)
+	}
+
+	got, resp, _ := cache.Get(ctx, OptionIPAddress("8.8.8.8"))
+	if got.Domains[0] != "dns.google" {
+		t.Errorf("cached response modified by caller: %v", got.Domains)
+	}
+
+	if string(resp.Body) != "{}" {
+		t.Errorf("cached body modified by caller: %s", resp.Body)
+	}
+
+	get("1.1.1.1")
+	get("9.9.9.9")
+
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+
+	calls := service.calls
+	if get("8.8.8.8"); service.calls != calls+1 {
+		t.Errorf("least recently used response must be evicted")
+	}
+
+	now = now.Add(time.Minute)
+
+	calls = service.calls
+	if get("8.8.8.8"); service.calls != calls+1 {
+		t.Errorf("expired response must not be served")
+	}
+
+	calls = service.calls
+	if peeked, ok := cache.Peek(OptionIPAddress("8.8.8.8")); !ok || peeked.IP != "8.8.8.8" || service.calls != calls {
+		t.Errorf("Peek() = %v, %v, calls = %d, want the cached response", peeked, ok, service.calls-calls)
+	}
+
+	if _, ok := cache.Peek(OptionIPAddress("4.4.4.4")); ok || service.calls != calls {
+		t.Errorf("Peek() of the missing response = %v, calls = %d", ok, service.calls-calls)
+	}
+
+	cache.Purge()
+
+	if cache.Len() != 0 {
+		t.Errorf("Len() = %d after Purge(), want 0", cache.Len())
+	}
+}
+
+// TestCacheSave tests saving and loading cached responses.
+func TestCacheSave(t *testing.T) {
+	ctx := context.Background()
+	service := &stubService{resp: &GeoIPResponse{IP: "8.8.8.8", Domains: []string{"dns.google"}}}
+
+	now := time.Now()
+	cache := NewCache(service, CacheParams{TTL: time.Minute})
+	cache.now = func() time.Time { return now }
+
+	for _, ip := range []string{"8.8.8.8", "8.8.4.4"} {
+		if _, _, err := cache.Get(ctx, OptionIPAddress(ip)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(30 * time.Second)
+
+	if _, _, err := cache.Get(ctx, OptionIPAddress("1.1.1.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := cache.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewCache(service, CacheParams{MaxEntries: 2})
+	loaded.now = func() time.Time { return now.Add(40 * time.Second) }
+
+	if err := loaded.Load(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	// the responses cached first have expired, the last one is kept
+	if loaded.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", loaded.Len())
+	}
+
+	calls := service.calls
+
+	geoipResp, resp, err := loaded.Get(ctx, OptionIPAddress("1.1.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if service.calls != calls || resp.Backend != CacheBackend || geoipResp.Domains[0] != "dns.google" {
+		t.Errorf("Get() = %+v, %+v, want the loaded response", geoipResp, resp)
+	}
+
+	err = loaded.Load(strings.NewReader("not json"))
+	checkErr(t, err, "cannot load cache: invalid character 'o' in literal null (expecting 'u')")
+}
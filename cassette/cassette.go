@@ -0,0 +1,306 @@
+// Package cassette records HTTP interactions to JSON files and replays them for deterministic tests.
+//
+// Recorder is an http.RoundTripper, so it plugs into simplegeoip.ClientParams.HTTPClient:
+//
+//	rec, err := cassette.New("testdata/lookup.json", cassette.ModeReplay, nil)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer rec.Stop()
+//
+//	client := simplegeoip.NewClient(apiKey, simplegeoip.ClientParams{HTTPClient: rec.Client()})
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Mode is the Recorder mode.
+type Mode int
+
+const (
+	// ModeReplay answers requests with the recorded responses without network access.
+	ModeReplay Mode = iota
+
+	// ModeRecord sends requests to the real transport and records the interactions.
+	ModeRecord
+)
+
+// redacted replaces the values of sensitive query parameters.
+const redacted = "REDACTED"
+
+// sensitiveParams are the query parameters never written to cassettes.
+var sensitiveParams = []string{"apiKey"}
+
+// Cassette is the list of recorded interactions stored in a file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and response pair.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the recorded request. Sensitive query parameters are redacted.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+}
+
+// Response is the recorded response.
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+
+	// BodyError is the error that occurred while reading the body, it's returned again on replay
+	BodyError string `json:"bodyError,omitempty"`
+}
+
+// Recorder is the http.RoundTripper recording or replaying HTTP interactions.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+
+	mu        sync.Mutex
+	cassette  Cassette
+	used      []bool
+	unmatched []string
+}
+
+var _ http.RoundTripper = &Recorder{}
+
+// New creates Recorder for the cassette file. In ModeReplay the file must exist.
+// The transport is used in ModeRecord only. If it's nil then http.DefaultTransport is used.
+func New(path string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: transport,
+	}
+
+	if mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read cassette: %w", err)
+		}
+
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			return nil, fmt.Errorf("cannot parse cassette: %w", err)
+		}
+
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+
+	return r, nil
+}
+
+// Client returns http.Client using the recorder as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Stop writes the cassette in ModeRecord.
+// In ModeReplay it returns an error if some requests had no recorded interactions.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == ModeReplay {
+		if len(r.unmatched) > 0 {
+			return fmt.Errorf("cassette %s: unmatched requests: %s", r.path, strings.Join(r.unmatched, ", "))
+		}
+
+		return nil
+	}
+
+	var data bytes.Buffer
+
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(r.cassette); err != nil {
+		return fmt.Errorf("cannot encode cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("cannot write cassette: %w", err)
+	}
+
+	if err := os.WriteFile(r.path, data.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("cannot write cassette: %w", err)
+	}
+
+	return nil
+}
+
+// RoundTrip records or replays the interaction.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode == ModeReplay {
+		return r.replay(req)
+	}
+
+	return r.record(req)
+}
+
+// record sends the request and records the interaction.
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, bodyErr := io.ReadAll(resp.Body)
+	if err := resp.Body.Close(); err != nil && bodyErr == nil {
+		bodyErr = err
+	}
+
+	recorded := Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       string(body),
+	}
+
+	recorded.Header.Del("Date")
+
+	if bodyErr != nil {
+		recorded.BodyError = bodyErr.Error()
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request:  newRequest(req),
+		Response: recorded,
+	})
+	r.mu.Unlock()
+
+	return recorded.httpResponse(req), nil
+}
+
+// replay finds the interaction matching the request by method, path and normalized query.
+// Unused interactions are preferred, so repeated requests are answered in the recorded order.
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	want := newRequest(req)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := -1
+
+	for i, interaction := range r.cassette.Interactions {
+		if interaction.Request != want {
+			continue
+		}
+
+		match = i
+
+		if !r.used[i] {
+			break
+		}
+	}
+
+	if match == -1 {
+		unmatched := want.String()
+		r.unmatched = append(r.unmatched, unmatched)
+
+		return nil, fmt.Errorf("cassette %s: no recorded interaction for %s", r.path, unmatched)
+	}
+
+	r.used[match] = true
+
+	return r.cassette.Interactions[match].Response.httpResponse(req), nil
+}
+
+// String returns the request as a string.
+func (r Request) String() string {
+	if r.Query == "" {
+		return r.Method + " " + r.Path
+	}
+
+	return r.Method + " " + r.Path + "?" + r.Query
+}
+
+// newRequest returns the recorded form of the request.
+func newRequest(req *http.Request) Request {
+	return Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  normalizeQuery(req.URL.RawQuery),
+	}
+}
+
+// normalizeQuery sorts the query parameters and redacts the sensitive ones.
+func normalizeQuery(rawQuery string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+
+	for _, name := range sensitiveParams {
+		if _, ok := query[name]; ok {
+			query.Set(name, redacted)
+		}
+	}
+
+	return query.Encode()
+}
+
+// httpResponse creates http.Response for the request from the recorded response.
+func (r Response) httpResponse(req *http.Request) *http.Response {
+	var body io.Reader = strings.NewReader(r.Body)
+
+	if r.BodyError != "" {
+		err := errors.New(r.BodyError)
+		if r.BodyError == io.ErrUnexpectedEOF.Error() {
+			err = io.ErrUnexpectedEOF
+		}
+
+		body = io.MultiReader(body, &errReader{err: err})
+	}
+
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(body),
+		ContentLength: -1,
+		Request:       req,
+	}
+}
+
+// errReader is the reader always failing with the error.
+type errReader struct {
+	err error
+}
+
+// Read returns the error.
+func (e *errReader) Read([]byte) (int, error) {
+	return 0, e.err
+}
@@ -0,0 +1,136 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestRecordReplay tests recording the interactions and replaying them.
+func TestRecordReplay(t *testing.T) {
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ip":"` + req.URL.Query().Get("ipAddress") + `","n":` + strconv.Itoa(calls) + `}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassettes", "test.json")
+
+	rec, err := New(path, ModeRecord, server.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(client *http.Client, query string) (string, error) {
+		t.Helper()
+
+		resp, err := client.Get(server.URL + "/api/v1?" + query)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+
+		return string(body), err
+	}
+
+	for _, query := range []string{
+		"apiKey=secret&ipAddress=8.8.8.8",
+		"apiKey=secret&ipAddress=8.8.8.8",
+		"apiKey=secret&ipAddress=1.1.1.1",
+	} {
+		if _, err := get(rec.Client(), query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("API key is not redacted: %s", data)
+	}
+
+	rec, err = New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "first of repeated requests",
+			query: "ipAddress=8.8.8.8&apiKey=other",
+			want:  `{"ip":"8.8.8.8","n":1}`,
+		},
+		{
+			name:  "second of repeated requests",
+			query: "apiKey=other&ipAddress=8.8.8.8",
+			want:  `{"ip":"8.8.8.8","n":2}`,
+		},
+		{
+			name:  "repeated more than recorded",
+			query: "apiKey=other&ipAddress=8.8.8.8",
+			want:  `{"ip":"8.8.8.8","n":2}`,
+		},
+		{
+			name:  "other request",
+			query: "apiKey=other&ipAddress=1.1.1.1",
+			want:  `{"ip":"1.1.1.1","n":3}`,
+		},
+		{
+			name:    "unmatched request",
+			query:   "apiKey=other&ipAddress=9.9.9.9",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := get(rec.Client(), tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Get() got = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	want := "cassette " + path + ": unmatched requests: GET /api/v1?apiKey=REDACTED&ipAddress=9.9.9.9"
+	if err := rec.Stop(); err == nil || err.Error() != want {
+		t.Errorf("Stop() error = %v, want %v", err, want)
+	}
+
+	if calls != 3 {
+		t.Errorf("server called %d times, want 3", calls)
+	}
+}
+
+// TestReplayMissingCassette tests that replaying requires the cassette file.
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "cannot read cassette: ") {
+		t.Errorf("New() error = %v", err)
+	}
+}
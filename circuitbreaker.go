@@ -0,0 +1,334 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBreakerWindow is the default rolling window of CircuitBreaker.
+	defaultBreakerWindow = time.Minute
+
+	// defaultBreakerMinRequests is the default minimum number of requests in the window to open CircuitBreaker.
+	defaultBreakerMinRequests = 10
+
+	// defaultBreakerFailureRatio is the default ratio of failed requests opening CircuitBreaker.
+	defaultBreakerFailureRatio = 0.5
+
+	// defaultBreakerOpenTimeout is the default time CircuitBreaker stays open.
+	defaultBreakerOpenTimeout = 30 * time.Second
+
+	// defaultBreakerHalfOpenRequests is the default number of trial requests in the half-open state.
+	defaultBreakerHalfOpenRequests = 1
+
+	// breakerBuckets is the number of buckets the rolling window is split to.
+	breakerBuckets = 10
+)
+
+// ErrCircuitOpen is returned without calling the API when the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of CircuitBreaker.
+type CircuitState int
+
+// States of CircuitBreaker.
+const (
+	// CircuitClosed lets all requests through and counts failures
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects all requests with ErrCircuitOpen
+	CircuitOpen
+
+	// CircuitHalfOpen lets a few trial requests through to check if the API has recovered
+	CircuitHalfOpen
+)
+
+// String returns the state name.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// CircuitBreakerParams is used to create CircuitBreaker. None of parameters are mandatory.
+type CircuitBreakerParams struct {
+	// Window is the rolling window failures are counted in. Default: 1 minute
+	Window time.Duration
+
+	// MinRequests is the minimum number of requests in the window to open the circuit. Default: 10
+	MinRequests int
+
+	// FailureRatio is the ratio of failed requests in the window opening the circuit. Default: 0.5
+	FailureRatio float64
+
+	// OpenTimeout is the time the circuit stays open before trial requests are let through. Default: 30 seconds
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of successful trial requests closing the circuit. Default: 1
+	HalfOpenRequests int
+
+	// IsFailure reports whether the request has failed. Default: IsCircuitFailure
+	IsFailure func(resp *Response, err error) bool
+
+	// OnStateChange is called on every state change by the request causing it, so it must not block
+	OnStateChange func(from, to CircuitState)
+}
+
+// CircuitBreaker fails requests fast with ErrCircuitOpen when the API is failing.
+// It's used with ClientParams.CircuitBreaker.
+type CircuitBreaker struct {
+	params CircuitBreakerParams
+
+	mu       sync.Mutex
+	state    CircuitState
+	openedAt time.Time
+	buckets  [breakerBuckets]breakerBucket
+
+	// generation is incremented on every state change to ignore results of requests started before it
+	generation uint64
+
+	// trials is the number of trial requests let through, successes is the number of succeeded ones
+	trials    int
+	successes int
+
+	// changes are state changes to pass to OnStateChange once the lock is released
+	changes []stateChange
+
+	// now returns the current time, it's replaced in tests
+	now func() time.Time
+}
+
+// breakerBucket counts requests of the part of the rolling window.
+type breakerBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// NewCircuitBreaker creates CircuitBreaker with specified parameters.
+func NewCircuitBreaker(params CircuitBreakerParams) *CircuitBreaker {
+	if params.Window <= 0 {
+		params.Window = defaultBreakerWindow
+	}
+
+	if params.MinRequests <= 0 {
+		params.MinRequests = defaultBreakerMinRequests
+	}
+
+	if params.FailureRatio <= 0 {
+		params.FailureRatio = defaultBreakerFailureRatio
+	}
+
+	if params.OpenTimeout <= 0 {
+		params.OpenTimeout = defaultBreakerOpenTimeout
+	}
+
+	if params.HalfOpenRequests <= 0 {
+		params.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+
+	if params.IsFailure == nil {
+		params.IsFailure = IsCircuitFailure
+	}
+
+	return &CircuitBreaker{
+		params: params,
+		now:    time.Now,
+	}
+}
+
+// IsCircuitFailure reports whether the request failure means the API is degraded:
+// network errors, timeouts, rate limiting and server errors. Canceled requests are not failures.
+func IsCircuitFailure(resp *Response, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if resp != nil && resp.Response != nil {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+	}
+
+	return err != nil
+}
+
+// State returns the current state.
+func (b *CircuitBreaker) State() CircuitState {
+	defer b.notify()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, _ := b.currentState(b.now())
+
+	return state
+}
+
+// interceptor returns the interceptor rejecting calls when the circuit is open.
+func (b *CircuitBreaker) interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			generation, err := b.allow()
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := next(ctx, call)
+
+			b.record(generation, b.params.IsFailure(resp, err))
+
+			return resp, err
+		}
+	}
+}
+
+// stateChange is the pending state change notification.
+type stateChange struct {
+	from, to CircuitState
+}
+
+// notify calls OnStateChange with the pending state changes. It's called without the lock held.
+func (b *CircuitBreaker) notify() {
+	b.mu.Lock()
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if b.params.OnStateChange == nil {
+		return
+	}
+
+	for _, change := range changes {
+		b.params.OnStateChange(change.from, change.to)
+	}
+}
+
+// allow returns the generation of the request or ErrCircuitOpen if the request is rejected.
+func (b *CircuitBreaker) allow() (uint64, error) {
+	defer b.notify()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, generation := b.currentState(b.now())
+
+	switch state {
+	case CircuitOpen:
+		return generation, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.trials >= b.params.HalfOpenRequests {
+			return generation, ErrCircuitOpen
+		}
+
+		b.trials++
+	}
+
+	return generation, nil
+}
+
+// record counts the result of the request started in the generation.
+func (b *CircuitBreaker) record(generation uint64, failed bool) {
+	defer b.notify()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	state, current := b.currentState(now)
+
+	if generation != current {
+		return
+	}
+
+	switch state {
+	case CircuitClosed:
+		bucket := b.bucket(now)
+		if failed {
+			bucket.failures++
+		} else {
+			bucket.successes++
+		}
+
+		successes, failures := b.counts(now)
+		total := successes + failures
+
+		if total >= b.params.MinRequests && float64(failures) >= b.params.FailureRatio*float64(total) {
+			b.setState(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			b.setState(CircuitOpen, now)
+
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.params.HalfOpenRequests {
+			b.setState(CircuitClosed, now)
+		}
+	}
+}
+
+// currentState returns the state and the generation switching from open to half-open after OpenTimeout.
+func (b *CircuitBreaker) currentState(now time.Time) (CircuitState, uint64) {
+	if b.state == CircuitOpen && !now.Before(b.openedAt.Add(b.params.OpenTimeout)) {
+		b.setState(CircuitHalfOpen, now)
+	}
+
+	return b.state, b.generation
+}
+
+// setState switches to the state resetting the counters.
+func (b *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	b.changes = append(b.changes, stateChange{from: b.state, to: state})
+
+	b.state = state
+	b.generation++
+	b.trials = 0
+	b.successes = 0
+	b.buckets = [breakerBuckets]breakerBucket{}
+
+	if state == CircuitOpen {
+		b.openedAt = now
+	}
+}
+
+// bucket returns the bucket of the rolling window for the time resetting it if it's outdated.
+func (b *CircuitBreaker) bucket(now time.Time) *breakerBucket {
+	width := b.params.Window / breakerBuckets
+	if width <= 0 {
+		width = 1
+	}
+
+	slot := now.UnixNano() / int64(width)
+	start := time.Unix(0, slot*int64(width))
+
+	bucket := &b.buckets[slot%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+
+	return bucket
+}
+
+// counts returns the number of succeeded and failed requests in the rolling window.
+func (b *CircuitBreaker) counts(now time.Time) (successes, failures int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.params.Window {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+
+	return successes, failures
+}
@@ -0,0 +1,255 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker tests state changes of the circuit breaker around the client.
+func TestCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+
+	breaker := NewCircuitBreaker(CircuitBreakerParams{
+		Window:       time.Minute,
+		MinRequests:  4,
+		FailureRatio: 0.5,
+		OpenTimeout:  10 * time.Second,
+		OnStateChange: func(from, to CircuitState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	})
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker.now = func() time.Time {
+		return now
+	}
+
+	client := NewClient(apiKey, ClientParams{
+		HTTPClient:     server.Client(),
+		GeoipBaseURL:   apiURL,
+		CircuitBreaker: breaker,
+	})
+
+	ctx := context.Background()
+
+	// one failure of four requests keeps the circuit closed
+	failing.Store(true)
+
+	if _, err := client.GetRaw(ctx); err == nil {
+		t.Fatal("GetRaw() expected error")
+	}
+
+	failing.Store(false)
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetRaw(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("State() = %s, want closed", state)
+	}
+
+	// the requests outside the rolling window are forgotten, so three failures of four open the circuit
+	now = now.Add(2 * time.Minute)
+	failing.Store(true)
+
+	if _, err := client.GetRaw(ctx); err == nil {
+		t.Fatal("GetRaw() expected error")
+	}
+
+	failing.Store(false)
+
+	if _, err := client.GetRaw(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	failing.Store(true)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetRaw(ctx); err == nil {
+			t.Fatal("GetRaw() expected error")
+		}
+	}
+
+	if state := breaker.State(); state != CircuitOpen {
+		t.Fatalf("State() = %s, want open", state)
+	}
+
+	sent := requests.Load()
+
+	if _, _, err := client.Get(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Get() error = %v, want ErrCircuitOpen", err)
+	}
+
+	if requests.Load() != sent {
+		t.Error("request is sent while the circuit is open")
+	}
+
+	// the failed trial request opens the circuit again
+	now = now.Add(10 * time.Second)
+
+	if _, err := client.GetRaw(ctx); errors.Is(err, ErrCircuitOpen) || err == nil {
+		t.Fatalf("GetRaw() error = %v, want API error", err)
+	}
+
+	if state := breaker.State(); state != CircuitOpen {
+		t.Fatalf("State() = %s, want open", state)
+	}
+
+	// the successful trial request closes the circuit
+	now = now.Add(10 * time.Second)
+	failing.Store(false)
+
+	if _, err := client.GetRaw(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("State() = %s, want closed", state)
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("state changes = %v, want %v", changes, want)
+
+			break
+		}
+	}
+}
+
+// TestCircuitBreakerHalfOpen tests that only HalfOpenRequests trial requests are let through.
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	breaker := NewCircuitBreaker(CircuitBreakerParams{MinRequests: 1, HalfOpenRequests: 2})
+
+	now := time.Now()
+	breaker.now = func() time.Time {
+		return now
+	}
+
+	generation, err := breaker.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breaker.record(generation, true)
+
+	now = now.Add(defaultBreakerOpenTimeout)
+
+	var generations []uint64
+
+	for i := 0; i < 2; i++ {
+		generation, err := breaker.allow()
+		if err != nil {
+			t.Fatalf("trial %d: %v", i, err)
+		}
+
+		generations = append(generations, generation)
+	}
+
+	if _, err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow() error = %v, want ErrCircuitOpen", err)
+	}
+
+	breaker.record(generations[0], false)
+
+	if state := breaker.State(); state != CircuitHalfOpen {
+		t.Fatalf("State() = %s, want half-open", state)
+	}
+
+	breaker.record(generations[1], false)
+
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("State() = %s, want closed", state)
+	}
+
+	// results of requests started before the state change are ignored
+	breaker.record(generations[0], true)
+
+	if state := breaker.State(); state != CircuitClosed {
+		t.Fatalf("State() = %s, want closed", state)
+	}
+}
+
+// TestIsCircuitFailure tests which results count as failures.
+func TestIsCircuitFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *Response
+		err  error
+		want bool
+	}{
+		{
+			name: "success",
+			resp: &Response{Response: &http.Response{StatusCode: http.StatusOK}},
+			want: false,
+		},
+		{
+			name: "client error",
+			resp: &Response{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}},
+			want: false,
+		},
+		{
+			name: "rate limited",
+			resp: &Response{Response: &http.Response{StatusCode: http.StatusTooManyRequests}},
+			want: true,
+		},
+		{
+			name: "server error",
+			resp: &Response{Response: &http.Response{StatusCode: http.StatusBadGateway}},
+			want: true,
+		},
+		{
+			name: "timeout",
+			err:  context.DeadlineExceeded,
+			want: true,
+		},
+		{
+			name: "canceled",
+			err:  context.Canceled,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCircuitFailure(tt.resp, tt.err); got != tt.want {
+				t.Errorf("IsCircuitFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
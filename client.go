@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -27,6 +28,44 @@ type ClientParams struct {
 
 	// GeoipBaseURL is the endpoint for 'IP Geolocation API' service
 	GeoipBaseURL *url.URL
+
+	// Interceptors wrap every API call. The first interceptor is the outermost one
+	Interceptors []Interceptor
+
+	// Logger logs API calls and decode failures. If it's nil then nothing is logged
+	Logger *slog.Logger
+
+	// Tracer starts spans around Get and GetRaw calls. If it's nil then nothing is traced
+	Tracer Tracer
+
+	// MetricsSink receives request metrics in addition to the built-in Metrics served by MetricsHandler
+	MetricsSink MetricsSink
+
+	// CollectTiming enables the timing breakdown of requests in Response.Timing, logs and metrics
+	CollectTiming bool
+
+	// CircuitBreaker fails requests fast with ErrCircuitOpen when the API is failing. If it's nil then
+	// all requests are sent
+	CircuitBreaker *CircuitBreaker
+
+	// Hedging enables sending the second request if the first one is slow. If it's nil then requests are not hedged
+	Hedging *HedgingParams
+
+	// Retry enables retries of requests failed with 429, 5xx or network errors. If it's nil then requests are
+	// not retried
+	Retry *RetryParams
+
+	// RateLimiter limits the rate of HTTP requests, retries and hedged requests included. If it's nil then
+	// the rate is not limited
+	RateLimiter *RateLimiter
+
+	// MaxBodySize is the maximum size of the response body. Larger responses fail with ErrBodyTooLarge.
+	// Default: 1 MiB
+	MaxBodySize int64
+
+	// RetainBody keeps the body of Get responses in Response.Body. Otherwise Get decodes the body while it's read
+	// without buffering it. GetRaw always returns the body
+	RetainBody bool
 }
 
 // NewBasicClient creates Client with recommended parameters.
@@ -55,9 +94,58 @@ func NewClient(apiKey string, params ClientParams) *Client {
 		client:    httpClient,
 		userAgent: userAgent,
 		apiKey:    apiKey,
+		logger:    params.Logger,
+		tracer:    params.Tracer,
+		metrics:   NewMetrics(),
+
+		collectTiming: params.CollectTiming,
+		maxBodySize:   params.MaxBodySize,
+		retainBody:    params.RetainBody,
+	}
+
+	if client.maxBodySize <= 0 {
+		client.maxBodySize = defaultMaxBodySize
 	}
 
-	client.GeoipService = &geoipServiceOp{client: client, baseURL: apiBaseURL}
+	client.sink = client.metrics
+	if params.MetricsSink != nil {
+		client.sink = multiSink{client.metrics, params.MetricsSink}
+	}
+
+	interceptors := make([]Interceptor, 0, len(params.Interceptors)+6)
+	if params.Logger != nil {
+		interceptors = append(interceptors, interceptorSlog(params.Logger))
+	}
+
+	// metrics are recorded inside the interceptors to count every HTTP request made by them
+	interceptors = append(interceptors, params.Interceptors...)
+
+	// every retry is hedged on its own and counted in metrics
+	if params.Retry != nil {
+		interceptors = append(interceptors, newRetrier(*params.Retry, client.sink, params.Logger).interceptor())
+	}
+
+	// both hedged attempts are counted in metrics
+	if params.Hedging != nil {
+		interceptors = append(interceptors, newHedger(*params.Hedging, client.sink).interceptor())
+	}
+
+	// every retry and hedged request waits for the rate limiter, the wait isn't included in the request duration
+	if params.RateLimiter != nil {
+		interceptors = append(interceptors, params.RateLimiter.Interceptor())
+	}
+
+	interceptors = append(interceptors, interceptorMetrics(client.sink))
+
+	// the circuit breaker is innermost to fail fast without sending requests, rejections are counted in metrics
+	if params.CircuitBreaker != nil {
+		interceptors = append(interceptors, params.CircuitBreaker.interceptor())
+	}
+
+	client.handler = chain(client.send, interceptors)
+
+	client.geoip = &geoipServiceOp{client: client, baseURL: apiBaseURL}
+	client.GeoipService = client.geoip
 
 	return client
 }
@@ -69,10 +157,44 @@ type Client struct {
 	userAgent string
 	apiKey    string
 
+	// handler is the chain of interceptors ending with send
+	handler Handler
+
+	logger *slog.Logger
+	tracer Tracer
+
+	// metrics are the built-in metrics, sink also includes ClientParams.MetricsSink
+	metrics *Metrics
+	sink    MetricsSink
+
+	collectTiming bool
+	maxBodySize   int64
+	retainBody    bool
+
+	// geoip is the API implementation of GeoipService
+	geoip *geoipServiceOp
+
 	// GeoipService is an interface for IP Geolocation API
 	GeoipService
 }
 
+// GetInto parses IP Geolocation API response into dst reusing its memory. It allocates less than Get
+// when the caller reuses dst between calls.
+func (c *Client) GetInto(ctx context.Context, dst *GeoIPResponse, opts ...Option) (*Response, error) {
+	return c.geoip.GetInto(ctx, dst, opts...)
+}
+
+// MetricsHandler returns the handler serving the client metrics in Prometheus text format.
+func (c *Client) MetricsHandler() http.Handler {
+	return c.metrics.Handler()
+}
+
+// Metrics returns the sink the client records metrics to. Pass it to CacheParams.MetricsSink
+// to serve cache metrics with MetricsHandler too.
+func (c *Client) Metrics() MetricsSink {
+	return c.sink
+}
+
 // NewRequest creates a basic API request.
 func (c *Client) NewRequest(method string, u *url.URL, body io.Reader) (*http.Request, error) {
 	var err error
@@ -93,6 +215,15 @@ func (c *Client) NewRequest(method string, u *url.URL, body io.Reader) (*http.Re
 
 // Do sends the API request and returns the API response.
 func (c *Client) Do(ctx context.Context, req *http.Request, v io.Writer) (response *http.Response, err error) {
+	return c.do(ctx, req, func(body io.Reader) error {
+		_, err := io.Copy(v, body)
+
+		return err
+	})
+}
+
+// do sends the API request and reads the response body with read.
+func (c *Client) do(ctx context.Context, req *http.Request, read func(body io.Reader) error) (response *http.Response, err error) {
 	req = req.WithContext(ctx)
 
 	resp, err := c.client.Do(req)
@@ -106,7 +237,7 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v io.Writer) (respon
 		}
 	}()
 
-	_, err = io.Copy(v, resp.Body)
+	err = read(resp.Body)
 	if err != nil {
 		return resp, fmt.Errorf("cannot read response: %w", err)
 	}
@@ -2,13 +2,20 @@ package simplegeoip
 
 import (
 	"context"
+	"flag"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strconv"
 	"testing"
+
+	"github.com/whois-api-llc/go-simple-geoip/cassette"
 )
 
+// record makes tests record their cassettes from the dummy server instead of replaying them.
+var record = flag.Bool("record", false, "record HTTP cassettes from the dummy server")
+
 const (
 	pathGeoipResponseOK         = "/Geoip/ok"
 	pathGeoipResponseError      = "/Geoip/error"
@@ -54,18 +61,54 @@ func dummyServer(resp, respUnparsable string, respErr string) *httptest.Server {
 	return server
 }
 
-// newAPI returns new IP Geolocation API client for testing.
-func newAPI(apiServer *httptest.Server, link string) *Client {
-	apiURL, err := url.Parse(apiServer.URL)
+// newRecorder returns the recorder of the test cassette and the API URL.
+// The dummy server is started only when recording.
+func newRecorder(t *testing.T, server func() *httptest.Server) (*cassette.Recorder, *url.URL) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "cassettes", t.Name()+".json")
+
+	mode := cassette.ModeReplay
+	apiURL := "http://geoip.test"
+
+	var transport http.RoundTripper
+
+	if *record {
+		apiServer := server()
+		t.Cleanup(apiServer.Close)
+
+		mode = cassette.ModeRecord
+		apiURL = apiServer.URL
+		transport = apiServer.Client().Transport
+	}
+
+	rec, err := cassette.New(path, mode, transport)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 
-	apiURL.Path = link
+	t.Cleanup(func() {
+		if err := rec.Stop(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rec, u
+}
+
+// newAPI returns new IP Geolocation API client for testing.
+func newAPI(rec *cassette.Recorder, apiURL *url.URL, link string) *Client {
+	u := *apiURL
+	u.Path = link
 
 	params := ClientParams{
-		HTTPClient:   apiServer.Client(),
-		GeoipBaseURL: apiURL,
+		HTTPClient:   rec.Client(),
+		GeoipBaseURL: &u,
 	}
 
 	return NewClient(apiKey, params)
@@ -89,8 +132,9 @@ func TestGeoipGet(t *testing.T) {
 
 	const errResp = `{"code":499,"error":"test error message"}`
 
-	server := dummyServer(resp, respUnparsable, errResp)
-	defer server.Close()
+	rec, apiURL := newRecorder(t, func() *httptest.Server {
+		return dummyServer(resp, respUnparsable, errResp)
+	})
 
 	type args struct {
 		ctx     context.Context
@@ -167,7 +211,7 @@ func TestGeoipGet(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			api := newAPI(server, tt.path)
+			api := newAPI(rec, apiURL, tt.path)
 
 			gotRec, _, err := api.Get(tt.args.ctx)
 			if (err != nil || tt.wantErr != "") && (err == nil || err.Error() != tt.wantErr) {
@@ -207,8 +251,9 @@ func TestGeoipGetRaw(t *testing.T) {
 
 	const errResp = `{"code":499,"error":"test error message"}`
 
-	server := dummyServer(resp, respUnparsable, errResp)
-	defer server.Close()
+	rec, apiURL := newRecorder(t, func() *httptest.Server {
+		return dummyServer(resp, respUnparsable, errResp)
+	})
 
 	type args struct {
 		ctx     context.Context
@@ -278,7 +323,7 @@ func TestGeoipGetRaw(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			api := newAPI(server, tt.path)
+			api := newAPI(rec, apiURL, tt.path)
 
 			resp, err := api.GetRaw(tt.args.ctx)
 			if (err != nil || tt.wantErr != "") && (err == nil || err.Error() != tt.wantErr) {
@@ -0,0 +1,98 @@
+package simplegeoip
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client sending the request. Forwarding headers are used only if
+// the peer is one of the trusted proxies: the Forwarded header (RFC 7239), X-Forwarded-For and X-Real-IP,
+// in that order. The forwarding chain is walked from the nearest hop, and the first address which is not
+// a trusted proxy is the client. The returned address is invalid if the chain contains unparsable values,
+// e.g. obfuscated identifiers.
+func ClientIP(req *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	peer := parseHost(req.RemoteAddr)
+	if !peer.IsValid() || !isTrusted(peer, trustedProxies) {
+		return peer
+	}
+
+	var chain []string
+
+	switch {
+	case len(req.Header.Values("Forwarded")) > 0:
+		chain = forwardedFor(req.Header.Values("Forwarded"))
+	case len(req.Header.Values("X-Forwarded-For")) > 0:
+		for _, value := range req.Header.Values("X-Forwarded-For") {
+			chain = append(chain, strings.Split(value, ",")...)
+		}
+	case req.Header.Get("X-Real-IP") != "":
+		chain = []string{req.Header.Get("X-Real-IP")}
+	}
+
+	client := peer
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := parseHost(strings.TrimSpace(chain[i]))
+		if !hop.IsValid() {
+			return netip.Addr{}
+		}
+
+		client = hop
+		if !isTrusted(hop, trustedProxies) {
+			break
+		}
+	}
+
+	return client
+}
+
+// forwardedFor returns the "for" parameters of the Forwarded header elements.
+func forwardedFor(values []string) []string {
+	var chain []string
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			forValue := ""
+
+			for _, pair := range strings.Split(element, ";") {
+				name, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					forValue = strings.Trim(v, `"`)
+				}
+			}
+
+			// the element without "for" is the unknown hop
+			chain = append(chain, forValue)
+		}
+	}
+
+	return chain
+}
+
+// parseHost parses the IP address with an optional port, IPv6 addresses with the port are in brackets.
+func parseHost(host string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(host); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addr.Unmap()
+}
+
+// isTrusted reports whether the address belongs to one of the trusted networks.
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
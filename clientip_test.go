@@ -0,0 +1,98 @@
+package simplegeoip
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+// TestClientIP tests the client IP detection behind trusted proxies.
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "8.8.8.8:1234",
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "untrusted peer",
+			remoteAddr: "8.8.8.8:1234",
+			header:     http.Header{"X-Forwarded-For": {"1.1.1.1"}},
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "x-forwarded-for",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"9.9.9.9, 1.1.1.1", "10.0.0.2"}},
+			want:       "1.1.1.1",
+		},
+		{
+			name:       "all trusted",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "forwarded",
+			remoteAddr: "[2001:db8::1]:443",
+			header: http.Header{
+				"Forwarded":       {`for=9.9.9.9, for="[2606:4700::1111]:4711";proto=https`, `For="10.0.0.2:8080"`},
+				"X-Forwarded-For": {"1.1.1.1"},
+			},
+			want: "2606:4700::1111",
+		},
+		{
+			name:       "forwarded unknown",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"for=unknown, for=10.0.0.2"}},
+			want:       "invalid IP",
+		},
+		{
+			name:       "forwarded without for",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"for=1.1.1.1, proto=https"}},
+			want:       "invalid IP",
+		},
+		{
+			name:       "x-real-ip",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Real-Ip": {"1.1.1.1"}},
+			want:       "1.1.1.1",
+		},
+		{
+			name:       "mapped IPv4",
+			remoteAddr: "[::ffff:8.8.8.8]:1234",
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "no port",
+			remoteAddr: "8.8.8.8",
+			want:       "8.8.8.8",
+		},
+		{
+			name:       "invalid remote address",
+			remoteAddr: "pipe",
+			want:       "invalid IP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{RemoteAddr: tt.remoteAddr, Header: tt.header}
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+
+			if got := ClientIP(req, trusted).String(); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// defaultQuotaPeriod is the quota period if it's not set for the caller.
+const defaultQuotaPeriod = 24 * time.Hour
+
+// Caller errors.
+var (
+	errUnknownToken  = errors.New("unknown token")
+	errQuotaExceeded = errors.New("quota exceeded")
+)
+
+// callersFile is the content of the tokens file, e.g.
+//
+//	{"callers": [{"name": "billing", "token": "...", "quota": 10000, "period": "24h"}]}
+type callersFile struct {
+	Callers []callerConfig `json:"callers"`
+}
+
+// callerConfig is the internal service allowed to use the proxy.
+type callerConfig struct {
+	// Name identifies the caller in logs and metrics
+	Name string `json:"name"`
+
+	// Token is the internal token passed instead of the API key
+	Token string `json:"token"`
+
+	// Quota is the number of lookups allowed in the period. If it's zero then lookups are not limited
+	Quota int `json:"quota"`
+
+	// Period is the quota period. Default: 24 hours
+	Period simplegeoip.Duration `json:"period"`
+}
+
+// caller is the caller with its quota usage in the current period.
+type caller struct {
+	callerConfig
+
+	periodStart time.Time
+	used        int
+}
+
+// callers keeps callers by token. It's safe for concurrent use.
+type callers struct {
+	mu      sync.Mutex
+	byToken map[string]*caller
+
+	// now returns the current time, it's replaced in tests
+	now func() time.Time
+}
+
+// loadCallers reads the tokens file.
+func loadCallers(path string) (*callers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tokens: %w", err)
+	}
+
+	var file callersFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cannot parse tokens %s: %w", path, err)
+	}
+
+	return newCallers(file.Callers)
+}
+
+// newCallers creates callers checking that names and tokens are set and tokens are unique.
+func newCallers(configs []callerConfig) (*callers, error) {
+	c := &callers{
+		byToken: make(map[string]*caller, len(configs)),
+		now:     time.Now,
+	}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Token == "" {
+			return nil, fmt.Errorf("caller %q must have the name and the token", config.Name)
+		}
+
+		if _, ok := c.byToken[config.Token]; ok {
+			return nil, fmt.Errorf("caller %q has the token of another caller", config.Name)
+		}
+
+		if config.Period <= 0 {
+			config.Period = simplegeoip.Duration(defaultQuotaPeriod)
+		}
+
+		c.byToken[config.Token] = &caller{callerConfig: config}
+	}
+
+	return c, nil
+}
+
+// take checks the caller's quota and counts the lookup against it if count is set. It returns the caller's name
+// and the remaining quota, which is -1 if the quota is not limited.
+func (c *callers) take(token string, count bool) (name string, remaining int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cl, ok := c.byToken[token]
+	if !ok {
+		return "", 0, errUnknownToken
+	}
+
+	if cl.Quota <= 0 {
+		return cl.Name, -1, nil
+	}
+
+	now := c.now()
+	if now.Sub(cl.periodStart) >= time.Duration(cl.Period) {
+		cl.periodStart = now
+		cl.used = 0
+	}
+
+	if cl.used >= cl.Quota {
+		return cl.Name, 0, errQuotaExceeded
+	}
+
+	if count {
+		cl.used++
+	}
+
+	return cl.Name, cl.Quota - cl.used, nil
+}
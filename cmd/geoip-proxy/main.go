@@ -0,0 +1,185 @@
+// Command geoip-proxy is the caching reverse proxy of IP Geolocation API shared by internal services.
+//
+// Usage:
+//
+//	geoip-proxy -tokens tokens.json [flags]
+//
+// The proxy serves the same query interface as the API: ipAddress, domain, email, outputFormat and reverseIp.
+// Callers pass their internal token as apiKey or as the bearer token, the real API key is added by the proxy.
+// JSON responses are kept in the cache shared by all callers, XML responses are passed through. Requests to
+// the API share one rate limit, and every caller has its own quota of lookups per period set in the tokens file:
+//
+//	{"callers": [{"name": "billing", "token": "...", "quota": 10000, "period": "24h"}]}
+//
+// The API key and other client settings are taken from the config profile and GEOIP_* environment variables,
+// see simplegeoip.LoadProfile. Metrics are served at /metrics in Prometheus text format.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stderr, os.Getenv); err != nil {
+		fmt.Fprintln(os.Stderr, "geoip-proxy:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// options are the command line options.
+type options struct {
+	listen     string
+	tokens     string
+	configPath string
+	profile    string
+	rps        float64
+	burst      int
+	cacheTTL   time.Duration
+	cacheSize  int
+}
+
+// run serves the proxy until ctx is done.
+func run(ctx context.Context, args []string, stderr io.Writer, getenv func(string) string) error {
+	var opts options
+
+	flags := flag.NewFlagSet("geoip-proxy", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.listen, "listen", ":8080", "address to listen on")
+	flags.StringVar(&opts.tokens, "tokens", "", "file with callers' tokens and quotas")
+	flags.StringVar(&opts.configPath, "config", "", "config file (default "+simplegeoip.DefaultConfigPath()+")")
+	flags.StringVar(&opts.profile, "profile", "", "config profile, overrides "+simplegeoip.EnvProfile)
+	flags.Float64Var(&opts.rps, "rps", 10, "requests per second to the API shared by all callers")
+	flags.IntVar(&opts.burst, "burst", 10, "requests to the API allowed at once")
+	flags.DurationVar(&opts.cacheTTL, "cache-ttl", time.Hour, "time to keep responses in the cache")
+	flags.IntVar(&opts.cacheSize, "cache-size", 100000, "maximum number of responses in the cache")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+
+		return err
+	}
+
+	if opts.tokens == "" {
+		return errors.New("-tokens is required")
+	}
+
+	handler, save, err := newHandler(opts, getenv)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              opts.listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	return save()
+}
+
+// newHandler creates the proxy handler with the metrics and health endpoints, save writes the cache
+// to the profile's cache path.
+func newHandler(opts options, getenv func(string) string) (handler http.Handler, save func() error, err error) {
+	cfg, err := simplegeoip.LoadConfig(opts.configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := opts.profile
+	if name == "" {
+		name = getenv(simplegeoip.EnvProfile)
+	}
+
+	profile, err := cfg.Select(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := profile.ApplyEnv(getenv); err != nil {
+		return nil, nil, err
+	}
+
+	if profile.APIKey == "" {
+		return nil, nil, fmt.Errorf("API key is not set, use %s or the config file", simplegeoip.EnvAPIKey)
+	}
+
+	callers, err := loadCallers(opts.tokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params, err := profile.ClientParams()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metrics := simplegeoip.NewMetrics()
+
+	limiter, err := simplegeoip.NewRateLimiter(simplegeoip.RateLimiterParams{
+		RequestsPerSecond: opts.rps,
+		Burst:             opts.burst,
+		MetricsSink:       metrics,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// bodies are kept to serve cached responses as returned by the API
+	params.RetainBody = true
+	params.MetricsSink = metrics
+	params.RateLimiter = limiter
+
+	cache, err := profile.NewCache(simplegeoip.NewClient(profile.APIKey, params), simplegeoip.CacheParams{
+		TTL:         opts.cacheTTL,
+		MaxEntries:  opts.cacheSize,
+		MetricsSink: metrics,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", &proxy{service: cache, callers: callers, sink: metrics})
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+
+	return mux, func() error { return profile.SaveCache(cache) }, nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// MetricProxyRequests is the name of the counter of proxy requests by caller and result.
+const MetricProxyRequests = "geoip_proxy_requests_total"
+
+// Results of proxy requests.
+const (
+	resultHit      = "hit"
+	resultMiss     = "miss"
+	resultError    = "error"
+	resultRejected = "rejected"
+)
+
+// proxy serves the IP Geolocation API query interface to internal callers. Callers pass their internal token
+// as apiKey or the bearer token, and the real API key is added by the client of the service.
+type proxy struct {
+	service simplegeoip.GeoipService
+	callers *callers
+	sink    simplegeoip.MetricsSink
+}
+
+// ServeHTTP handles the lookup.
+func (p *proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+
+		return
+	}
+
+	token := callerToken(req)
+	if token == "" {
+		p.record("", resultRejected)
+		writeError(w, http.StatusUnauthorized, "API key is required")
+
+		return
+	}
+
+	opts, outputFormat, queryErr := queryOptions(req.URL.Query())
+
+	// invalid queries are rejected without counting them against the quota
+	name, remaining, err := p.callers.take(token, queryErr == nil)
+
+	switch {
+	case errors.Is(err, errUnknownToken):
+		p.record("", resultRejected)
+		writeError(w, http.StatusForbidden, "Access restricted. Check the token.")
+
+		return
+	case errors.Is(err, errQuotaExceeded):
+		p.record(name, resultRejected)
+		writeError(w, http.StatusTooManyRequests, "Quota exceeded")
+
+		return
+	}
+
+	if queryErr != nil {
+		p.record(name, resultRejected)
+		writeError(w, http.StatusUnprocessableEntity, queryErr.Error())
+
+		return
+	}
+
+	if remaining >= 0 {
+		w.Header().Set("X-Quota-Remaining", strconv.Itoa(remaining))
+	}
+
+	if outputFormat == "XML" {
+		p.serveRaw(req.Context(), w, name, opts)
+
+		return
+	}
+
+	p.serveJSON(req.Context(), w, name, opts)
+}
+
+// serveJSON serves the cached JSON response.
+func (p *proxy) serveJSON(ctx context.Context, w http.ResponseWriter, name string, opts []simplegeoip.Option) {
+	geoipResp, resp, err := p.service.Get(ctx, opts...)
+	if err != nil {
+		p.record(name, resultError)
+		writeLookupError(w, err)
+
+		return
+	}
+
+	result := resultMiss
+	if resp != nil && resp.Backend == simplegeoip.CacheBackend {
+		result = resultHit
+	}
+
+	p.record(name, result)
+	w.Header().Set("X-Cache", strings.ToUpper(result))
+
+	var body []byte
+	if resp != nil {
+		body = resp.Body
+	}
+
+	if len(body) == 0 {
+		body, _ = json.Marshal(geoipResp)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// serveRaw serves the XML response, it's not cached.
+func (p *proxy) serveRaw(ctx context.Context, w http.ResponseWriter, name string, opts []simplegeoip.Option) {
+	resp, err := p.service.GetRaw(ctx, append(opts, simplegeoip.OptionOutputFormat("XML"))...)
+
+	var errResp simplegeoip.ErrorResponse
+
+	switch {
+	case errors.As(err, &errResp) && resp != nil && errResp.Response != nil:
+		// the API error is passed as is
+		p.record(name, resultError)
+		w.Header().Set("Content-Type", errResp.Response.Header.Get("Content-Type"))
+		w.WriteHeader(errResp.Response.StatusCode)
+		_, _ = w.Write(resp.Body)
+
+		return
+	case err != nil:
+		p.record(name, resultError)
+		writeLookupError(w, err)
+
+		return
+	}
+
+	p.record(name, resultMiss)
+	w.Header().Set("X-Cache", strings.ToUpper(resultMiss))
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(resp.Body)
+}
+
+// record counts the request of the caller.
+func (p *proxy) record(name, result string) {
+	p.sink.AddCounter(MetricProxyRequests, 1,
+		simplegeoip.Label{Name: "caller", Value: name}, simplegeoip.Label{Name: "result", Value: result})
+}
+
+// callerToken returns the token from the apiKey parameter or the Authorization header.
+func callerToken(req *http.Request) string {
+	if token := req.URL.Query().Get("apiKey"); token != "" {
+		return token
+	}
+
+	if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	return ""
+}
+
+// queryOptions returns the lookup options of the query parameters supported by the API and the output format.
+func queryOptions(query url.Values) ([]simplegeoip.Option, string, error) {
+	var opts []simplegeoip.Option
+
+	outputFormat := strings.ToUpper(query.Get("outputFormat"))
+	if outputFormat != "" && outputFormat != "JSON" && outputFormat != "XML" {
+		return nil, "", errors.New("Output format should be JSON or XML")
+	}
+
+	if ip := query.Get("ipAddress"); ip != "" {
+		if net.ParseIP(ip) == nil {
+			return nil, "", errors.New("Invalid IP address")
+		}
+
+		opts = append(opts, simplegeoip.OptionIPAddress(ip))
+	}
+
+	if domain := query.Get("domain"); domain != "" {
+		opts = append(opts, simplegeoip.OptionDomain(domain))
+	}
+
+	if email := query.Get("email"); email != "" {
+		opts = append(opts, simplegeoip.OptionEmail(email))
+	}
+
+	if reverseIP := query.Get("reverseIp"); reverseIP != "" {
+		value, err := strconv.Atoi(reverseIP)
+		if err != nil || value < 0 || value > 1 {
+			return nil, "", errors.New("reverseIp should be 0 or 1")
+		}
+
+		opts = append(opts, simplegeoip.OptionReverseIP(value))
+	}
+
+	// without the target the API looks up the IP address of the proxy rather than the caller's one
+	if query.Get("ipAddress") == "" && query.Get("domain") == "" && query.Get("email") == "" {
+		return nil, "", errors.New("ipAddress, domain or email is required")
+	}
+
+	return opts, outputFormat, nil
+}
+
+// writeLookupError writes the error of the failed lookup in the API error format.
+func writeLookupError(w http.ResponseWriter, err error) {
+	var errMsg *simplegeoip.ErrorMessage
+	if errors.As(err, &errMsg) && errMsg.Code != 0 {
+		writeError(w, errMsg.Code, errMsg.Message)
+
+		return
+	}
+
+	var errResp simplegeoip.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		writeError(w, errResp.Response.StatusCode, errResp.Error())
+
+		return
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "Upstream timeout")
+
+		return
+	}
+
+	writeError(w, http.StatusBadGateway, "Upstream request failed")
+}
+
+// writeError writes the API error response.
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(simplegeoip.ErrorMessage{Code: code, Message: message})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+	"github.com/whois-api-llc/go-simple-geoip/geoiptest"
+)
+
+// apiKey is the API key accepted by the test server.
+const apiKey = "real-key"
+
+// TestProxy tests authentication, quotas, caching and error responses of the proxy.
+func TestProxy(t *testing.T) {
+	service := geoiptest.NewService()
+	service.Set(geoiptest.IP("8.8.8.8"), &simplegeoip.GeoIPResponse{
+		IP:       "8.8.8.8",
+		Location: simplegeoip.Location{Country: "US", City: "Mountain View"},
+	})
+
+	upstream := geoiptest.NewServer(geoiptest.ServerParams{Service: service, APIKey: apiKey})
+	defer upstream.Close()
+
+	dir := t.TempDir()
+
+	tokens := filepath.Join(dir, "tokens.json")
+	if err := os.WriteFile(tokens, []byte(`{"callers": [
+		{"name": "billing", "token": "billing-token"},
+		{"name": "search", "token": "search-token", "quota": 2}
+	]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, save, err := newHandler(options{
+		tokens:     tokens,
+		configPath: config,
+		rps:        100,
+		burst:      1,
+		cacheTTL:   time.Minute,
+		cacheSize:  10,
+	}, func(key string) string {
+		return map[string]string{
+			simplegeoip.EnvAPIKey:    apiKey,
+			simplegeoip.EnvBaseURL:   upstream.URL,
+			simplegeoip.EnvCachePath: filepath.Join(dir, "cache.json"),
+		}[key]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		auth       string
+		wantStatus int
+		wantHeader map[string]string
+		wantBody   string
+	}{
+		{
+			name:       "miss",
+			query:      "apiKey=billing-token&ipAddress=8.8.8.8",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"X-Cache": "MISS", "Content-Type": "application/json"},
+			wantBody:   `"city":"Mountain View"`,
+		},
+		{
+			name:       "hit",
+			query:      "apiKey=billing-token&ipAddress=8.8.8.8",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"X-Cache": "HIT"},
+			wantBody:   `"city":"Mountain View"`,
+		},
+		{
+			name:       "bearer token",
+			query:      "ipAddress=8.8.8.8&outputFormat=json",
+			auth:       "Bearer search-token",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"X-Cache": "HIT", "X-Quota-Remaining": "1"},
+		},
+		{
+			name:       "invalid IP",
+			query:      "apiKey=search-token&ipAddress=8.8.8",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   `{"code":422,"error":"Invalid IP address"}`,
+		},
+		{
+			name:       "no target",
+			query:      "apiKey=search-token&reverseIp=0",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantBody:   "ipAddress, domain or email is required",
+		},
+		{
+			name:       "not found",
+			query:      "apiKey=search-token&ipAddress=1.1.1.1",
+			wantStatus: http.StatusNotFound,
+			wantHeader: map[string]string{"X-Quota-Remaining": "0"},
+			wantBody:   `{"code":404,"error":"record not found"}`,
+		},
+		{
+			name:       "quota exceeded",
+			query:      "apiKey=search-token&ipAddress=8.8.8.8",
+			wantStatus: http.StatusTooManyRequests,
+			wantBody:   "Quota exceeded",
+		},
+		{
+			name:       "xml",
+			query:      "apiKey=billing-token&ipAddress=8.8.8.8&outputFormat=XML",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Type": "application/xml"},
+		},
+		{
+			name:       "unknown token",
+			query:      "apiKey=" + apiKey + "&ipAddress=8.8.8.8",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no token",
+			query:      "ipAddress=8.8.8.8",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1?"+tt.query, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			for key, want := range tt.wantHeader {
+				if got := rec.Header().Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	// the cached lookup is sent once, XML is passed through, and the real key is used
+	requests := upstream.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("got %d upstream requests, want 3", len(requests))
+	}
+
+	for _, r := range requests {
+		if r.Query.Get("apiKey") != apiKey {
+			t.Errorf("upstream apiKey = %q, want %q", r.Query.Get("apiKey"), apiKey)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`geoip_proxy_requests_total{caller="billing",result="hit"} 1`,
+		`geoip_proxy_requests_total{caller="search",result="rejected"} 3`,
+		"geoip_rate_limit_wait_seconds_count 3",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics = %s, want %q", body, want)
+		}
+	}
+
+	if err := save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "cache.json")); err != nil {
+		t.Errorf("cache is not saved: %v", err)
+	}
+}
+
+// TestProxyRateLimitRetries tests that every retry of the profile waits for the rate limiter.
+func TestProxyRateLimitRetries(t *testing.T) {
+	var requests atomic.Int32
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8","location":{"country":"US"}}`))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+
+	tokens := filepath.Join(dir, "tokens.json")
+	if err := os.WriteFile(tokens, []byte(`{"callers": [{"name": "billing", "token": "billing-token"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{"retry": {"maxAttempts": 3, "initialBackoff": "1ms"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, _, err := newHandler(options{
+		tokens:     tokens,
+		configPath: config,
+		rps:        20,
+		burst:      1,
+		cacheTTL:   time.Minute,
+		cacheSize:  10,
+	}, func(key string) string {
+		return map[string]string{simplegeoip.EnvAPIKey: apiKey, simplegeoip.EnvBaseURL: upstream.URL}[key]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1?apiKey=billing-token&ipAddress=8.8.8.8", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("got %d upstream requests, want 3", got)
+	}
+
+	// two retries wait for tokens refilled at 20 per second
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("retries took %v, want at least 100ms", elapsed)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if want := "geoip_rate_limit_wait_seconds_count 3"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("metrics = %s, want %q", rec.Body, want)
+	}
+}
+
+// TestCallers tests quota periods and the tokens file validation.
+func TestCallers(t *testing.T) {
+	c, err := newCallers([]callerConfig{{Name: "a", Token: "t", Quota: 1, Period: simplegeoip.Duration(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time {
+		return now
+	}
+
+	if _, remaining, err := c.take("t", true); err != nil || remaining != 0 {
+		t.Errorf("take() = %d, %v, want 0, nil", remaining, err)
+	}
+
+	if _, _, err := c.take("t", true); err != errQuotaExceeded {
+		t.Errorf("take() error = %v, want %v", err, errQuotaExceeded)
+	}
+
+	now = now.Add(time.Hour)
+
+	if _, _, err := c.take("t", true); err != nil {
+		t.Errorf("take() error = %v after the period", err)
+	}
+
+	for _, configs := range [][]callerConfig{
+		{{Name: "a"}},
+		{{Name: "a", Token: "t"}, {Name: "b", Token: "t"}},
+	} {
+		if _, err := newCallers(configs); err == nil {
+			t.Errorf("newCallers(%+v) succeeded", configs)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// Error classes of the batch summary.
+const (
+	classInput   = "input"
+	classAPI     = "api"
+	classNetwork = "network"
+)
+
+// errorClass returns the class of the lookup error.
+func errorClass(err error) string {
+	switch exitCode(err) {
+	case exitInput:
+		return classInput
+	case exitNetwork:
+		return classNetwork
+	}
+
+	return classAPI
+}
+
+// batch looks up targets read from the files, or from stdin if there are none, and writes the results.
+// It returns the exit code and the error to report.
+func batch(opts options, files []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) (int, error) {
+	if opts.format == formatXML || !isFormat(opts.format) {
+		return exitInput, fmt.Errorf("unknown batch output format %q, use table, json or csv", opts.format)
+	}
+
+	targets, err := readTargets(files, stdin)
+	if err != nil {
+		return exitInput, err
+	}
+
+	done, err := readResume(opts.resume)
+	if err != nil {
+		return exitInput, err
+	}
+
+	profile, err := loadProfile(opts, getenv)
+	if err != nil {
+		return exitInput, err
+	}
+
+	credits := &creditCounter{}
+
+	service, save, err := newService(profile, credits)
+	if err != nil {
+		return exitInput, err
+	}
+
+	var resume *os.File
+
+	if opts.resume != "" {
+		resume, err = os.OpenFile(opts.resume, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return exitInput, fmt.Errorf("cannot open resume file: %w", err)
+		}
+		defer resume.Close()
+	}
+
+	pending := make([]string, 0, len(targets))
+
+	for _, target := range targets {
+		if !done[target] {
+			pending = append(pending, target)
+		}
+	}
+
+	var queryOpts []simplegeoip.Option
+	if opts.noDomains {
+		queryOpts = append(queryOpts, simplegeoip.OptionReverseIP(0))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ch := make(chan string)
+
+	go func() {
+		defer close(ch)
+
+		for _, target := range pending {
+			select {
+			case ch <- target:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results, err := simplegeoip.Batch(ctx, service, ch, simplegeoip.BatchParams{
+		Concurrency:       opts.concurrency,
+		RequestsPerSecond: opts.rps,
+		Options:           queryOpts,
+	})
+	if err != nil {
+		return exitInput, err
+	}
+
+	out := newBatchWriter(opts.format, stdout)
+	sum := newSummary(len(targets) - len(pending))
+	prog := newProgress(stderr, len(pending))
+
+	for result := range results {
+		if err := out.write(result); err != nil {
+			stop()
+
+			return exitInput, fmt.Errorf("cannot write output: %w", err)
+		}
+
+		sum.add(result)
+		prog.update(result.Err != nil)
+
+		// network errors are worth retrying, so such targets are not recorded as done
+		if resume != nil && (result.Err == nil || errorClass(result.Err) != classNetwork) {
+			if _, err := fmt.Fprintln(resume, result.Target); err != nil {
+				return exitInput, fmt.Errorf("cannot write resume file: %w", err)
+			}
+		}
+	}
+
+	prog.finish()
+
+	if err := out.flush(); err != nil {
+		return exitInput, fmt.Errorf("cannot write output: %w", err)
+	}
+
+	sum.credits, sum.cached = credits.requests.Load(), credits.hits.Load()
+	sum.write(stderr, prog.elapsed())
+
+	if err := save(); err != nil {
+		return exitInput, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return exitInterrupted, errors.New("interrupted")
+	}
+
+	return sum.exitCode(), nil
+}
+
+// readTargets reads targets from the files, one per line. Blank lines and lines starting with # are skipped.
+// Stdin is read if there are no files or the file is "-".
+func readTargets(files []string, stdin io.Reader) ([]string, error) {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var targets []string
+
+	for _, name := range files {
+		lines, err := readTargetsFile(name, stdin)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read targets from %s: %w", name, err)
+		}
+
+		targets = append(targets, lines...)
+	}
+
+	return targets, nil
+}
+
+// readTargetsFile reads targets from the file or from stdin if the name is "-".
+func readTargetsFile(name string, stdin io.Reader) ([]string, error) {
+	if name == "-" {
+		return readLines(stdin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readLines(f)
+}
+
+// readLines returns trimmed lines skipping blank lines and comments.
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// readResume returns targets recorded in the resume file. The missing file is not an error.
+func readResume(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	if path == "" {
+		return done, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return done, nil
+		}
+
+		return nil, fmt.Errorf("cannot read resume file: %w", err)
+	}
+	defer f.Close()
+
+	lines, err := readLines(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read resume file: %w", err)
+	}
+
+	for _, line := range lines {
+		done[line] = true
+	}
+
+	return done, nil
+}
+
+// batchWriter writes batch results in the output format.
+type batchWriter struct {
+	format string
+	tw     *tabwriter.Writer
+	cw     *csv.Writer
+	enc    *json.Encoder
+}
+
+// newBatchWriter creates batchWriter and writes the header of the table or CSV.
+func newBatchWriter(format string, w io.Writer) *batchWriter {
+	bw := &batchWriter{format: format}
+
+	switch format {
+	case formatJSON:
+		bw.enc = json.NewEncoder(w)
+	case formatCSV:
+		bw.cw = csv.NewWriter(w)
+		_ = bw.cw.Write(append(append([]string{"target"}, csvHeader...), "error"))
+	default:
+		bw.tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(bw.tw, "TARGET\tIP\tCOUNTRY\tCITY\tASN\tISP\tERROR")
+	}
+
+	return bw
+}
+
+// batchLine is the JSON line of the batch result.
+type batchLine struct {
+	Target   string                     `json:"target"`
+	Response *simplegeoip.GeoIPResponse `json:"response,omitempty"`
+	Error    string                     `json:"error,omitempty"`
+}
+
+// write writes the result. CSV and JSON lines are written at once, the table is aligned on flush.
+func (bw *batchWriter) write(result simplegeoip.BatchResult) error {
+	errMsg := ""
+	if result.Err != nil {
+		errMsg = result.Err.Error()
+	}
+
+	switch bw.format {
+	case formatJSON:
+		return bw.enc.Encode(batchLine{Target: result.Target, Response: result.Response, Error: errMsg})
+	case formatCSV:
+		record := make([]string, len(csvHeader))
+		if result.Response != nil {
+			record = csvRecord(result.Response)
+		}
+
+		_ = bw.cw.Write(append(append([]string{result.Target}, record...), errMsg))
+		bw.cw.Flush()
+
+		return bw.cw.Error()
+	}
+
+	resp := result.Response
+	if resp == nil {
+		resp = &simplegeoip.GeoIPResponse{}
+	}
+
+	asn := ""
+	if resp.AS.ASN != 0 {
+		asn = "AS" + strconv.Itoa(resp.AS.ASN)
+	}
+
+	_, err := fmt.Fprintf(bw.tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		result.Target, resp.IP, resp.Location.Country, resp.Location.City, asn, resp.ISP, errMsg)
+
+	return err
+}
+
+// flush writes the buffered table.
+func (bw *batchWriter) flush() error {
+	if bw.tw != nil {
+		return bw.tw.Flush()
+	}
+
+	return nil
+}
+
+// creditCounter is the metrics sink counting successful API requests, which are charged, and cache hits,
+// which are not.
+type creditCounter struct {
+	requests atomic.Int64
+	hits     atomic.Int64
+}
+
+// AddCounter counts successful API requests and cache hits.
+func (c *creditCounter) AddCounter(name string, delta float64, labels ...simplegeoip.Label) {
+	for _, label := range labels {
+		switch {
+		case name == simplegeoip.MetricRequests && label.Name == "outcome" && label.Value == simplegeoip.OutcomeSuccess:
+			c.requests.Add(int64(delta))
+		case name == simplegeoip.MetricCacheRequests && label.Name == "result" && label.Value == "hit":
+			c.hits.Add(int64(delta))
+		}
+	}
+}
+
+// ObserveHistogram ignores histograms.
+func (c *creditCounter) ObserveHistogram(string, float64, ...simplegeoip.Label) {}
+
+// summary counts batch results.
+type summary struct {
+	skipped   int
+	succeeded int
+	failed    int
+	countries map[string]int
+	errors    map[string]int
+
+	// credits is the number of successful API requests and cached is the number of cache hits
+	credits int64
+	cached  int64
+}
+
+// newSummary creates summary with the number of targets skipped by the resume file.
+func newSummary(skipped int) *summary {
+	return &summary{
+		skipped:   skipped,
+		countries: make(map[string]int),
+		errors:    make(map[string]int),
+	}
+}
+
+// add counts the result.
+func (s *summary) add(result simplegeoip.BatchResult) {
+	if result.Err != nil {
+		s.failed++
+		s.errors[errorClass(result.Err)]++
+
+		return
+	}
+
+	s.succeeded++
+
+	country := result.Response.Location.Country
+	if country == "" {
+		country = "unknown"
+	}
+
+	s.countries[country]++
+}
+
+// write writes the summary. Credits are counted as one per successful API request, responses served
+// from the persistent cache are free.
+func (s *summary) write(w io.Writer, elapsed time.Duration) {
+	fmt.Fprintf(w, "geoip: %d looked up in %s: %d succeeded, %d failed, %d skipped\n",
+		s.succeeded+s.failed, elapsed.Round(time.Millisecond), s.succeeded, s.failed, s.skipped)
+	fmt.Fprintf(w, "credits used: %d, cache hits: %d\n", s.credits, s.cached)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	writeCounts(tw, "countries", s.countries)
+	writeCounts(tw, "errors", s.errors)
+
+	_ = tw.Flush()
+}
+
+// writeCounts writes counts sorted by the count in descending order.
+func writeCounts(w io.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	fmt.Fprintln(w, title+":")
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s\t%d\n", key, counts[key])
+	}
+}
+
+// exitCode returns the exit code of the most severe error class, network errors first.
+func (s *summary) exitCode() int {
+	switch {
+	case s.errors[classNetwork] > 0:
+		return exitNetwork
+	case s.errors[classAPI] > 0:
+		return exitAPI
+	case s.errors[classInput] > 0:
+		return exitInput
+	}
+
+	return exitOK
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whois-api-llc/go-simple-geoip/geoiptest"
+)
+
+// TestBatch tests batch output formats, the summary and the resume file.
+func TestBatch(t *testing.T) {
+	server := newTestServer(t)
+
+	closed := geoiptest.NewServer(geoiptest.ServerParams{})
+	closed.Close()
+
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "targets.txt")
+	if err := os.WriteFile(file, []byte("# targets\n8.8.8.8\n\ndns.google\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := "8.8.8.8\nnot a host\n1.1.1.1\n"
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantOut    []string
+		wantStderr []string
+	}{
+		{
+			name:     "json from stdin",
+			args:     []string{"-url", server.URL, "-format", "json"},
+			wantCode: exitAPI,
+			wantOut: []string{
+				`{"target":"8.8.8.8","response":{"ip":"8.8.8.8",`,
+				`{"target":"not a host","error":"invalid argument: \"target\" is not an IP address`,
+				`{"target":"1.1.1.1","error":"API error: [404] record not found"}`,
+			},
+			wantStderr: []string{
+				"geoip: 3/3 done, 2 failed",
+				"geoip: 3 looked up in ",
+				": 1 succeeded, 2 failed, 0 skipped\n",
+				"credits used: 1, cache hits: 0\n",
+				"countries:\n  US  1\n",
+				"errors:\n  api    1\n  input  1\n",
+			},
+		},
+		{
+			name:     "csv from files",
+			args:     []string{"-url", server.URL, "-format", "csv", "-rps", "100", file, "-"},
+			wantCode: exitAPI,
+			wantOut: []string{
+				"target,ip,country,region,city,",
+				",domains,error\n",
+				"dns.google,8.8.8.8,US,California,Mountain View,",
+				"1.1.1.1,,,,,,,,,,,,,,,,,,API error: [404] record not found\n",
+			},
+			wantStderr: []string{": 3 succeeded, 2 failed, 0 skipped\n", "credits used: 3, cache hits: 0\n", "  US  3\n"},
+		},
+		{
+			name:       "cache miss",
+			args:       []string{"-url", server.URL, "-cache", filepath.Join(dir, "cache.json")},
+			wantCode:   exitAPI,
+			wantStderr: []string{": 1 succeeded, 2 failed, 0 skipped\n", "credits used: 1, cache hits: 0\n"},
+		},
+		{
+			name:       "cache hit",
+			args:       []string{"-url", server.URL, "-cache", filepath.Join(dir, "cache.json")},
+			wantCode:   exitAPI,
+			wantStderr: []string{": 1 succeeded, 2 failed, 0 skipped\n", "credits used: 0, cache hits: 1\n"},
+		},
+		{
+			name:     "table",
+			args:     []string{"-url", server.URL, "-concurrency", "1"},
+			wantCode: exitAPI,
+			wantOut: []string{
+				"TARGET      IP       COUNTRY  CITY           ASN      ISP         ERROR\n",
+				"8.8.8.8     8.8.8.8  US       Mountain View  AS15169  Google LLC  \n",
+			},
+		},
+		{
+			name:       "network error",
+			args:       []string{"-url", closed.URL, "-format", "json"},
+			wantCode:   exitNetwork,
+			wantStderr: []string{"errors:\n  network  2\n  input    1\n"},
+		},
+		{
+			name:       "xml",
+			args:       []string{"-format", "xml"},
+			wantCode:   exitInput,
+			wantStderr: []string{`geoip: unknown batch output format "xml"`},
+		},
+		{
+			name:       "missing file",
+			args:       []string{filepath.Join(dir, "missing.txt")},
+			wantCode:   exitInput,
+			wantStderr: []string{"geoip: cannot read targets from"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			args := append([]string{"-batch", "-key", testKey}, tt.args...)
+
+			code := run(args, strings.NewReader(stdin), &stdout, &stderr, func(string) string {
+				return ""
+			})
+
+			if code != tt.wantCode {
+				t.Errorf("run() = %d, want %d, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout = %q, want %q", stdout.String(), want)
+				}
+			}
+
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr = %q, want %q", stderr.String(), want)
+				}
+			}
+		})
+	}
+}
+
+// TestBatchResume tests that done targets are skipped and network errors are retried.
+func TestBatchResume(t *testing.T) {
+	server := newTestServer(t)
+
+	closed := geoiptest.NewServer(geoiptest.ServerParams{})
+	closed.Close()
+
+	resume := filepath.Join(t.TempDir(), "done.txt")
+
+	batch := func(apiURL, stdin string) (int, string) {
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"-batch", "-key", testKey, "-url", apiURL, "-resume", resume},
+			strings.NewReader(stdin), &stdout, &stderr, func(string) string {
+				return ""
+			})
+
+		return code, stderr.String()
+	}
+
+	if code, stderr := batch(closed.URL, "8.8.8.8\n"); code != exitNetwork {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+
+	if code, stderr := batch(server.URL, "8.8.8.8\n1.1.1.1\n"); code != exitAPI || !strings.Contains(stderr, "0 skipped") {
+		t.Fatalf("run() = %d, stderr: %s", code, stderr)
+	}
+
+	code, stderr := batch(server.URL, "8.8.8.8\n1.1.1.1\ndns.google\n")
+	if code != exitOK || !strings.Contains(stderr, "1 succeeded, 0 failed, 2 skipped") {
+		t.Errorf("run() = %d, stderr: %s", code, stderr)
+	}
+
+	data, err := os.ReadFile(resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Fields(string(data))
+	if len(lines) != 3 {
+		t.Errorf("resume file = %q, want 3 targets", data)
+	}
+}
+
+// TestProgress tests the progress bar and log lines.
+func TestProgress(t *testing.T) {
+	var b bytes.Buffer
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	p := newProgress(&b, 4)
+	p.start, p.last = now, now
+	p.now = func() time.Time {
+		return now
+	}
+
+	p.update(false)
+
+	now = now.Add(progressLogEvery)
+	p.update(true)
+
+	if want := "geoip: 2/4 done, 1 failed, 0.4/s\n"; b.String() != want {
+		t.Errorf("log = %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+
+	p.tty = true
+	p.update(false)
+	p.finish()
+
+	if want := "\r[======================        ]  75% 3/4, 1 failed, 0.6/s\n"; b.String() != want {
+		t.Errorf("progress bar = %q, want %q", b.String(), want)
+	}
+}
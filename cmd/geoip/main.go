@@ -0,0 +1,255 @@
+// Command geoip looks up the location of an IP address, a domain or an email with IP Geolocation API.
+//
+// Usage:
+//
+//	geoip [flags] [ip | domain | email]
+//	geoip -batch [flags] [file ...]
+//
+// The target kind is detected automatically. Without the target the location of the caller's own IP address
+// is returned. In batch mode targets are read from the files or stdin, one per line, and looked up
+// concurrently. Progress is reported to stderr followed by the summary of countries, errors and credits used.
+//
+// Settings are taken from flags, GEOIP_* environment variables and the config file profile, in that order.
+// The profile is selected with -profile or GEOIP_PROFILE.
+//
+// Exit codes: 0 on success, 2 on invalid input, 3 on API errors, 4 on network errors and 130 on interrupt.
+// In batch mode the code of the most severe failed lookup is returned.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0
+	exitInput   = 2
+	exitAPI     = 3
+	exitNetwork = 4
+
+	exitInterrupted = 130
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv))
+}
+
+// options are the command line options.
+type options struct {
+	key        string
+	format     string
+	configPath string
+	profile    string
+	apiURL     string
+	timeout    time.Duration
+	proxy      string
+	cachePath  string
+	noDomains  bool
+
+	batch       bool
+	concurrency int
+	rps         float64
+	resume      string
+}
+
+// run runs the command and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, getenv func(string) string) int {
+	var opts options
+
+	flags := flag.NewFlagSet("geoip", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.key, "key", "", "API key, overrides "+simplegeoip.EnvAPIKey+" and the config file")
+	flags.StringVar(&opts.format, "format", formatTable, "output format: table, json, xml or csv")
+	flags.StringVar(&opts.configPath, "config", "", "config file (default "+simplegeoip.DefaultConfigPath()+")")
+	flags.StringVar(&opts.profile, "profile", "", "config profile, overrides "+simplegeoip.EnvProfile)
+	flags.StringVar(&opts.apiURL, "url", "", "IP Geolocation API endpoint URL, overrides "+simplegeoip.EnvBaseURL)
+	flags.DurationVar(&opts.timeout, "timeout", 0, "request timeout, overrides "+simplegeoip.EnvTimeout+" (default 30s)")
+	flags.StringVar(&opts.proxy, "proxy", "", "HTTP proxy URL, overrides "+simplegeoip.EnvProxy)
+	flags.StringVar(&opts.cachePath, "cache", "", "file keeping cached responses between runs, overrides "+
+		simplegeoip.EnvCachePath)
+	flags.BoolVar(&opts.noDomains, "no-domains", false, "skip the reverse IP lookup of domains")
+	flags.BoolVar(&opts.batch, "batch", false, "look up targets from the files or stdin, one per line")
+	flags.IntVar(&opts.concurrency, "concurrency", 4, "number of concurrent lookups in batch mode")
+	flags.Float64Var(&opts.rps, "rps", 0, "requests per second in batch mode, 0 means no limit")
+	flags.StringVar(&opts.resume, "resume", "", "file recording done targets in batch mode, they are skipped on rerun")
+
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: geoip [flags] [ip | domain | email]")
+		fmt.Fprintln(stderr, "       geoip -batch [flags] [file ...]")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitInput
+	}
+
+	var (
+		code int
+		err  error
+	)
+
+	switch {
+	case opts.batch:
+		code, err = batch(opts, flags.Args(), stdin, stdout, stderr, getenv)
+	case flags.NArg() > 1:
+		flags.Usage()
+
+		return exitInput
+	default:
+		code, err = lookup(opts, flags.Arg(0), stdout, getenv)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "geoip:", err)
+	}
+
+	return code
+}
+
+// lookup looks up the target and writes the result. It returns the exit code and the error to report.
+func lookup(opts options, target string, stdout io.Writer, getenv func(string) string) (int, error) {
+	if !isFormat(opts.format) {
+		return exitInput, fmt.Errorf("unknown output format %q", opts.format)
+	}
+
+	option, err := simplegeoip.OptionTarget(target)
+	if err != nil {
+		return exitInput, err
+	}
+
+	queryOpts := []simplegeoip.Option{option}
+
+	if opts.noDomains {
+		queryOpts = append(queryOpts, simplegeoip.OptionReverseIP(0))
+	}
+
+	profile, err := loadProfile(opts, getenv)
+	if err != nil {
+		return exitInput, err
+	}
+
+	service, save, err := newService(profile, nil)
+	if err != nil {
+		return exitInput, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(profile.Timeout))
+	defer cancel()
+
+	if err := write(ctx, service, opts.format, queryOpts, stdout); err != nil {
+		return exitCode(err), err
+	}
+
+	if err := save(); err != nil {
+		return exitInput, err
+	}
+
+	return exitOK, nil
+}
+
+// defaultTimeout is the request timeout if it's not set by the profile, the environment or the flag.
+const defaultTimeout = 30 * time.Second
+
+// loadProfile returns the config profile overridden by environment variables and flags.
+func loadProfile(opts options, getenv func(string) string) (simplegeoip.Profile, error) {
+	cfg, err := simplegeoip.LoadConfig(opts.configPath)
+	if err != nil {
+		return simplegeoip.Profile{}, err
+	}
+
+	name := opts.profile
+	if name == "" {
+		name = getenv(simplegeoip.EnvProfile)
+	}
+
+	profile, err := cfg.Select(name)
+	if err != nil {
+		return simplegeoip.Profile{}, err
+	}
+
+	if err := profile.ApplyEnv(getenv); err != nil {
+		return simplegeoip.Profile{}, err
+	}
+
+	profile.Override(simplegeoip.Profile{
+		APIKey:       opts.key,
+		GeoipBaseURL: opts.apiURL,
+		Timeout:      simplegeoip.Duration(opts.timeout),
+		Proxy:        opts.proxy,
+		CachePath:    opts.cachePath,
+	})
+
+	if profile.APIKey == "" {
+		return simplegeoip.Profile{}, fmt.Errorf("API key is not set, use -key, %s or the config file", simplegeoip.EnvAPIKey)
+	}
+
+	if profile.Timeout == 0 {
+		profile.Timeout = simplegeoip.Duration(defaultTimeout)
+	}
+
+	return profile, nil
+}
+
+// newService creates the client of the profile. It's wrapped in the cache if the profile has the cache path,
+// and save writes the cache back. The client and the cache record metrics to the sink if it's not nil.
+func newService(profile simplegeoip.Profile, sink simplegeoip.MetricsSink) (
+	service simplegeoip.GeoipService, save func() error, err error,
+) {
+	params, err := profile.ClientParams()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params.MetricsSink = sink
+	client := simplegeoip.NewClient(profile.APIKey, params)
+
+	if profile.CachePath == "" {
+		return client, func() error { return nil }, nil
+	}
+
+	cache, err := profile.NewCache(client, simplegeoip.CacheParams{MetricsSink: sink})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cache, func() error { return profile.SaveCache(cache) }, nil
+}
+
+// exitCode returns the exit code for the lookup error.
+func exitCode(err error) int {
+	var argErr *simplegeoip.ArgError
+	if errors.As(err, &argErr) {
+		return exitInput
+	}
+
+	var errMsg *simplegeoip.ErrorMessage
+	if errors.As(err, &errMsg) {
+		return exitAPI
+	}
+
+	var errResp simplegeoip.ErrorResponse
+	if errors.As(err, &errResp) {
+		return exitAPI
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded) {
+		return exitNetwork
+	}
+
+	// the response has been received, but it cannot be parsed
+	return exitAPI
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+	"github.com/whois-api-llc/go-simple-geoip/geoiptest"
+)
+
+// testKey is the API key accepted by the test server.
+const testKey = "test-key"
+
+// newTestServer starts the API server knowing 8.8.8.8, dns.google and support@dns.google.
+func newTestServer(t *testing.T) *geoiptest.Server {
+	t.Helper()
+
+	google := &simplegeoip.GeoIPResponse{
+		IP: "8.8.8.8",
+		Location: simplegeoip.Location{
+			Country: "US", Region: "California", City: "Mountain View", Lat: 37.40599, Lng: -122.078514,
+		},
+		ISP:     "Google LLC",
+		AS:      simplegeoip.AS{ASN: 15169, Name: "Google LLC", Route: "8.8.8.0/24", Type: "Content"},
+		Domains: []string{"dns.google"},
+	}
+
+	service := geoiptest.NewService()
+	service.Set(geoiptest.IP("8.8.8.8"), google)
+	service.Set(geoiptest.Domain("dns.google"), google)
+	service.Set(geoiptest.Email("support@dns.google"), google)
+
+	server := geoiptest.NewServer(geoiptest.ServerParams{Service: service, APIKey: testKey})
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// TestRun tests lookups, output formats and exit codes.
+func TestRun(t *testing.T) {
+	server := newTestServer(t)
+
+	closed := geoiptest.NewServer(geoiptest.ServerParams{})
+	closed.Close()
+
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"apiKey":"`+testKey+`"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles := filepath.Join(t.TempDir(), "profiles.json")
+
+	profilesConfig := `{"defaultProfile": "broken", "profiles": {` +
+		`"broken": {"apiKey": "wrong", "geoipBaseURL": "` + closed.URL + `"},` +
+		`"test": {"apiKey": "` + testKey + `", "geoipBaseURL": "` + server.URL + `", "timeout": "5s"}}}`
+	if err := os.WriteFile(profiles, []byte(profilesConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		wantCode   int
+		wantOut    []string
+		wantStderr string
+	}{
+		{
+			name:     "ip table",
+			args:     []string{"-key", testKey, "8.8.8.8"},
+			wantCode: exitOK,
+			wantOut:  []string{"IP           8.8.8.8\n", "City         Mountain View\n", "AS           AS15169 Google LLC\n"},
+		},
+		{
+			name:     "domain json",
+			args:     []string{"-key", testKey, "-format", "json", "dns.google"},
+			wantCode: exitOK,
+			wantOut:  []string{"{\n  \"ip\": \"8.8.8.8\",\n", `"city": "Mountain View"`},
+		},
+		{
+			name:     "email csv",
+			args:     []string{"-key", testKey, "-format", "csv", "support@dns.google"},
+			wantCode: exitOK,
+			wantOut: []string{
+				"ip,country,region,city,lat,lng,",
+				"8.8.8.8,US,California,Mountain View,37.40599,-122.078514,,,0,Google LLC,,15169,",
+			},
+		},
+		{
+			name:     "xml without domains",
+			args:     []string{"-key", testKey, "-format", "xml", "-no-domains", "8.8.8.8"},
+			wantCode: exitOK,
+			wantOut:  []string{"<ip>8.8.8.8</ip>"},
+		},
+		{
+			name:     "key from environment",
+			args:     []string{"8.8.8.8"},
+			env:      map[string]string{simplegeoip.EnvAPIKey: testKey},
+			wantCode: exitOK,
+			wantOut:  []string{"8.8.8.8"},
+		},
+		{
+			name:     "key from config",
+			args:     []string{"-config", config, "8.8.8.8"},
+			wantCode: exitOK,
+			wantOut:  []string{"8.8.8.8"},
+		},
+		{
+			name:     "profile flag",
+			args:     []string{"-config", profiles, "-profile", "test", "8.8.8.8"},
+			wantCode: exitOK,
+			wantOut:  []string{"8.8.8.8"},
+		},
+		{
+			name:     "profile from environment",
+			args:     []string{"-config", profiles, "8.8.8.8"},
+			env:      map[string]string{simplegeoip.EnvProfile: "test"},
+			wantCode: exitOK,
+			wantOut:  []string{"8.8.8.8"},
+		},
+		{
+			name:       "default profile",
+			args:       []string{"-config", profiles, "8.8.8.8"},
+			wantCode:   exitNetwork,
+			wantStderr: "geoip: cannot execute request",
+		},
+		{
+			name:     "flags override profile",
+			args:     []string{"-config", profiles, "-key", testKey, "-url", server.URL, "8.8.8.8"},
+			wantCode: exitOK,
+			wantOut:  []string{"8.8.8.8"},
+		},
+		{
+			name:       "unknown profile",
+			args:       []string{"-config", profiles, "-profile", "prod", "8.8.8.8"},
+			wantCode:   exitInput,
+			wantStderr: `geoip: profile "prod" is not found in config`,
+		},
+		{
+			name:       "invalid target",
+			args:       []string{"-key", testKey, "not a host"},
+			wantCode:   exitInput,
+			wantStderr: `geoip: invalid argument: "target" is not an IP address, a domain or an email: "not a host"`,
+		},
+		{
+			name:       "invalid email",
+			args:       []string{"-key", testKey, "@dns.google"},
+			wantCode:   exitInput,
+			wantStderr: `geoip: invalid argument: "target" is not a valid email: "@dns.google"`,
+		},
+		{
+			name:       "unknown format",
+			args:       []string{"-key", testKey, "-format", "yaml", "8.8.8.8"},
+			wantCode:   exitInput,
+			wantStderr: `geoip: unknown output format "yaml"`,
+		},
+		{
+			name:       "missing config",
+			args:       []string{"-config", filepath.Join(t.TempDir(), "missing.json"), "8.8.8.8"},
+			wantCode:   exitInput,
+			wantStderr: "geoip: cannot read config",
+		},
+		{
+			name:       "too many arguments",
+			args:       []string{"-key", testKey, "8.8.8.8", "1.1.1.1"},
+			wantCode:   exitInput,
+			wantStderr: "Usage: geoip",
+		},
+		{
+			name:       "wrong key",
+			args:       []string{"-key", "wrong", "8.8.8.8"},
+			wantCode:   exitAPI,
+			wantStderr: "geoip: API error: [403] Access restricted.",
+		},
+		{
+			name:       "wrong key raw",
+			args:       []string{"-key", "wrong", "-format", "json", "8.8.8.8"},
+			wantCode:   exitAPI,
+			wantStderr: "geoip: API error: [403] Access restricted.",
+		},
+		{
+			name:       "not found",
+			args:       []string{"-key", testKey, "1.1.1.1"},
+			wantCode:   exitAPI,
+			wantStderr: "geoip: API error: [404] record not found",
+		},
+		{
+			name:       "network error",
+			args:       []string{"-key", testKey, "-url", closed.URL, "8.8.8.8"},
+			wantCode:   exitNetwork,
+			wantStderr: "geoip: cannot execute request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			args := tt.args
+			if tt.name != "network error" && !strings.Contains(tt.name, "profile") {
+				args = append([]string{"-url", server.URL}, args...)
+			}
+
+			code := run(args, nil, &stdout, &stderr, func(key string) string {
+				return tt.env[key]
+			})
+
+			if code != tt.wantCode {
+				t.Errorf("run() = %d, want %d, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout = %q, want %q", stdout.String(), want)
+				}
+			}
+
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+// TestRunCache tests that responses cached by the previous run are used.
+func TestRunCache(t *testing.T) {
+	server := newTestServer(t)
+
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+
+	for _, apiURL := range []string{server.URL, "http://127.0.0.1:1"} {
+		var stdout, stderr bytes.Buffer
+
+		code := run([]string{"-key", testKey, "-url", apiURL, "-format", "csv", "8.8.8.8"}, nil, &stdout, &stderr,
+			func(key string) string {
+				if key == simplegeoip.EnvCachePath {
+					return cachePath
+				}
+
+				return ""
+			})
+		if code != exitOK || !strings.Contains(stdout.String(), "Mountain View") {
+			t.Errorf("run() = %d, stdout: %s, stderr: %s", code, stdout.String(), stderr.String())
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatXML   = "xml"
+	formatCSV   = "csv"
+)
+
+// isFormat reports whether the output format is known.
+func isFormat(format string) bool {
+	switch format {
+	case formatTable, formatJSON, formatXML, formatCSV:
+		return true
+	}
+
+	return false
+}
+
+// write looks up the target and writes the response in the format.
+// JSON and XML are written as returned by the API, the table and CSV are built from the parsed response.
+func write(ctx context.Context, service simplegeoip.GeoipService, format string, opts []simplegeoip.Option, w io.Writer) error {
+	if format == formatJSON || format == formatXML {
+		resp, err := service.GetRaw(ctx, append(opts, simplegeoip.OptionOutputFormat(format))...)
+		if err != nil {
+			return apiError(resp, err)
+		}
+
+		return writeRaw(w, format, resp.Body)
+	}
+
+	geoipResp, _, err := service.Get(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	if format == formatCSV {
+		return writeCSV(w, geoipResp)
+	}
+
+	return writeTable(w, geoipResp)
+}
+
+// apiError returns the API error message from the body of the failed raw response if there is one.
+func apiError(resp *simplegeoip.Response, err error) error {
+	var errResp simplegeoip.ErrorResponse
+	if resp == nil || !errors.As(err, &errResp) {
+		return err
+	}
+
+	var errMsg simplegeoip.ErrorMessage
+	if json.Unmarshal(resp.Body, &errMsg) != nil || errMsg.Message == "" {
+		return err
+	}
+
+	return &errMsg
+}
+
+// writeRaw writes the raw response, JSON is indented.
+func writeRaw(w io.Writer, format string, body []byte) error {
+	if format == formatJSON {
+		var b bytes.Buffer
+		if err := json.Indent(&b, body, "", "  "); err == nil {
+			body = b.Bytes()
+		}
+	}
+
+	body = append(bytes.TrimRight(body, "\n"), '\n')
+
+	_, err := w.Write(body)
+
+	return err
+}
+
+// writeTable writes the response as a two-column table.
+func writeTable(w io.Writer, resp *simplegeoip.GeoIPResponse) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	row := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s\t%s\n", name, value)
+		}
+	}
+
+	row("IP", resp.IP)
+	row("Country", resp.Location.Country)
+	row("Region", resp.Location.Region)
+	row("City", resp.Location.City)
+	row("Coordinates", formatFloat(resp.Location.Lat)+", "+formatFloat(resp.Location.Lng))
+	row("Postal code", resp.Location.PostalCode)
+	row("Timezone", resp.Location.Timezone)
+
+	if resp.Location.GeonameID != 0 {
+		row("GeoNames ID", strconv.FormatUint(uint64(resp.Location.GeonameID), 10))
+	}
+
+	row("ISP", resp.ISP)
+	row("Connection type", resp.ConnectionType)
+
+	if resp.AS.ASN != 0 {
+		row("AS", "AS"+strconv.Itoa(resp.AS.ASN)+" "+resp.AS.Name)
+		row("AS route", resp.AS.Route)
+		row("AS domain", resp.AS.Domain)
+		row("AS type", resp.AS.Type)
+	}
+
+	row("Domains", strings.Join(resp.Domains, ", "))
+
+	return tw.Flush()
+}
+
+// csvHeader is the header of CSV output.
+var csvHeader = []string{
+	"ip", "country", "region", "city", "lat", "lng", "postal_code", "timezone", "geoname_id",
+	"isp", "connection_type", "asn", "as_name", "as_route", "as_domain", "as_type", "domains",
+}
+
+// csvRecord returns the CSV record of the response. Domains are separated by spaces.
+func csvRecord(resp *simplegeoip.GeoIPResponse) []string {
+	asn := ""
+	if resp.AS.ASN != 0 {
+		asn = strconv.Itoa(resp.AS.ASN)
+	}
+
+	return []string{
+		resp.IP,
+		resp.Location.Country,
+		resp.Location.Region,
+		resp.Location.City,
+		formatFloat(resp.Location.Lat),
+		formatFloat(resp.Location.Lng),
+		resp.Location.PostalCode,
+		resp.Location.Timezone,
+		strconv.FormatUint(uint64(resp.Location.GeonameID), 10),
+		resp.ISP,
+		resp.ConnectionType,
+		asn,
+		resp.AS.Name,
+		resp.AS.Route,
+		resp.AS.Domain,
+		resp.AS.Type,
+		strings.Join(resp.Domains, " "),
+	}
+}
+
+// writeCSV writes the response as CSV with the header.
+func writeCSV(w io.Writer, resp *simplegeoip.GeoIPResponse) error {
+	cw := csv.NewWriter(w)
+
+	_ = cw.Write(csvHeader)
+	_ = cw.Write(csvRecord(resp))
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// formatFloat formats the coordinate without trailing zeros.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Progress reporting intervals of the terminal and the log.
+const (
+	progressRedraw   = 100 * time.Millisecond
+	progressLogEvery = 5 * time.Second
+)
+
+// progressWidth is the width of the progress bar.
+const progressWidth = 30
+
+// progress reports batch progress: a progress bar redrawn in place on the terminal, log lines otherwise.
+type progress struct {
+	w     io.Writer
+	tty   bool
+	total int
+
+	done   int
+	failed int
+	start  time.Time
+	last   time.Time
+
+	// now returns the current time, it's replaced in tests
+	now func() time.Time
+}
+
+// newProgress creates progress for the total number of targets.
+func newProgress(w io.Writer, total int) *progress {
+	now := time.Now()
+
+	return &progress{
+		w:     w,
+		tty:   isTerminal(w),
+		total: total,
+		start: now,
+		last:  now,
+		now:   time.Now,
+	}
+}
+
+// isTerminal reports whether the writer is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update counts the result and reports progress if it's time to.
+func (p *progress) update(failed bool) {
+	p.done++
+	if failed {
+		p.failed++
+	}
+
+	interval := progressLogEvery
+	if p.tty {
+		interval = progressRedraw
+	}
+
+	if now := p.now(); now.Sub(p.last) >= interval {
+		p.last = now
+		p.report()
+	}
+}
+
+// finish reports the final progress.
+func (p *progress) finish() {
+	p.report()
+
+	if p.tty {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// elapsed returns the time since the start.
+func (p *progress) elapsed() time.Duration {
+	return p.now().Sub(p.start)
+}
+
+// report writes the progress bar or the log line.
+func (p *progress) report() {
+	rate := 0.0
+	if elapsed := p.elapsed().Seconds(); elapsed > 0 {
+		rate = float64(p.done) / elapsed
+	}
+
+	if !p.tty {
+		fmt.Fprintf(p.w, "geoip: %d/%d done, %d failed, %.1f/s\n", p.done, p.total, p.failed, rate)
+
+		return
+	}
+
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = float64(p.done) / float64(p.total)
+	}
+
+	filled := int(ratio * progressWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+
+	fmt.Fprintf(p.w, "\r[%s] %3.0f%% %d/%d, %d failed, %.1f/s", bar, ratio*100, p.done, p.total, p.failed, rate)
+}
@@ -0,0 +1,361 @@
+package simplegeoip
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Environment variables overriding the profile settings, see Profile.ApplyEnv.
+const (
+	EnvProfile   = "GEOIP_PROFILE"
+	EnvAPIKey    = "GEOIP_API_KEY"
+	EnvBaseURL   = "GEOIP_BASE_URL"
+	EnvTimeout   = "GEOIP_TIMEOUT"
+	EnvProxy     = "GEOIP_PROXY"
+	EnvCachePath = "GEOIP_CACHE_PATH"
+)
+
+// Config is the config file with named profiles, e.g.
+//
+//	{
+//	  "defaultProfile": "production",
+//	  "timeout": "10s",
+//	  "profiles": {
+//	    "production": {"apiKey": "...", "retry": {"maxAttempts": 3}},
+//	    "staging": {"apiKey": "...", "geoipBaseURL": "https://staging.example.com/api/v1"},
+//	    "local": {"apiKey": "test", "geoipBaseURL": "http://localhost:8080/api/v1"}
+//	  }
+//	}
+type Config struct {
+	// Profile holds the settings shared by all profiles, the selected profile overrides them
+	Profile
+
+	// DefaultProfile is the name of the profile used if none is selected
+	DefaultProfile string `json:"defaultProfile,omitempty"`
+
+	// Profiles are the named profiles
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+}
+
+// Profile is the set of client settings.
+type Profile struct {
+	// APIKey is the IP Geolocation API key
+	APIKey string `json:"apiKey,omitempty"`
+
+	// GeoipBaseURL is the endpoint for 'IP Geolocation API' service
+	GeoipBaseURL string `json:"geoipBaseURL,omitempty"`
+
+	// Timeout is the timeout of every request
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// Proxy is the URL of the HTTP proxy
+	Proxy string `json:"proxy,omitempty"`
+
+	// CachePath is the file keeping cached responses between runs, see NewCache and SaveCache
+	CachePath string `json:"cachePath,omitempty"`
+
+	// Retry is the retry policy. If it's nil then requests are not retried
+	Retry *RetryPolicy `json:"retry,omitempty"`
+}
+
+// RetryPolicy is the retry policy of the profile, see RetryParams.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff Duration `json:"initialBackoff,omitempty"`
+
+	// MaxBackoff is the maximum delay between retries
+	MaxBackoff Duration `json:"maxBackoff,omitempty"`
+}
+
+// Duration is time.Duration written in JSON as a string such as "1.5s". Numbers are read as seconds.
+type Duration time.Duration
+
+// MarshalJSON returns the duration as a JSON string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON parses the duration string or the number of seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("cannot parse duration %s", data)
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+
+	return nil
+}
+
+// DefaultConfigPath returns the default config file path, e.g. ~/.config/go-simple-geoip/config.json on Linux.
+// It's empty if the user config directory is unknown.
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "go-simple-geoip", "config.json")
+}
+
+// LoadConfig reads the config file. If the path is empty then DefaultConfigPath is used,
+// and the missing default config file is not an error.
+func LoadConfig(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultConfigPath()
+	}
+
+	if path == "" {
+		return &Config{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return &Config{}, nil
+		}
+
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("cannot parse config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// LoadProfile reads the config file and returns the profile overridden by environment variables.
+// The profile name is taken from GEOIP_PROFILE if it's empty. See LoadConfig and Config.Select.
+func LoadProfile(path, name string) (Profile, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if name == "" {
+		name = os.Getenv(EnvProfile)
+	}
+
+	profile, err := cfg.Select(name)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if err := profile.ApplyEnv(os.Getenv); err != nil {
+		return Profile{}, err
+	}
+
+	return profile, nil
+}
+
+// Select returns the named profile merged over the shared settings.
+// If the name is empty then DefaultProfile is used, and if it's empty too then only shared settings are returned.
+func (c *Config) Select(name string) (Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+
+	if name == "" {
+		return c.Profile, nil
+	}
+
+	named, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q is not found in config", name)
+	}
+
+	profile := c.Profile
+	profile.Override(named)
+
+	return profile, nil
+}
+
+// Override overrides settings with those set in the other profile, e.g. by command line flags.
+func (p *Profile) Override(other Profile) {
+	if other.APIKey != "" {
+		p.APIKey = other.APIKey
+	}
+
+	if other.GeoipBaseURL != "" {
+		p.GeoipBaseURL = other.GeoipBaseURL
+	}
+
+	if other.Timeout != 0 {
+		p.Timeout = other.Timeout
+	}
+
+	if other.Proxy != "" {
+		p.Proxy = other.Proxy
+	}
+
+	if other.CachePath != "" {
+		p.CachePath = other.CachePath
+	}
+
+	if other.Retry != nil {
+		p.Retry = other.Retry
+	}
+}
+
+// ApplyEnv overrides settings with environment variables GEOIP_API_KEY, GEOIP_BASE_URL, GEOIP_TIMEOUT,
+// GEOIP_PROXY and GEOIP_CACHE_PATH. The getenv function is usually os.Getenv.
+func (p *Profile) ApplyEnv(getenv func(string) string) error {
+	var timeout Duration
+
+	if value := getenv(EnvTimeout); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvTimeout, err)
+		}
+
+		timeout = Duration(duration)
+	}
+
+	p.Override(Profile{
+		APIKey:       getenv(EnvAPIKey),
+		GeoipBaseURL: getenv(EnvBaseURL),
+		Timeout:      timeout,
+		Proxy:        getenv(EnvProxy),
+		CachePath:    getenv(EnvCachePath),
+	})
+
+	return nil
+}
+
+// ClientParams returns the client parameters of the profile. The HTTP client is created
+// only if the timeout or the proxy is set.
+func (p Profile) ClientParams() (ClientParams, error) {
+	var params ClientParams
+
+	if p.GeoipBaseURL != "" {
+		baseURL, err := url.Parse(p.GeoipBaseURL)
+		if err != nil {
+			return params, fmt.Errorf("invalid API URL: %w", err)
+		}
+
+		params.GeoipBaseURL = baseURL
+	}
+
+	if p.Timeout != 0 || p.Proxy != "" {
+		params.HTTPClient = &http.Client{Timeout: time.Duration(p.Timeout)}
+	}
+
+	if p.Proxy != "" {
+		proxyURL, err := url.Parse(p.Proxy)
+		if err != nil {
+			return params, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		params.HTTPClient.Transport = transport
+	}
+
+	if p.Retry != nil {
+		params.Retry = &RetryParams{
+			MaxAttempts:    p.Retry.MaxAttempts,
+			InitialBackoff: time.Duration(p.Retry.InitialBackoff),
+			MaxBackoff:     time.Duration(p.Retry.MaxBackoff),
+		}
+	}
+
+	return params, nil
+}
+
+// NewClient creates Client with the profile settings.
+func (p Profile) NewClient() (*Client, error) {
+	if p.APIKey == "" {
+		return nil, &ArgError{Name: "APIKey", Message: "is not set"}
+	}
+
+	params, err := p.ClientParams()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(p.APIKey, params), nil
+}
+
+// NewCache creates Cache wrapping the service and loads responses saved in CachePath.
+// The missing cache file is not an error.
+func (p Profile) NewCache(service GeoipService, params CacheParams) (*Cache, error) {
+	cache := NewCache(service, params)
+	if p.CachePath == "" {
+		return cache, nil
+	}
+
+	f, err := os.Open(p.CachePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cache, nil
+		}
+
+		return nil, fmt.Errorf("cannot open cache: %w", err)
+	}
+	defer f.Close()
+
+	if err := cache.Load(f); err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+// SaveCache saves the cache to CachePath. The file is replaced atomically.
+func (p Profile) SaveCache(cache *Cache) error {
+	if p.CachePath == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.CachePath), 0o700); err != nil {
+		return fmt.Errorf("cannot save cache: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p.CachePath), filepath.Base(p.CachePath)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot save cache: %w", err)
+	}
+
+	defer os.Remove(f.Name())
+
+	if err := cache.Save(f); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot save cache: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), p.CachePath); err != nil {
+		return fmt.Errorf("cannot save cache: %w", err)
+	}
+
+	return nil
+}
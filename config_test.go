@@ -0,0 +1,175 @@
+package simplegeoip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testConfig is the config with shared settings and three profiles.
+const testConfig = `{
+	"defaultProfile": "production",
+	"timeout": "10s",
+	"retry": {"maxAttempts": 2},
+	"profiles": {
+		"production": {"apiKey": "prod-key"},
+		"staging": {"apiKey": "staging-key", "geoipBaseURL": "https://staging.example.com/api/v1", "timeout": 5},
+		"local": {"apiKey": "test", "geoipBaseURL": "http://localhost:8080", "proxy": "http://proxy:3128",
+			"cachePath": "/tmp/geoip-cache.json", "retry": {"maxAttempts": 5, "initialBackoff": "50ms"}}
+	}
+}`
+
+// TestConfigSelect tests profile selection and environment overrides.
+func TestConfigSelect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    Profile
+		wantErr string
+	}{
+		{
+			name: "",
+			want: Profile{APIKey: "prod-key", Timeout: Duration(10 * time.Second), Retry: &RetryPolicy{MaxAttempts: 2}},
+		},
+		{
+			name: "staging",
+			want: Profile{
+				APIKey:       "staging-key",
+				GeoipBaseURL: "https://staging.example.com/api/v1",
+				Timeout:      Duration(5 * time.Second),
+				Retry:        &RetryPolicy{MaxAttempts: 2},
+			},
+		},
+		{
+			name: "local",
+			env:  map[string]string{EnvAPIKey: "env-key", EnvTimeout: "1m", EnvCachePath: "/var/cache/geoip.json"},
+			want: Profile{
+				APIKey:       "env-key",
+				GeoipBaseURL: "http://localhost:8080",
+				Timeout:      Duration(time.Minute),
+				Proxy:        "http://proxy:3128",
+				CachePath:    "/var/cache/geoip.json",
+				Retry:        &RetryPolicy{MaxAttempts: 5, InitialBackoff: Duration(50 * time.Millisecond)},
+			},
+		},
+		{
+			name:    "staging",
+			env:     map[string]string{EnvTimeout: "soon"},
+			wantErr: `invalid GEOIP_TIMEOUT: time: invalid duration "soon"`,
+		},
+		{
+			name:    "missing",
+			wantErr: `profile "missing" is not found in config`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := cfg.Select(tt.name)
+			if err == nil {
+				err = profile.ApplyEnv(func(key string) string {
+					return tt.env[key]
+				})
+			}
+
+			checkErr(t, err, tt.wantErr)
+
+			if err == nil && !reflect.DeepEqual(profile, tt.want) {
+				t.Errorf("Select() = %+v, want %+v", profile, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoadConfig tests config file errors.
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := LoadConfig(filepath.Join(dir, "missing.json"))
+	if err == nil {
+		t.Error("LoadConfig() of the missing file succeeded")
+	}
+
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"timeout": "forever"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfig(path)
+	checkErr(t, err, "cannot parse config "+path+`: time: invalid duration "forever"`)
+
+	data, err := json.Marshal(Profile{APIKey: "key", Timeout: Duration(1500 * time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"apiKey":"key","timeout":"1.5s"}`; string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+}
+
+// TestProfileClient tests the client and the cache created from the profile.
+func TestProfileClient(t *testing.T) {
+	params, err := Profile{
+		GeoipBaseURL: "http://localhost:8080",
+		Timeout:      Duration(time.Second),
+		Proxy:        "http://proxy:3128",
+		Retry:        &RetryPolicy{MaxAttempts: 4},
+	}.ClientParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params.GeoipBaseURL.Host != "localhost:8080" || params.HTTPClient.Timeout != time.Second ||
+		params.Retry.MaxAttempts != 4 {
+		t.Errorf("ClientParams() = %+v", params)
+	}
+
+	proxyURL, err := params.HTTPClient.Transport.(*http.Transport).Proxy(&http.Request{})
+	if err != nil || proxyURL.Host != "proxy:3128" {
+		t.Errorf("proxy = %v, %v", proxyURL, err)
+	}
+
+	_, err = Profile{}.NewClient()
+	checkErr(t, err, `invalid argument: "APIKey" is not set`)
+
+	profile := Profile{CachePath: filepath.Join(t.TempDir(), "cache", "geoip.json")}
+	service := &stubService{resp: &GeoIPResponse{IP: "8.8.8.8"}}
+
+	cache, err := profile.NewCache(service, CacheParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := cache.Get(context.Background(), OptionIPAddress("8.8.8.8")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := profile.SaveCache(cache); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err = profile.NewCache(service, CacheParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.Len() != 1 {
+		t.Errorf("Len() = %d after loading the saved cache, want 1", cache.Len())
+	}
+}
@@ -0,0 +1,358 @@
+package simplegeoip
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultMinAgreement is the default share of the voting weight required to accept a value.
+const defaultMinAgreement = 0.5
+
+// ConsensusBackend is the Response.Backend value of responses merged by Consensus.
+const ConsensusBackend = "consensus"
+
+// Provider is a named GeoipService queried by Consensus.
+type Provider struct {
+	// Name is the provider name reported in ConsensusResult
+	Name string
+
+	// Service is the provider implementation
+	Service GeoipService
+
+	// Weight is the provider vote weight. Default: 1
+	Weight float64
+}
+
+// ConsensusParams is used to create Consensus. Providers are mandatory.
+type ConsensusParams struct {
+	// Providers are queried in parallel. Their order breaks ties in voting
+	Providers []Provider
+
+	// MinAgreement is the share of the voting weight the winning value must get to be accepted.
+	// Otherwise the field and the more specific ones are left empty, coordinates too if there is no country.
+	// Default: 0.5
+	MinAgreement float64
+}
+
+// Consensus is the GeoipService querying several providers in parallel and merging their responses
+// by weighted voting on country, then region within the winning country, then city within the winning region.
+type Consensus struct {
+	params ConsensusParams
+}
+
+var _ GeoipService = &Consensus{}
+
+// ProviderAnswer is the result of a single Consensus provider.
+type ProviderAnswer struct {
+	Provider string
+	Response *GeoIPResponse
+	Err      error
+}
+
+// FieldVote is the voting result on a single location field.
+type FieldVote struct {
+	// Value is the winning value. Empty if there were no votes or not enough agreement
+	Value string
+
+	// Agreement is the share of the voting weight the winning value got, from 0 to 1
+	Agreement float64
+
+	// Votes is the total voting weight per value
+	Votes map[string]float64
+}
+
+// ConsensusResult is the merged response with the disagreement report.
+type ConsensusResult struct {
+	// Response is the merged response
+	Response *GeoIPResponse
+
+	// Country, Region and City are the voting results
+	Country FieldVote
+	Region  FieldVote
+	City    FieldVote
+
+	// Spread is the maximum distance between the providers' coordinates in kilometers
+	Spread float64
+
+	// Confidence is the merged response confidence from 0 to 1.
+	// It's the mean agreement on the voted fields scaled by the share of providers' weight that answered
+	Confidence float64
+
+	// Answers are the providers' results in the order of ConsensusParams.Providers
+	Answers []ProviderAnswer
+}
+
+// NewConsensus creates Consensus with specified parameters.
+func NewConsensus(params ConsensusParams) *Consensus {
+	if params.MinAgreement <= 0 {
+		params.MinAgreement = defaultMinAgreement
+	}
+
+	providers := make([]Provider, len(params.Providers))
+	copy(providers, params.Providers)
+
+	for i := range providers {
+		if providers[i].Weight <= 0 {
+			providers[i].Weight = 1
+		}
+	}
+
+	params.Providers = providers
+
+	return &Consensus{params: params}
+}
+
+// Lookup queries all providers and returns the merged response with the disagreement report.
+// The error is returned only when none of providers answered.
+func (c *Consensus) Lookup(ctx context.Context, opts ...Option) (*ConsensusResult, error) {
+	if len(c.params.Providers) == 0 {
+		return nil, &ArgError{Name: "Providers", Message: "is empty"}
+	}
+
+	answers := make([]ProviderAnswer, len(c.params.Providers))
+
+	var wg sync.WaitGroup
+
+	for i, p := range c.params.Providers {
+		wg.Add(1)
+
+		go func(i int, p Provider) {
+			defer wg.Done()
+
+			resp, _, err := p.Service.Get(ctx, opts...)
+			answers[i] = ProviderAnswer{Provider: p.Name, Response: resp, Err: err}
+		}(i, p)
+	}
+
+	wg.Wait()
+
+	result := c.merge(answers)
+	if result.Response == nil {
+		fallbackErr := &FallbackError{}
+		for _, a := range answers {
+			fallbackErr.Errors = append(fallbackErr.Errors, BackendError{Backend: a.Provider, Err: a.Err})
+		}
+
+		return result, fallbackErr
+	}
+
+	return result, nil
+}
+
+// merge votes on the answers and builds the merged response.
+func (c *Consensus) merge(answers []ProviderAnswer) *ConsensusResult {
+	result := &ConsensusResult{Answers: answers}
+
+	var totalWeight, answeredWeight float64
+
+	voters := make([]int, 0, len(answers))
+
+	for i, a := range answers {
+		totalWeight += c.params.Providers[i].Weight
+
+		if a.Err == nil && a.Response != nil {
+			answeredWeight += c.params.Providers[i].Weight
+			voters = append(voters, i)
+		}
+	}
+
+	if len(voters) == 0 {
+		return result
+	}
+
+	sort.SliceStable(voters, func(i, j int) bool {
+		return c.params.Providers[voters[i]].Weight > c.params.Providers[voters[j]].Weight
+	})
+
+	var ok bool
+
+	result.Country, voters, ok = c.vote(answers, voters, func(l Location) string { return l.Country })
+	if ok {
+		result.Region, voters, ok = c.vote(answers, voters, func(l Location) string { return l.Region })
+	}
+
+	if ok {
+		result.City, voters, _ = c.vote(answers, voters, func(l Location) string { return l.City })
+	}
+
+	// the most specific agreeing answer of the heaviest provider is the base of the merged response
+	merged := *answers[voters[0]].Response
+	baseCountry := merged.Location.Country
+	merged.Location.Country = result.Country.Value
+	merged.Location.Region = result.Region.Value
+	merged.Location.City = result.City.Value
+
+	// coordinates of the base answer would contradict the country if providers don't agree on it
+	if len(result.Country.Votes) > 0 && (result.Country.Value == "" ||
+		!strings.EqualFold(baseCountry, result.Country.Value)) {
+		merged.Location.Lat, merged.Location.Lng = 0, 0
+	}
+
+	// coordinates of the providers agreeing on the city are averaged
+	if result.City.Value != "" {
+		var lat, lng, weight float64
+
+		for _, i := range voters {
+			l := answers[i].Response.Location
+			if strings.EqualFold(l.City, result.City.Value) && hasCoordinates(l) {
+				lat += l.Lat * c.params.Providers[i].Weight
+				lng += l.Lng * c.params.Providers[i].Weight
+				weight += c.params.Providers[i].Weight
+			}
+		}
+
+		if weight > 0 {
+			merged.Location.Lat = lat / weight
+			merged.Location.Lng = lng / weight
+		}
+	}
+
+	result.Response = &merged
+	result.Spread = spread(answers)
+
+	var agreement float64
+
+	fields := 0
+
+	for _, vote := range []FieldVote{result.Country, result.Region, result.City} {
+		if len(vote.Votes) > 0 {
+			agreement += vote.Agreement
+			fields++
+		}
+	}
+
+	if fields > 0 {
+		result.Confidence = agreement / float64(fields) * answeredWeight / totalWeight
+	}
+
+	return result
+}
+
+// vote finds the value with the most weight among the voters and returns the voters that agree with it
+// keeping their order. Providers with an empty value abstain and stay last in the returned voters.
+// It returns false if the winning value hasn't got enough agreement, the voters are returned unchanged then.
+func (c *Consensus) vote(
+	answers []ProviderAnswer,
+	voters []int,
+	field func(Location) string,
+) (FieldVote, []int, bool) {
+	vote := FieldVote{Votes: make(map[string]float64)}
+
+	var total float64
+
+	order := make([]string, 0, len(voters))
+
+	for _, i := range voters {
+		value := field(answers[i].Response.Location)
+		if value == "" {
+			continue
+		}
+
+		// values differing only in case are the same
+		key := strings.ToLower(value)
+		if _, ok := vote.Votes[key]; !ok {
+			order = append(order, key)
+		}
+
+		vote.Votes[key] += c.params.Providers[i].Weight
+		total += c.params.Providers[i].Weight
+	}
+
+	if total == 0 {
+		vote.Votes = nil
+
+		return vote, voters, true
+	}
+
+	var winner string
+
+	for _, key := range order {
+		if vote.Votes[key] > vote.Votes[winner] {
+			winner = key
+		}
+	}
+
+	vote.Agreement = vote.Votes[winner] / total
+	if vote.Agreement < c.params.MinAgreement {
+		return vote, voters, false
+	}
+
+	agreed := make([]int, 0, len(voters))
+	abstained := make([]int, 0, len(voters))
+
+	for _, i := range voters {
+		value := field(answers[i].Response.Location)
+
+		switch {
+		case strings.EqualFold(value, winner):
+			if vote.Value == "" {
+				vote.Value = value
+			}
+
+			agreed = append(agreed, i)
+		case value == "":
+			abstained = append(abstained, i)
+		}
+	}
+
+	return vote, append(agreed, abstained...), true
+}
+
+// hasCoordinates reports whether the location has coordinates. Zero coordinates mean unknown location.
+func hasCoordinates(l Location) bool {
+	return l.Lat != 0 || l.Lng != 0
+}
+
+// spread returns the maximum distance between the coordinates of the answers in kilometers.
+func spread(answers []ProviderAnswer) float64 {
+	var max float64
+
+	for i := range answers {
+		if answers[i].Response == nil || !hasCoordinates(answers[i].Response.Location) {
+			continue
+		}
+
+		for j := i + 1; j < len(answers); j++ {
+			if answers[j].Response == nil || !hasCoordinates(answers[j].Response.Location) {
+				continue
+			}
+
+			if d := answers[i].Response.Location.Distance(answers[j].Response.Location); d > max {
+				max = d
+			}
+		}
+	}
+
+	return max
+}
+
+// Get returns the merged response of the providers. Response contains it as JSON.
+func (c *Consensus) Get(
+	ctx context.Context,
+	opts ...Option,
+) (geoipResponse *GeoIPResponse, resp *Response, err error) {
+	result, err := c.Lookup(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := json.Marshal(result.Response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result.Response, &Response{Body: body, Backend: ConsensusBackend}, nil
+}
+
+// GetRaw returns the merged response of the providers as JSON.
+func (c *Consensus) GetRaw(
+	ctx context.Context,
+	opts ...Option,
+) (resp *Response, err error) {
+	_, resp, err = c.Get(ctx, opts...)
+
+	return resp, err
+}
@@ -0,0 +1,133 @@
+package simplegeoip
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// TestConsensusLookup tests voting, spread and confidence.
+func TestConsensusLookup(t *testing.T) {
+	mountainView := Location{Country: "US", Region: "California", City: "Mountain View", Lat: 37.386, Lng: -122.084}
+	sanJose := Location{Country: "US", Region: "California", City: "San Jose", Lat: 37.339, Lng: -121.895}
+	london := Location{Country: "GB", Region: "England", City: "London", Lat: 51.507, Lng: -0.128}
+	berlin := Location{Country: "DE", Region: "Berlin", City: "Berlin", Lat: 52.520, Lng: 13.405}
+
+	service := func(l Location) GeoipService {
+		return &stubService{resp: &GeoIPResponse{IP: "8.8.8.8", Location: l}}
+	}
+
+	tests := []struct {
+		name           string
+		providers      []Provider
+		minAgreement   float64
+		wantCountry    string
+		wantRegion     string
+		wantCity       string
+		wantConfidence float64
+		wantSpread     float64
+		wantNoCoords   bool
+		wantErr        string
+	}{
+		{
+			name: "unanimous",
+			providers: []Provider{
+				{Name: "a", Service: service(mountainView)},
+				{Name: "b", Service: service(mountainView)},
+			},
+			wantCountry:    "US",
+			wantRegion:     "California",
+			wantCity:       "Mountain View",
+			wantConfidence: 1,
+		},
+		{
+			name: "city majority",
+			providers: []Provider{
+				{Name: "a", Service: service(sanJose)},
+				{Name: "b", Service: service(mountainView)},
+				{Name: "c", Service: service(mountainView)},
+			},
+			wantCountry:    "US",
+			wantRegion:     "California",
+			wantCity:       "Mountain View",
+			wantConfidence: (1 + 1 + 2.0/3) / 3,
+			wantSpread:     mountainView.Distance(sanJose),
+		},
+		{
+			name: "weighted country",
+			providers: []Provider{
+				{Name: "a", Service: service(london), Weight: 3},
+				{Name: "b", Service: service(mountainView)},
+				{Name: "c", Service: service(mountainView)},
+			},
+			wantCountry:    "GB",
+			wantRegion:     "England",
+			wantCity:       "London",
+			wantConfidence: (0.6 + 1 + 1) / 3,
+			wantSpread:     mountainView.Distance(london),
+		},
+		{
+			name: "no agreement",
+			providers: []Provider{
+				{Name: "a", Service: service(london)},
+				{Name: "b", Service: service(mountainView)},
+				{Name: "c", Service: &stubService{err: ErrNotFound}},
+			},
+			minAgreement:   0.6,
+			wantConfidence: 0.5 * 2 / 3,
+			wantSpread:     mountainView.Distance(london),
+			wantNoCoords:   true,
+		},
+		{
+			name: "country split",
+			providers: []Provider{
+				{Name: "a", Service: service(london)},
+				{Name: "b", Service: service(berlin)},
+				{Name: "c", Service: service(mountainView)},
+			},
+			wantConfidence: 1.0 / 3,
+			wantSpread:     mountainView.Distance(berlin),
+			wantNoCoords:   true,
+		},
+		{
+			name: "all failed",
+			providers: []Provider{
+				{Name: "a", Service: &stubService{err: ErrNotFound}},
+			},
+			wantErr: "all backends failed: a: record not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConsensus(ConsensusParams{Providers: tt.providers, MinAgreement: tt.minAgreement})
+
+			got, err := c.Lookup(context.Background(), OptionIPAddress("8.8.8.8"))
+			checkErr(t, err, tt.wantErr)
+
+			if tt.wantErr != "" {
+				return
+			}
+
+			l := got.Response.Location
+			if l.Country != tt.wantCountry || l.Region != tt.wantRegion || l.City != tt.wantCity {
+				t.Errorf("Location = %+v, want %s/%s/%s", l, tt.wantCountry, tt.wantRegion, tt.wantCity)
+			}
+
+			if hasCoordinates(l) == tt.wantNoCoords {
+				t.Errorf("Location = %+v, want coordinates %v", l, !tt.wantNoCoords)
+			}
+
+			if math.Abs(got.Confidence-tt.wantConfidence) > 1e-9 {
+				t.Errorf("Confidence = %v, want %v", got.Confidence, tt.wantConfidence)
+			}
+
+			if math.Abs(got.Spread-tt.wantSpread) > 1e-9 {
+				t.Errorf("Spread = %v, want %v", got.Spread, tt.wantSpread)
+			}
+
+			if len(got.Answers) != len(tt.providers) {
+				t.Errorf("len(Answers) = %d, want %d", len(got.Answers), len(tt.providers))
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+// Package csvdb is the offline IP Geolocation backend that answers lookups from CSV range files.
+package csvdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// Params is used to open DB. Layout is mandatory.
+type Params struct {
+	// Layout describes the columns of the CSV file
+	Layout Layout
+
+	// ReloadInterval is the period of checking the file for changes.
+	// If it's zero then the file is loaded only once
+	ReloadInterval time.Duration
+
+	// ReloadErrorHandler is called when the changed file cannot be loaded. The previous data is kept in use
+	ReloadErrorHandler func(err error)
+}
+
+// DB answers IP Geolocation lookups from the in-memory index of CSV IP ranges.
+type DB struct {
+	path   string
+	params Params
+
+	// index holds the current index
+	index atomic.Value
+
+	// mu guards reloading and the file state below
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+var _ simplegeoip.GeoipService = &DB{}
+
+// ipRange is a range of IP addresses sharing the same record.
+type ipRange struct {
+	start net.IP
+	end   net.IP
+	resp  *simplegeoip.GeoIPResponse
+}
+
+// index is the list of IP ranges sorted by the start address.
+type index []ipRange
+
+// Open loads the CSV file and starts watching it for changes if Params.ReloadInterval is set.
+func Open(path string, params Params) (*DB, error) {
+	if err := params.Layout.validate(); err != nil {
+		return nil, err
+	}
+
+	db := &DB{
+		path:   path,
+		params: params,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if _, err := db.reload(true); err != nil {
+		return nil, err
+	}
+
+	if params.ReloadInterval > 0 {
+		go db.watch()
+	} else {
+		close(db.done)
+	}
+
+	return db, nil
+}
+
+// Load creates DB from the CSV data. Such DB cannot be reloaded.
+func Load(r io.Reader, layout Layout) (*DB, error) {
+	if err := layout.validate(); err != nil {
+		return nil, err
+	}
+
+	idx, err := load(r, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{
+		params: Params{Layout: layout},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	db.index.Store(idx)
+	close(db.done)
+
+	return db, nil
+}
+
+// Close stops watching the file for changes.
+func (db *DB) Close() error {
+	db.stopOnce.Do(func() {
+		close(db.stop)
+	})
+
+	<-db.done
+
+	return nil
+}
+
+// Reload loads the file again if it has been changed since the last load.
+func (db *DB) Reload() error {
+	if db.path == "" {
+		return errors.New("cannot reload database not opened from file")
+	}
+
+	_, err := db.reload(false)
+
+	return err
+}
+
+// watch periodically reloads the file until Close is called.
+func (db *DB) watch() {
+	defer close(db.done)
+
+	ticker := time.NewTicker(db.params.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+			if _, err := db.reload(false); err != nil && db.params.ReloadErrorHandler != nil {
+				db.params.ReloadErrorHandler(err)
+			}
+		}
+	}
+}
+
+// reload loads the file if forced or if its modification time or size has changed.
+func (db *DB) reload(force bool) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot read database: %w", err)
+	}
+
+	if !force && info.ModTime().Equal(db.modTime) && info.Size() == db.size {
+		return false, nil
+	}
+
+	f, err := os.Open(db.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot read database: %w", err)
+	}
+	defer f.Close()
+
+	idx, err := load(f, db.params.Layout)
+	if err != nil {
+		return false, err
+	}
+
+	db.index.Store(idx)
+	db.modTime = info.ModTime()
+	db.size = info.Size()
+
+	return true, nil
+}
+
+// load reads the CSV data and builds the index.
+func load(r io.Reader, layout Layout) (index, error) {
+	reader := csv.NewReader(r)
+
+	if layout.Comma != 0 {
+		reader.Comma = layout.Comma
+	}
+
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+
+	var idx index
+
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse database: %w", err)
+		}
+
+		if line == 1 && layout.Header {
+			continue
+		}
+
+		r, err := layout.parseRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse database: line %d: %w", line, err)
+		}
+
+		idx = append(idx, r)
+	}
+
+	sort.Slice(idx, func(i, j int) bool {
+		return compareIP(idx[i].start, idx[j].start) < 0
+	})
+
+	return idx, nil
+}
+
+// Lookup returns the record for the IP address. The IP field is set to the address looked up.
+func (db *DB) Lookup(ip net.IP) (*simplegeoip.GeoIPResponse, error) {
+	key := ip.To16()
+	if key == nil {
+		return nil, &simplegeoip.ArgError{Name: "ip", Message: "is not a valid IP address"}
+	}
+
+	idx := db.index.Load().(index)
+
+	// the first range starting after the address is right behind the one that may contain it
+	i := sort.Search(len(idx), func(i int) bool {
+		return compareIP(idx[i].start, key) > 0
+	})
+	if i == 0 || compareIP(idx[i-1].end, key) < 0 {
+		return nil, simplegeoip.ErrNotFound
+	}
+
+	resp := *idx[i-1].resp
+	resp.IP = ip.String()
+
+	return &resp, nil
+}
+
+// Len returns the number of loaded IP ranges.
+func (db *DB) Len() int {
+	return len(db.index.Load().(index))
+}
+
+// lookupOptions returns the IP address to look up from the options.
+func lookupOptions(opts []simplegeoip.Option) (net.IP, url.Values, error) {
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+
+	for _, name := range []string{"domain", "email"} {
+		if query.Get(name) != "" {
+			return nil, query, &simplegeoip.ArgError{Name: name, Message: "is not supported by offline database"}
+		}
+	}
+
+	value := query.Get("ipAddress")
+	if value == "" {
+		return nil, query, &simplegeoip.ArgError{Name: "ipAddress", Message: "is required by offline database"}
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, query, &simplegeoip.ArgError{Name: "ipAddress", Message: "is not a valid IP address"}
+	}
+
+	return ip, query, nil
+}
+
+// Get returns the record for the IP address set with OptionIPAddress. Response contains the record as JSON.
+func (db *DB) Get(
+	ctx context.Context,
+	opts ...simplegeoip.Option,
+) (geoipResponse *simplegeoip.GeoIPResponse, resp *simplegeoip.Response, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	ip, _, err := lookupOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	geoipResponse, err = db.Lookup(ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := json.Marshal(geoipResponse)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return geoipResponse, &simplegeoip.Response{Body: body}, nil
+}
+
+// GetRaw returns the record for the IP address set with OptionIPAddress as JSON.
+func (db *DB) GetRaw(
+	ctx context.Context,
+	opts ...simplegeoip.Option,
+) (resp *simplegeoip.Response, err error) {
+	ip, query, err := lookupOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if format := query.Get("outputFormat"); format != "" && !strings.EqualFold(format, "JSON") {
+		return nil, &simplegeoip.ArgError{Name: "outputFormat", Message: "is not supported by offline database"}
+	}
+
+	_, resp, err = db.Get(ctx, simplegeoip.OptionIPAddress(ip.String()))
+
+	return resp, err
+}
+
+// compareIP compares two 16 bytes long IP addresses.
+func compareIP(a, b net.IP) int {
+	return bytes.Compare(a.To16(), b.To16())
+}
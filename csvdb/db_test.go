@@ -0,0 +1,284 @@
+package csvdb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+const ip2asnData = "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+	"8.8.8.0\t8.8.8.255\t15169\tUS\tGOOGLE\n" +
+	"2001:4860::\t2001:4860:ffff:ffff:ffff:ffff:ffff:ffff\t15169\tUS\tGOOGLE\n"
+
+const ip2locationData = `"ip_from","ip_to","country_code","country_name","region_name","city_name","latitude","longitude","zip_code","time_zone"
+"134744064","134744319","US","United States of America","California","Mountain View","37.405992","-122.078515","94043","-07:00"
+"281470816487424","281470816487679","US","United States of America","California","Mountain View","37.405992","-122.078515","94043","-07:00"
+"42540766411282592856903984951653826560","42540766490510755371168322545197776895","DE","Germany","Berlin","Berlin","52.524370","13.410530","10178","+02:00"
+`
+
+// ip2locationIPv6Data is the sample of IP2Location DB*.IPV6.CSV files covering the whole address space,
+// IPv4 addresses are stored as IPv4-mapped IPv6 ones.
+const ip2locationIPv6Data = `"0","281470681743359","-","-","-","-","0.000000","0.000000","-","-"
+"281470681743360","281470816487423","-","-","-","-","0.000000","0.000000","-","-"
+"281470816487424","281470816487679","US","United States of America","California","Mountain View","37.405992","-122.078515","94043","-07:00"
+"281470816487680","42540766411282592856903984951653826559","-","-","-","-","0.000000","0.000000","-","-"
+"42540766411282592856903984951653826560","42540766490510755371168322545197776895","DE","Germany","Berlin","Berlin","52.524370","13.410530","10178","+02:00"
+`
+
+// TestLookup tests the lookups in the supported layouts.
+func TestLookup(t *testing.T) {
+	ip2asn, err := Load(strings.NewReader(ip2asnData), LayoutIP2ASN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout := LayoutIP2LocationDB11
+	layout.Header = true
+
+	ip2location, err := Load(strings.NewReader(ip2locationData), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip2locationIPv6, err := Load(strings.NewReader(ip2locationIPv6Data), LayoutIP2LocationDB11)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		ip      string
+		country string
+		city    string
+		asn     int
+		wantErr error
+	}{
+		{
+			name:    "ip2asn IPv4 range start",
+			db:      ip2asn,
+			ip:      "1.0.0.0",
+			country: "US",
+			asn:     13335,
+		},
+		{
+			name:    "ip2asn IPv4 range end",
+			db:      ip2asn,
+			ip:      "8.8.8.255",
+			country: "US",
+			asn:     15169,
+		},
+		{
+			name: "ip2asn unknown values",
+			db:   ip2asn,
+			ip:   "1.0.2.1",
+		},
+		{
+			name:    "ip2asn gap between ranges",
+			db:      ip2asn,
+			ip:      "8.8.4.4",
+			wantErr: simplegeoip.ErrNotFound,
+		},
+		{
+			name:    "ip2asn IPv6",
+			db:      ip2asn,
+			ip:      "2001:4860:4860::8888",
+			country: "US",
+			asn:     15169,
+		},
+		{
+			name:    "ip2asn before first range",
+			db:      ip2asn,
+			ip:      "0.0.0.1",
+			wantErr: simplegeoip.ErrNotFound,
+		},
+		{
+			name:    "ip2location IPv4 decimal",
+			db:      ip2location,
+			ip:      "8.8.8.8",
+			country: "US",
+			city:    "Mountain View",
+		},
+		{
+			name:    "ip2location IPv6 decimal",
+			db:      ip2location,
+			ip:      "2001:db8::1",
+			country: "DE",
+			city:    "Berlin",
+		},
+		{
+			name:    "ip2location after last range",
+			db:      ip2location,
+			ip:      "2001:db9::1",
+			wantErr: simplegeoip.ErrNotFound,
+		},
+		{
+			name:    "ip2location IPv6 file IPv4",
+			db:      ip2locationIPv6,
+			ip:      "8.8.8.8",
+			country: "US",
+			city:    "Mountain View",
+		},
+		{
+			name: "ip2location IPv6 file unknown IPv4",
+			db:   ip2locationIPv6,
+			ip:   "1.1.1.1",
+		},
+		{
+			name:    "ip2location IPv6 file IPv6",
+			db:      ip2locationIPv6,
+			ip:      "2001:db8::1",
+			country: "DE",
+			city:    "Berlin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := tt.db.Get(context.Background(), simplegeoip.OptionIPAddress(tt.ip))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.IP != tt.ip || got.Location.Country != tt.country ||
+				got.Location.City != tt.city || got.AS.ASN != tt.asn {
+				t.Errorf("Get() got = %+v", got)
+			}
+		})
+	}
+}
+
+// TestGetArguments tests the option validation.
+func TestGetArguments(t *testing.T) {
+	db, err := Load(strings.NewReader(ip2asnData), LayoutIP2ASN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []simplegeoip.Option
+		wantErr string
+	}{
+		{
+			name:    "no IP address",
+			wantErr: `invalid argument: "ipAddress" is required by offline database`,
+		},
+		{
+			name:    "invalid IP address",
+			opts:    []simplegeoip.Option{simplegeoip.OptionIPAddress("8.8.8")},
+			wantErr: `invalid argument: "ipAddress" is not a valid IP address`,
+		},
+		{
+			name:    "domain",
+			opts:    []simplegeoip.Option{simplegeoip.OptionDomain("whoisxmlapi.com")},
+			wantErr: `invalid argument: "domain" is not supported by offline database`,
+		},
+		{
+			name: "XML output",
+			opts: []simplegeoip.Option{
+				simplegeoip.OptionIPAddress("8.8.8.8"),
+				simplegeoip.OptionOutputFormat("XML"),
+			},
+			wantErr: `invalid argument: "outputFormat" is not supported by offline database`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.GetRaw(context.Background(), tt.opts...)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("GetRaw() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestReload tests the hot reload of the changed file.
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if err := os.WriteFile(path, []byte(ip2asnData), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(path, Params{Layout: LayoutIP2ASN, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if db.Len() != 4 {
+		t.Fatalf("Len() = %d, want 4", db.Len())
+	}
+
+	updated := ip2asnData + "9.9.9.0\t9.9.9.255\t19281\tUS\tQUAD9-AS-1\n"
+	if err := os.WriteFile(path, []byte(updated), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for db.Len() != 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("file has not been reloaded")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	got, err := db.Lookup(net.ParseIP("9.9.9.9"))
+	if err != nil || got.AS.ASN != 19281 {
+		t.Errorf("Lookup() got = %+v, error = %v", got, err)
+	}
+}
+
+// TestLoadErrors tests the CSV validation.
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		layout  Layout
+		wantErr string
+	}{
+		{
+			name:    "no IP columns",
+			layout:  Layout{Columns: []Field{FieldCountry}},
+			wantErr: `invalid argument: "Layout.Columns" must contain start and end IP columns`,
+		},
+		{
+			name:    "invalid IP",
+			data:    "1.0.0.0\tlocalhost\t13335\tUS\tCLOUDFLARENET\n",
+			layout:  LayoutIP2ASN,
+			wantErr: `cannot parse database: line 1: column 2: invalid IP address "localhost"`,
+		},
+		{
+			name:    "reversed range",
+			data:    "1.0.0.255\t1.0.0.0\t13335\tUS\tCLOUDFLARENET\n",
+			layout:  LayoutIP2ASN,
+			wantErr: "cannot parse database: line 1: start IP 1.0.0.255 is greater than end IP 1.0.0.0",
+		},
+		{
+			name:    "missing columns",
+			data:    "1.0.0.0\t1.0.0.255\n",
+			layout:  LayoutIP2ASN,
+			wantErr: "cannot parse database: line 1: expected 5 columns, got 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(tt.data), tt.layout)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
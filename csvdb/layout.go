@@ -0,0 +1,268 @@
+package csvdb
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// Field is the meaning of a CSV column.
+type Field int
+
+// Fields supported in CSV columns.
+const (
+	// FieldSkip marks the column to be ignored.
+	FieldSkip Field = iota
+
+	// FieldStartIP is the first IP address of the range, either in text or decimal form.
+	FieldStartIP
+
+	// FieldEndIP is the last IP address of the range, either in text or decimal form.
+	FieldEndIP
+
+	// FieldCountry is the two letters country code.
+	FieldCountry
+
+	// FieldRegion is the region name.
+	FieldRegion
+
+	// FieldCity is the city name.
+	FieldCity
+
+	// FieldLat is the latitude.
+	FieldLat
+
+	// FieldLng is the longitude.
+	FieldLng
+
+	// FieldPostalCode is the postal code.
+	FieldPostalCode
+
+	// FieldTimezone is the timezone in the format "+10:00".
+	FieldTimezone
+
+	// FieldGeonameID is the ID of location in the GeoNames database.
+	FieldGeonameID
+
+	// FieldISP is the internet service provider.
+	FieldISP
+
+	// FieldConnectionType is the connection type.
+	FieldConnectionType
+
+	// FieldASN is the autonomous system number.
+	FieldASN
+
+	// FieldASName is the autonomous system name.
+	FieldASName
+
+	// FieldASDomain is the autonomous system website's URL.
+	FieldASDomain
+
+	// FieldASType is the autonomous system type.
+	FieldASType
+)
+
+// Layout describes the columns of CSV file.
+type Layout struct {
+	// Columns is the meaning of each column in order. FieldStartIP and FieldEndIP are mandatory
+	Columns []Field
+
+	// Comma is the field delimiter. Default: ','
+	Comma rune
+
+	// Header is true if the first line contains column names and must be skipped
+	Header bool
+}
+
+// LayoutIP2ASN is the layout of ip2asn-combined.tsv from iptoasn.com.
+var LayoutIP2ASN = Layout{
+	Columns: []Field{FieldStartIP, FieldEndIP, FieldASN, FieldCountry, FieldASName},
+	Comma:   '\t',
+}
+
+// LayoutIP2LocationDB1 is the layout of IP2Location DB1 (country) CSV files.
+var LayoutIP2LocationDB1 = Layout{
+	Columns: []Field{FieldStartIP, FieldEndIP, FieldCountry, FieldSkip},
+}
+
+// LayoutIP2LocationDB11 is the layout of IP2Location DB11 (country, region, city, coordinates,
+// postal code and timezone) CSV files.
+var LayoutIP2LocationDB11 = Layout{
+	Columns: []Field{
+		FieldStartIP, FieldEndIP, FieldCountry, FieldSkip, FieldRegion, FieldCity,
+		FieldLat, FieldLng, FieldPostalCode, FieldTimezone,
+	},
+}
+
+// validate checks that the layout can be used for loading.
+func (l Layout) validate() error {
+	var start, end bool
+
+	for _, field := range l.Columns {
+		switch field {
+		case FieldStartIP:
+			start = true
+		case FieldEndIP:
+			end = true
+		}
+	}
+
+	if !start || !end {
+		return &simplegeoip.ArgError{Name: "Layout.Columns", Message: "must contain start and end IP columns"}
+	}
+
+	return nil
+}
+
+// parseRow converts the CSV row to the IP range.
+func (l Layout) parseRow(row []string) (ipRange, error) {
+	var r ipRange
+
+	if len(row) < len(l.Columns) {
+		return r, fmt.Errorf("expected %d columns, got %d", len(l.Columns), len(row))
+	}
+
+	resp := &simplegeoip.GeoIPResponse{}
+
+	// decimal bounds are converted after both are parsed, see decimalRange
+	var startN, endN *big.Int
+
+	for i, field := range l.Columns {
+		value := strings.TrimSpace(row[i])
+
+		// unknown values are usually written as "-" or "None"
+		if value == "-" || value == "None" {
+			value = ""
+		}
+
+		var err error
+
+		switch field {
+		case FieldStartIP:
+			r.start, startN, err = parseIP(value)
+		case FieldEndIP:
+			r.end, endN, err = parseIP(value)
+		case FieldCountry:
+			resp.Location.Country = value
+		case FieldRegion:
+			resp.Location.Region = value
+		case FieldCity:
+			resp.Location.City = value
+		case FieldLat:
+			resp.Location.Lat, err = parseFloat(value)
+		case FieldLng:
+			resp.Location.Lng, err = parseFloat(value)
+		case FieldPostalCode:
+			resp.Location.PostalCode = value
+		case FieldTimezone:
+			resp.Location.Timezone = value
+		case FieldGeonameID:
+			var id uint64
+
+			id, err = parseUint(value)
+			resp.Location.GeonameID = uint(id)
+		case FieldISP:
+			resp.ISP = value
+		case FieldConnectionType:
+			resp.ConnectionType = value
+		case FieldASN:
+			var asn uint64
+
+			asn, err = parseUint(strings.TrimPrefix(strings.ToUpper(value), "AS"))
+			resp.AS.ASN = int(asn)
+		case FieldASName:
+			resp.AS.Name = value
+		case FieldASDomain:
+			resp.AS.Domain = value
+		case FieldASType:
+			resp.AS.Type = value
+		}
+
+		if err != nil {
+			return r, fmt.Errorf("column %d: %w", i+1, err)
+		}
+	}
+
+	decimalRange(&r, startN, endN)
+
+	if compareIP(r.start, r.end) > 0 {
+		return r, fmt.Errorf("start IP %s is greater than end IP %s", r.start, r.end)
+	}
+
+	r.resp = resp
+
+	return r, nil
+}
+
+// decimalRange sets bounds of the range given in decimal form. The address family is chosen once
+// by the larger bound, so rows of IPv6 files starting with small numbers like "0" aren't mistaken
+// for IPv4 ones.
+func decimalRange(r *ipRange, startN, endN *big.Int) {
+	ipv4 := true
+
+	for _, n := range []*big.Int{startN, endN} {
+		if n != nil && n.BitLen() > 32 {
+			ipv4 = false
+		}
+	}
+
+	if startN != nil {
+		r.start = decimalIP(startN, ipv4)
+	}
+
+	if endN != nil {
+		r.end = decimalIP(endN, ipv4)
+	}
+}
+
+// parseIP parses the IP address in text form, or returns the number if it's in decimal form.
+func parseIP(value string) (net.IP, *big.Int, error) {
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.To16(), nil, nil
+	}
+
+	n, ok := new(big.Int).SetString(value, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return nil, nil, fmt.Errorf("invalid IP address %q", value)
+	}
+
+	return nil, n, nil
+}
+
+// decimalIP returns the 16 bytes long IP address of the number. IPv4 numbers are converted
+// to IPv4-mapped IPv6 addresses.
+func decimalIP(n *big.Int, ipv4 bool) net.IP {
+	if ipv4 {
+		v := n.Uint64()
+
+		return net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v)).To16()
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	n.FillBytes(ip)
+
+	return ip
+}
+
+// parseFloat parses the float value treating empty strings as zero.
+func parseFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
+
+// parseUint parses the unsigned integer value treating empty strings as zero.
+func parseUint(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
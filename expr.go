@@ -0,0 +1,546 @@
+package simplegeoip
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Expr is the compiled rule expression evaluated against lookup results, e.g.
+//
+//	location.country in ["US", "CA"] && as.type != "Content"
+//
+// Fields are named after the JSON response: ip, isp, connectionType, domains, location.country,
+// location.region, location.city, location.lat, location.lng, location.postalCode, location.timezone,
+// location.geonameId, as.asn, as.name, as.route, as.domain and as.type. Values are strings in double quotes,
+// numbers, true, false and lists of strings or numbers in square brackets.
+//
+// Operators are "==", "!=", "<", "<=", ">", ">=" for numbers, "in" and "not in" for lists, "contains",
+// "startsWith", "endsWith" and "matches" (RE2 regular expression) for strings, "contains" for domains,
+// "!", "&&", "||" and parentheses. Strings are compared case-sensitively.
+//
+// The expression is type-checked when it's compiled, and it cannot call functions or loop, so Eval is fast,
+// doesn't allocate, and is safe for concurrent use.
+type Expr struct {
+	src  string
+	eval func(*GeoIPResponse) bool
+}
+
+// ExprError is the error of compiling the expression.
+type ExprError struct {
+	// Expr is the source of the expression
+	Expr string
+
+	// Pos is the byte offset of the error in the expression
+	Pos int
+
+	// Message describes the error
+	Message string
+}
+
+// Error returns the error message with the column of the error.
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("invalid expression at column %d: %s", e.Pos+1, e.Message)
+}
+
+// Snippet returns the expression and the line pointing at the error with the caret, e.g.
+//
+//	location.contry == "US"
+//	^
+func (e *ExprError) Snippet() string {
+	return e.Expr + "\n" + strings.Repeat(" ", e.Pos) + "^"
+}
+
+// CompileExpr parses and type-checks the expression. The expression must be a condition.
+func CompileExpr(src string) (*Expr, error) {
+	node, err := parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &exprCompiler{src: src}
+
+	value, err := c.compile(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if value.typ != exprBool {
+		return nil, c.errorf(0, "the expression is %s, not a condition", value.typ)
+	}
+
+	return &Expr{src: src, eval: value.boolFn}, nil
+}
+
+// Eval reports whether the lookup result matches the expression. The nil result has empty fields.
+func (e *Expr) Eval(resp *GeoIPResponse) bool {
+	if resp == nil {
+		resp = &GeoIPResponse{}
+	}
+
+	return e.eval(resp)
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// exprType is the type of the expression value.
+type exprType int
+
+// Types of expression values.
+const (
+	exprBool exprType = iota + 1
+	exprNumber
+	exprString
+	exprStringList
+)
+
+// String returns the type name used in error messages.
+func (t exprType) String() string {
+	switch t {
+	case exprBool:
+		return "a bool"
+	case exprNumber:
+		return "a number"
+	case exprString:
+		return "a string"
+	case exprStringList:
+		return "a list of strings"
+	}
+
+	return "unknown"
+}
+
+// exprValue is the compiled value, the function of its type is set.
+type exprValue struct {
+	typ      exprType
+	boolFn   func(*GeoIPResponse) bool
+	numberFn func(*GeoIPResponse) float64
+	stringFn func(*GeoIPResponse) string
+	listFn   func(*GeoIPResponse) []string
+}
+
+// exprFields are response fields available in expressions.
+var exprFields = map[string]exprValue{
+	"ip":             exprStringField(func(r *GeoIPResponse) string { return r.IP }),
+	"isp":            exprStringField(func(r *GeoIPResponse) string { return r.ISP }),
+	"connectionType": exprStringField(func(r *GeoIPResponse) string { return r.ConnectionType }),
+	"domains": {
+		typ:    exprStringList,
+		listFn: func(r *GeoIPResponse) []string { return r.Domains },
+	},
+	"location.country":    exprStringField(func(r *GeoIPResponse) string { return r.Location.Country }),
+	"location.region":     exprStringField(func(r *GeoIPResponse) string { return r.Location.Region }),
+	"location.city":       exprStringField(func(r *GeoIPResponse) string { return r.Location.City }),
+	"location.lat":        exprNumberField(func(r *GeoIPResponse) float64 { return r.Location.Lat }),
+	"location.lng":        exprNumberField(func(r *GeoIPResponse) float64 { return r.Location.Lng }),
+	"location.postalCode": exprStringField(func(r *GeoIPResponse) string { return r.Location.PostalCode }),
+	"location.timezone":   exprStringField(func(r *GeoIPResponse) string { return r.Location.Timezone }),
+	"location.geonameId":  exprNumberField(func(r *GeoIPResponse) float64 { return float64(r.Location.GeonameID) }),
+	"as.asn":              exprNumberField(func(r *GeoIPResponse) float64 { return float64(r.AS.ASN) }),
+	"as.name":             exprStringField(func(r *GeoIPResponse) string { return r.AS.Name }),
+	"as.route":            exprStringField(func(r *GeoIPResponse) string { return r.AS.Route }),
+	"as.domain":           exprStringField(func(r *GeoIPResponse) string { return r.AS.Domain }),
+	"as.type":             exprStringField(func(r *GeoIPResponse) string { return r.AS.Type }),
+}
+
+// exprStringField returns the string field value.
+func exprStringField(fn func(*GeoIPResponse) string) exprValue {
+	return exprValue{typ: exprString, stringFn: fn}
+}
+
+// exprNumberField returns the number field value.
+func exprNumberField(fn func(*GeoIPResponse) float64) exprValue {
+	return exprValue{typ: exprNumber, numberFn: fn}
+}
+
+// exprCompiler type-checks the syntax tree and compiles it into functions.
+type exprCompiler struct {
+	src string
+}
+
+// errorf returns ExprError at the offset.
+func (c *exprCompiler) errorf(pos int, format string, args ...interface{}) error {
+	return &ExprError{Expr: c.src, Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// compile compiles the node.
+func (c *exprCompiler) compile(node exprNode) (exprValue, error) {
+	switch node := node.(type) {
+	case *exprLiteral:
+		return compileLiteral(node.value), nil
+	case *exprFieldRef:
+		value, ok := exprFields[node.name]
+		if !ok {
+			message := fmt.Sprintf("unknown field %q", node.name)
+			if suggestion := suggestExprField(node.name); suggestion != "" {
+				message += fmt.Sprintf(", did you mean %q?", suggestion)
+			}
+
+			return exprValue{}, c.errorf(node.pos, "%s", message)
+		}
+
+		return value, nil
+	case *exprList:
+		return exprValue{}, c.errorf(node.pos, "a list is allowed only after %q", "in")
+	case *exprNot:
+		operand, err := c.compileBool(node.operand, "!")
+		if err != nil {
+			return exprValue{}, err
+		}
+
+		fn := operand.boolFn
+
+		return exprValue{typ: exprBool, boolFn: func(r *GeoIPResponse) bool { return !fn(r) }}, nil
+	case *exprBinary:
+		return c.compileBinary(node)
+	}
+
+	return exprValue{}, c.errorf(node.position(), "unsupported expression")
+}
+
+// compileLiteral returns the constant value.
+func compileLiteral(value interface{}) exprValue {
+	switch value := value.(type) {
+	case string:
+		return exprValue{typ: exprString, stringFn: func(*GeoIPResponse) string { return value }}
+	case float64:
+		return exprValue{typ: exprNumber, numberFn: func(*GeoIPResponse) float64 { return value }}
+	}
+
+	b, _ := value.(bool)
+
+	return exprValue{typ: exprBool, boolFn: func(*GeoIPResponse) bool { return b }}
+}
+
+// compileBool compiles the operand of the logical operator.
+func (c *exprCompiler) compileBool(node exprNode, op string) (exprValue, error) {
+	value, err := c.compile(node)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	if value.typ != exprBool {
+		return exprValue{}, c.errorf(node.position(), "operand of %q is %s, not a condition", op, value.typ)
+	}
+
+	return value, nil
+}
+
+// compileBinary compiles the binary operation.
+func (c *exprCompiler) compileBinary(node *exprBinary) (exprValue, error) {
+	switch node.op {
+	case "&&", "||":
+		return c.compileLogical(node)
+	case "in", "not in":
+		return c.compileIn(node)
+	}
+
+	left, err := c.compile(node.left)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	switch node.op {
+	case "matches":
+		return c.compileMatches(node, left)
+	case "contains", "startsWith", "endsWith":
+		right, err := c.compile(node.right)
+		if err != nil {
+			return exprValue{}, err
+		}
+
+		return c.compileStringOp(node, left, right)
+	}
+
+	right, err := c.compile(node.right)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	if left.typ != right.typ || left.typ == exprStringList {
+		return exprValue{}, c.errorf(node.pos, "cannot compare %s with %s", left.typ, right.typ)
+	}
+
+	if node.op != "==" && node.op != "!=" && left.typ != exprNumber {
+		return exprValue{}, c.errorf(node.pos, "%q compares numbers, not %s", node.op, left.typ)
+	}
+
+	fn := compileComparison(node.op, left, right)
+
+	return exprValue{typ: exprBool, boolFn: fn}, nil
+}
+
+// compileLogical compiles "&&" and "||".
+func (c *exprCompiler) compileLogical(node *exprBinary) (exprValue, error) {
+	left, err := c.compileBool(node.left, node.op)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	right, err := c.compileBool(node.right, node.op)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	l, r := left.boolFn, right.boolFn
+
+	if node.op == "&&" {
+		return exprValue{typ: exprBool, boolFn: func(resp *GeoIPResponse) bool { return l(resp) && r(resp) }}, nil
+	}
+
+	return exprValue{typ: exprBool, boolFn: func(resp *GeoIPResponse) bool { return l(resp) || r(resp) }}, nil
+}
+
+// compileComparison returns the comparison of values of the same type.
+func compileComparison(op string, left, right exprValue) func(*GeoIPResponse) bool {
+	switch left.typ {
+	case exprString:
+		l, r := left.stringFn, right.stringFn
+		if op == "==" {
+			return func(resp *GeoIPResponse) bool { return l(resp) == r(resp) }
+		}
+
+		return func(resp *GeoIPResponse) bool { return l(resp) != r(resp) }
+	case exprBool:
+		l, r := left.boolFn, right.boolFn
+		if op == "==" {
+			return func(resp *GeoIPResponse) bool { return l(resp) == r(resp) }
+		}
+
+		return func(resp *GeoIPResponse) bool { return l(resp) != r(resp) }
+	}
+
+	l, r := left.numberFn, right.numberFn
+
+	switch op {
+	case "==":
+		return func(resp *GeoIPResponse) bool { return l(resp) == r(resp) }
+	case "!=":
+		return func(resp *GeoIPResponse) bool { return l(resp) != r(resp) }
+	case "<":
+		return func(resp *GeoIPResponse) bool { return l(resp) < r(resp) }
+	case "<=":
+		return func(resp *GeoIPResponse) bool { return l(resp) <= r(resp) }
+	case ">":
+		return func(resp *GeoIPResponse) bool { return l(resp) > r(resp) }
+	}
+
+	return func(resp *GeoIPResponse) bool { return l(resp) >= r(resp) }
+}
+
+// compileIn compiles "in" and "not in" with the list literal or the list field on the right.
+func (c *exprCompiler) compileIn(node *exprBinary) (exprValue, error) {
+	left, err := c.compile(node.left)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	var fn func(*GeoIPResponse) bool
+
+	if list, ok := node.right.(*exprList); ok {
+		fn, err = c.compileInList(node, left, list)
+		if err != nil {
+			return exprValue{}, err
+		}
+	} else {
+		right, err := c.compile(node.right)
+		if err != nil {
+			return exprValue{}, err
+		}
+
+		if right.typ != exprStringList {
+			return exprValue{}, c.errorf(node.right.position(), "%q needs a list, not %s", node.op, right.typ)
+		}
+
+		if left.typ != exprString {
+			return exprValue{}, c.errorf(node.pos, "cannot look for %s in %s", left.typ, right.typ)
+		}
+
+		fn = containsFn(right.listFn, left.stringFn)
+	}
+
+	if node.op == "not in" {
+		in := fn
+		fn = func(resp *GeoIPResponse) bool { return !in(resp) }
+	}
+
+	return exprValue{typ: exprBool, boolFn: fn}, nil
+}
+
+// compileInList compiles the lookup in the list literal, the list is turned into the set.
+func (c *exprCompiler) compileInList(node *exprBinary, left exprValue, list *exprList) (func(*GeoIPResponse) bool, error) {
+	switch left.typ {
+	case exprString:
+		set := make(map[string]struct{}, len(list.items))
+
+		for _, item := range list.items {
+			s, ok := item.value.(string)
+			if !ok {
+				return nil, c.errorf(item.pos, "list of strings contains %s", compileLiteral(item.value).typ)
+			}
+
+			set[s] = struct{}{}
+		}
+
+		l := left.stringFn
+
+		return func(resp *GeoIPResponse) bool {
+			_, ok := set[l(resp)]
+
+			return ok
+		}, nil
+	case exprNumber:
+		set := make(map[float64]struct{}, len(list.items))
+
+		for _, item := range list.items {
+			n, ok := item.value.(float64)
+			if !ok {
+				return nil, c.errorf(item.pos, "list of numbers contains %s", compileLiteral(item.value).typ)
+			}
+
+			set[n] = struct{}{}
+		}
+
+		l := left.numberFn
+
+		return func(resp *GeoIPResponse) bool {
+			_, ok := set[l(resp)]
+
+			return ok
+		}, nil
+	}
+
+	return nil, c.errorf(node.pos, "cannot look for %s in the list", left.typ)
+}
+
+// compileStringOp compiles "contains", "startsWith" and "endsWith", "contains" also checks domains.
+func (c *exprCompiler) compileStringOp(node *exprBinary, left, right exprValue) (exprValue, error) {
+	if right.typ != exprString {
+		return exprValue{}, c.errorf(node.right.position(), "%q needs a string, not %s", node.op, right.typ)
+	}
+
+	if left.typ == exprStringList && node.op == "contains" {
+		return exprValue{typ: exprBool, boolFn: containsFn(left.listFn, right.stringFn)}, nil
+	}
+
+	if left.typ != exprString {
+		return exprValue{}, c.errorf(node.left.position(), "%q applies to strings, not %s", node.op, left.typ)
+	}
+
+	l, r := left.stringFn, right.stringFn
+
+	var fn func(*GeoIPResponse) bool
+
+	switch node.op {
+	case "contains":
+		fn = func(resp *GeoIPResponse) bool { return strings.Contains(l(resp), r(resp)) }
+	case "startsWith":
+		fn = func(resp *GeoIPResponse) bool { return strings.HasPrefix(l(resp), r(resp)) }
+	default:
+		fn = func(resp *GeoIPResponse) bool { return strings.HasSuffix(l(resp), r(resp)) }
+	}
+
+	return exprValue{typ: exprBool, boolFn: fn}, nil
+}
+
+// compileMatches compiles "matches", the regular expression must be the string literal.
+func (c *exprCompiler) compileMatches(node *exprBinary, left exprValue) (exprValue, error) {
+	if left.typ != exprString {
+		return exprValue{}, c.errorf(node.left.position(), "%q applies to strings, not %s", node.op, left.typ)
+	}
+
+	literal, ok := node.right.(*exprLiteral)
+
+	pattern, isString := "", false
+	if ok {
+		pattern, isString = literal.value.(string)
+	}
+
+	if !isString {
+		return exprValue{}, c.errorf(node.right.position(), "%q needs a regular expression in quotes", node.op)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return exprValue{}, c.errorf(literal.pos, "invalid regular expression: %v", err)
+	}
+
+	l := left.stringFn
+
+	return exprValue{typ: exprBool, boolFn: func(resp *GeoIPResponse) bool { return re.MatchString(l(resp)) }}, nil
+}
+
+// containsFn returns the function reporting whether the list contains the value.
+func containsFn(list func(*GeoIPResponse) []string, value func(*GeoIPResponse) string) func(*GeoIPResponse) bool {
+	return func(resp *GeoIPResponse) bool {
+		v := value(resp)
+
+		for _, item := range list(resp) {
+			if item == v {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// suggestExprField returns the known field similar to the unknown name or the empty string.
+func suggestExprField(name string) string {
+	names := make([]string, 0, len(exprFields))
+	for field := range exprFields {
+		names = append(names, field)
+	}
+
+	sort.Strings(names)
+
+	lower := strings.ToLower(name)
+
+	// the field is named without its object, e.g. "country"
+	for _, field := range names {
+		if strings.HasSuffix(strings.ToLower(field), "."+lower) {
+			return field
+		}
+	}
+
+	best, bestDistance := "", len(name)/3+1
+
+	for _, field := range names {
+		if d := editDistance(lower, strings.ToLower(field)); d < bestDistance {
+			best, bestDistance = field, d
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the Levenshtein distance between the strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
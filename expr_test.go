@@ -0,0 +1,227 @@
+package simplegeoip
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newExprResponse returns the lookup result of the hosting provider in Ashburn.
+func newExprResponse() *GeoIPResponse {
+	resp := &GeoIPResponse{
+		IP:             "52.0.0.1",
+		ISP:            "Amazon.com, Inc.",
+		ConnectionType: "company",
+		Domains:        []string{"amazonaws.com", "aws.amazon.com"},
+	}
+
+	resp.Location.Country = "US"
+	resp.Location.Region = "Virginia"
+	resp.Location.City = "Ashburn"
+	resp.Location.Lat = 39.04
+	resp.Location.Lng = -77.49
+	resp.Location.GeonameID = 4744870
+	resp.AS.ASN = 16509
+	resp.AS.Name = "AMAZON-02"
+	resp.AS.Type = "Content"
+
+	return resp
+}
+
+// TestCompileExpr tests evaluation of expressions.
+func TestCompileExpr(t *testing.T) {
+	resp := newExprResponse()
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: `location.country in ["US", "CA"] && as.type != "Content"`, want: false},
+		{expr: `location.country in ["US", "CA"] && !(as.type != "Content")`, want: true},
+		{expr: `location.country not in ["US"] || as.asn == 16509`, want: true},
+		{expr: `as.asn in [16509, 14618]`, want: true},
+		{expr: `location.lat > 39 && location.lat <= 39.04 && location.lng < -77`, want: true},
+		{expr: `location.lng >= -77`, want: false},
+		{expr: `location.geonameId != 4744870`, want: false},
+		{expr: `isp contains "Amazon" && as.name startsWith "AMAZON" && ip endsWith ".1"`, want: true},
+		{expr: `as.name matches "^AMAZON-0[12]$"`, want: true},
+		{expr: `domains contains "amazonaws.com" && "aws.amazon.com" in domains`, want: true},
+		{expr: `"example.com" not in domains`, want: true},
+		{expr: `true && (false || connectionType == "company")`, want: true},
+		{expr: `location.postalCode == "" && location.timezone == "" && as.route == "" && as.domain == ""`, want: true},
+		{expr: `location.region == "Virginia\t"`, want: false},
+		{expr: `location.country in []`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := CompileExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := expr.Eval(resp); got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+
+			if expr.String() != tt.expr {
+				t.Errorf("String() = %q, want %q", expr.String(), tt.expr)
+			}
+		})
+	}
+
+	expr, err := CompileExpr(`location.country == ""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !expr.Eval(nil) {
+		t.Error("Eval(nil) = false, want the empty result")
+	}
+}
+
+// TestCompileExprErrors tests compile errors.
+func TestCompileExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: ``, want: "invalid expression at column 1: empty expression"},
+		{
+			expr: `location.contry == "US"`,
+			want: `invalid expression at column 1: unknown field "location.contry", did you mean "location.country"?`,
+		},
+		{
+			expr: `country == "US"`,
+			want: `invalid expression at column 1: unknown field "country", did you mean "location.country"?`,
+		},
+		{expr: `foo == "US"`, want: `invalid expression at column 1: unknown field "foo"`},
+		{expr: `location.country = "US"`, want: `invalid expression at column 18: unexpected character '=', use "==" to compare`},
+		{expr: `location.country == 'US'`, want: `invalid expression at column 21: unexpected character '\'', strings are quoted with '"'`},
+		{expr: `location.country == "US`, want: "invalid expression at column 21: unterminated string"},
+		{expr: `location.country == "\q"`, want: "invalid expression at column 21: invalid escape sequence in string"},
+		{expr: `as.asn == 1.2.3`, want: `invalid expression at column 11: invalid number "1.2.3"`},
+		{expr: `location.country == "US" and as.asn == 1`, want: `invalid expression at column 26: unexpected "and", expected "&&" or "||"`},
+		{expr: `location.country == "US" &&`, want: "invalid expression at column 28: unexpected end of expression, expected a field or a value"},
+		{expr: `(location.country == "US"`, want: `invalid expression at column 26: unexpected end of expression, expected ")"`},
+		{expr: `location.country in ["US" "CA"]`, want: `invalid expression at column 27: unexpected "\"CA\"", expected "," or "]"`},
+		{expr: `location.country in [US]`, want: `invalid expression at column 22: unexpected "US", expected a value`},
+		{expr: `not location.country == "US"`, want: `invalid expression at column 1: unexpected "not", use "!" to negate`},
+		{expr: `location.country not "US"`, want: `invalid expression at column 22: unexpected "\"US\"", expected "in" after "not"`},
+		{expr: `location.country`, want: "invalid expression at column 1: the expression is a string, not a condition"},
+		{expr: `location.country == 1`, want: "invalid expression at column 18: cannot compare a string with a number"},
+		{expr: `location.country < "US"`, want: `invalid expression at column 18: "<" compares numbers, not a string`},
+		{expr: `domains == "x"`, want: "invalid expression at column 9: cannot compare a list of strings with a string"},
+		{expr: `location.country in ["US", 1]`, want: "invalid expression at column 28: list of strings contains a number"},
+		{expr: `as.asn in [1, "2"]`, want: "invalid expression at column 15: list of numbers contains a string"},
+		{expr: `true in [true]`, want: "invalid expression at column 6: cannot look for a bool in the list"},
+		{expr: `"x" in location.country`, want: `invalid expression at column 8: "in" needs a list, not a string`},
+		{expr: `as.asn in domains`, want: "invalid expression at column 8: cannot look for a number in a list of strings"},
+		{expr: `as.asn == ["1"]`, want: `invalid expression at column 11: a list is allowed only after "in"`},
+		{expr: `as.asn contains "1"`, want: `invalid expression at column 1: "contains" applies to strings, not a number`},
+		{expr: `isp startsWith 1`, want: `invalid expression at column 16: "startsWith" needs a string, not a number`},
+		{expr: `isp matches as.name`, want: `invalid expression at column 13: "matches" needs a regular expression in quotes`},
+		{
+			expr: `isp matches "("`,
+			want: "invalid expression at column 13: invalid regular expression: error parsing regexp: missing closing ): `(`",
+		},
+		{expr: `!as.asn`, want: `invalid expression at column 2: operand of "!" is a number, not a condition`},
+		{expr: `as.asn && true`, want: `invalid expression at column 1: operand of "&&" is a number, not a condition`},
+		{expr: `location.country == "US" ==`, want: `invalid expression at column 26: unexpected "==", expected "&&" or "||"`},
+		{expr: `in == 1`, want: `invalid expression at column 1: unexpected "in", expected a field or a value`},
+		{expr: `location.country == "US" || or`, want: `invalid expression at column 29: unexpected "or", use "||"`},
+		{expr: `as.asn == -x`, want: `invalid expression at column 11: unexpected "-", expected a value`},
+		{expr: `as.asn == 1 ;`, want: `invalid expression at column 13: unexpected character ';'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := CompileExpr(tt.expr)
+			checkErr(t, err, tt.want)
+
+			var exprErr *ExprError
+			if err != nil && !errors.As(err, &exprErr) {
+				t.Errorf("CompileExpr() error is %T, want *ExprError", err)
+			}
+		})
+	}
+}
+
+// TestExprErrorSnippet tests pointing at the error.
+func TestExprErrorSnippet(t *testing.T) {
+	_, err := CompileExpr(`as.type == "Content" && location.contry == "US"`)
+
+	var exprErr *ExprError
+	if !errors.As(err, &exprErr) {
+		t.Fatalf("CompileExpr() error = %v, want *ExprError", err)
+	}
+
+	want := "as.type == \"Content\" && location.contry == \"US\"\n" + strings.Repeat(" ", 24) + "^"
+	if got := exprErr.Snippet(); got != want {
+		t.Errorf("Snippet() = \n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestExprFields tests that every response field is available in expressions.
+func TestExprFields(t *testing.T) {
+	var walk func(prefix string, typ reflect.Type)
+
+	walk = func(prefix string, typ reflect.Type) {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name := prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+
+			if field.Type.Kind() == reflect.Struct {
+				walk(name+".", field.Type)
+
+				continue
+			}
+
+			if _, ok := exprFields[name]; !ok {
+				t.Errorf("field %q is not available in expressions", name)
+			}
+		}
+	}
+
+	walk("", reflect.TypeOf(GeoIPResponse{}))
+}
+
+// TestExprAllocs tests that the evaluation doesn't allocate.
+func TestExprAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not stable with the race detector")
+	}
+
+	expr, err := CompileExpr(benchmarkExpr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := newExprResponse()
+
+	if allocs := testing.AllocsPerRun(100, func() { expr.Eval(resp) }); allocs > 0 {
+		t.Errorf("Eval() makes %.0f allocations, want 0", allocs)
+	}
+}
+
+// benchmarkExpr is the expression used in benchmarks.
+const benchmarkExpr = `location.country in ["US", "CA", "GB"] && as.type != "Content" || ` +
+	`as.asn in [16509, 14618] && isp contains "Amazon" && as.name matches "^AMAZON"`
+
+// BenchmarkExprEval measures the evaluation of the compiled expression.
+func BenchmarkExprEval(b *testing.B) {
+	expr, err := CompileExpr(benchmarkExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	resp := newExprResponse()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		expr.Eval(resp)
+	}
+}
@@ -0,0 +1,448 @@
+package simplegeoip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// exprTokenKind is the kind of the expression token.
+type exprTokenKind int
+
+// Kinds of expression tokens.
+const (
+	exprTokenEOF exprTokenKind = iota
+	exprTokenIdent
+	exprTokenString
+	exprTokenNumber
+	exprTokenOp
+)
+
+// exprToken is the token of the expression, pos is its byte offset.
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int
+}
+
+// String returns the token as it's shown in error messages.
+func (t exprToken) String() string {
+	if t.kind == exprTokenEOF {
+		return "end of expression"
+	}
+
+	return strconv.Quote(t.text)
+}
+
+// exprOps are operators and punctuation, two-character ones go first.
+var exprOps = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "-"}
+
+// exprOpHints explain operators which are not supported but look like supported ones.
+var exprOpHints = map[byte]string{
+	'=':  `use "==" to compare`,
+	'&':  `use "&&" for "and"`,
+	'|':  `use "||" for "or"`,
+	'\'': `strings are quoted with '"'`,
+}
+
+// lexExpr splits the expression into tokens ending with exprTokenEOF.
+func lexExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+
+			tokens = append(tokens, exprToken{kind: exprTokenIdent, text: src[start:i], pos: start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+
+			if _, err := strconv.ParseFloat(src[start:i], 64); err != nil {
+				return nil, &ExprError{Expr: src, Pos: start, Message: fmt.Sprintf("invalid number %q", src[start:i])}
+			}
+
+			tokens = append(tokens, exprToken{kind: exprTokenNumber, text: src[start:i], pos: start})
+		case c == '"':
+			token, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, token)
+			i += len(token.text)
+		default:
+			op := ""
+
+			for _, candidate := range exprOps {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+
+					break
+				}
+			}
+
+			if op == "" {
+				message := fmt.Sprintf("unexpected character %q", c)
+				if hint, ok := exprOpHints[c]; ok {
+					message += ", " + hint
+				}
+
+				return nil, &ExprError{Expr: src, Pos: i, Message: message}
+			}
+
+			tokens = append(tokens, exprToken{kind: exprTokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, exprToken{kind: exprTokenEOF, pos: len(src)}), nil
+}
+
+// lexString returns the quoted string token starting at the offset, the token text keeps the quotes.
+func lexString(src string, start int) (exprToken, error) {
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			text := src[start : i+1]
+			if _, err := strconv.Unquote(text); err != nil {
+				return exprToken{}, &ExprError{Expr: src, Pos: start, Message: "invalid escape sequence in string"}
+			}
+
+			return exprToken{kind: exprTokenString, text: text, pos: start}, nil
+		}
+	}
+
+	return exprToken{}, &ExprError{Expr: src, Pos: start, Message: "unterminated string"}
+}
+
+// isIdentStart reports whether the character starts the identifier.
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isDigit reports whether the character is a decimal digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// exprNode is the node of the expression syntax tree.
+type exprNode interface {
+	position() int
+}
+
+// exprBinary is the binary operation: a comparison, "in", "not in", a string operator, "&&" or "||".
+type exprBinary struct {
+	op          string
+	left, right exprNode
+	pos         int
+}
+
+// exprNot is the negation.
+type exprNot struct {
+	operand exprNode
+	pos     int
+}
+
+// exprFieldRef is the reference to the response field, e.g. "location.country".
+type exprFieldRef struct {
+	name string
+	pos  int
+}
+
+// exprLiteral is the string, number or bool value.
+type exprLiteral struct {
+	value interface{}
+	pos   int
+}
+
+// exprList is the list of literals, e.g. ["US", "CA"].
+type exprList struct {
+	items []*exprLiteral
+	pos   int
+}
+
+func (n *exprBinary) position() int   { return n.pos }
+func (n *exprNot) position() int      { return n.pos }
+func (n *exprFieldRef) position() int { return n.pos }
+func (n *exprLiteral) position() int  { return n.pos }
+func (n *exprList) position() int     { return n.pos }
+
+// exprKeywordOps are operators spelled as words.
+var exprKeywordOps = map[string]bool{
+	"in":         true,
+	"contains":   true,
+	"startsWith": true,
+	"endsWith":   true,
+	"matches":    true,
+}
+
+// exprComparisonOps are comparison operators.
+var exprComparisonOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// exprParser is the recursive descent parser of expressions:
+//
+//	or         = and { "||" and }
+//	and        = not { "&&" not }
+//	not        = "!" not | comparison
+//	comparison = operand [ op operand ]
+//	op         = "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" | "not" "in" |
+//	             "contains" | "startsWith" | "endsWith" | "matches"
+//	operand    = "(" or ")" | list | literal | field
+//	list       = "[" [ literal { "," literal } ] "]"
+//	literal    = string | [ "-" ] number | "true" | "false"
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	i      int
+}
+
+// parseExpr parses the expression.
+func parseExpr(src string) (exprNode, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{src: src, tokens: tokens}
+
+	if p.peek().kind == exprTokenEOF {
+		return nil, p.errorf(0, "empty expression")
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != exprTokenEOF {
+		return nil, p.errorf(tok.pos, "unexpected %s, expected %q or %q", tok, "&&", "||")
+	}
+
+	return node, nil
+}
+
+// peek returns the current token.
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+// next returns the current token and moves to the next one.
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.i]
+	if tok.kind != exprTokenEOF {
+		p.i++
+	}
+
+	return tok
+}
+
+// isOp reports whether the current token is the operator.
+func (p *exprParser) isOp(op string) bool {
+	tok := p.peek()
+
+	return tok.kind == exprTokenOp && tok.text == op
+}
+
+// errorf returns ExprError at the offset.
+func (p *exprParser) errorf(pos int, format string, args ...interface{}) error {
+	return &ExprError{Expr: p.src, Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// parseOr parses operands joined by "||".
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("||") {
+		tok := p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &exprBinary{op: tok.text, left: left, right: right, pos: tok.pos}
+	}
+
+	return left, nil
+}
+
+// parseAnd parses operands joined by "&&".
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOp("&&") {
+		tok := p.next()
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &exprBinary{op: tok.text, left: left, right: right, pos: tok.pos}
+	}
+
+	return left, nil
+}
+
+// parseNot parses the negation or the comparison.
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.isOp("!") {
+		tok := p.next()
+
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &exprNot{operand: operand, pos: tok.pos}, nil
+	}
+
+	return p.parseComparison()
+}
+
+// parseComparison parses the operand optionally compared with another one.
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+
+	var op string
+
+	switch {
+	case tok.kind == exprTokenOp && exprComparisonOps[tok.text]:
+		op = p.next().text
+	case tok.kind == exprTokenIdent && exprKeywordOps[tok.text]:
+		op = p.next().text
+	case tok.kind == exprTokenIdent && tok.text == "not":
+		p.next()
+
+		if in := p.peek(); in.kind != exprTokenIdent || in.text != "in" {
+			return nil, p.errorf(in.pos, "unexpected %s, expected %q after %q", in, "in", "not")
+		}
+
+		p.next()
+
+		op = "not in"
+	default:
+		return left, nil
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return &exprBinary{op: op, left: left, right: right, pos: tok.pos}, nil
+}
+
+// parseOperand parses the parenthesized expression, the list, the literal or the field.
+func (p *exprParser) parseOperand() (exprNode, error) {
+	tok := p.peek()
+
+	switch {
+	case tok.kind == exprTokenOp && tok.text == "(":
+		p.next()
+
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.isOp(")") {
+			return nil, p.errorf(p.peek().pos, "unexpected %s, expected %q", p.peek(), ")")
+		}
+
+		p.next()
+
+		return node, nil
+	case tok.kind == exprTokenOp && tok.text == "[":
+		return p.parseList()
+	case tok.kind == exprTokenIdent && tok.text == "not":
+		return nil, p.errorf(tok.pos, `unexpected "not", use "!" to negate`)
+	case tok.kind == exprTokenIdent && (tok.text == "and" || tok.text == "or"):
+		return nil, p.errorf(tok.pos, "unexpected %s, use %q", tok, map[string]string{"and": "&&", "or": "||"}[tok.text])
+	case tok.kind == exprTokenIdent && exprKeywordOps[tok.text]:
+		return nil, p.errorf(tok.pos, "unexpected %s, expected a field or a value", tok)
+	case tok.kind == exprTokenIdent && tok.text != "true" && tok.text != "false":
+		p.next()
+
+		return &exprFieldRef{name: tok.text, pos: tok.pos}, nil
+	case tok.kind == exprTokenIdent || tok.kind == exprTokenString || tok.kind == exprTokenNumber ||
+		tok.kind == exprTokenOp && tok.text == "-":
+		return p.parseLiteral()
+	}
+
+	return nil, p.errorf(tok.pos, "unexpected %s, expected a field or a value", tok)
+}
+
+// parseList parses the list of literals.
+func (p *exprParser) parseList() (exprNode, error) {
+	list := &exprList{pos: p.next().pos}
+
+	for !p.isOp("]") {
+		if len(list.items) > 0 {
+			if !p.isOp(",") {
+				return nil, p.errorf(p.peek().pos, "unexpected %s, expected %q or %q", p.peek(), ",", "]")
+			}
+
+			p.next()
+		}
+
+		item, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+
+		list.items = append(list.items, item)
+	}
+
+	p.next()
+
+	return list, nil
+}
+
+// parseLiteral parses the string, the number or the bool value.
+func (p *exprParser) parseLiteral() (*exprLiteral, error) {
+	tok := p.next()
+
+	switch {
+	case tok.kind == exprTokenString:
+		value, _ := strconv.Unquote(tok.text)
+
+		return &exprLiteral{value: value, pos: tok.pos}, nil
+	case tok.kind == exprTokenNumber:
+		value, _ := strconv.ParseFloat(tok.text, 64)
+
+		return &exprLiteral{value: value, pos: tok.pos}, nil
+	case tok.kind == exprTokenOp && tok.text == "-" && p.peek().kind == exprTokenNumber:
+		value, _ := strconv.ParseFloat(p.next().text, 64)
+
+		return &exprLiteral{value: -value, pos: tok.pos}, nil
+	case tok.kind == exprTokenIdent && (tok.text == "true" || tok.text == "false"):
+		return &exprLiteral{value: tok.text == "true", pos: tok.pos}, nil
+	}
+
+	return nil, p.errorf(tok.pos, "unexpected %s, expected a value", tok)
+}
@@ -0,0 +1,209 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Backend is a named GeoipService used by Fallback.
+type Backend struct {
+	// Name is the backend name reported in Response.Backend and errors
+	Name string
+
+	// Service is the backend implementation
+	Service GeoipService
+
+	// Timeout is the time budget of the backend within the overall context deadline.
+	// If it's zero then the backend may use all the remaining time
+	Timeout time.Duration
+}
+
+// FallbackParams is used to create Fallback. Backends are mandatory.
+type FallbackParams struct {
+	// Backends are tried in order until one of them answers
+	Backends []Backend
+
+	// ShouldFallback decides whether the next backend is tried after the failure. Default: ShouldFallback
+	ShouldFallback func(resp *Response, err error) bool
+}
+
+// Fallback is the GeoipService trying several backends in order, e.g. cache, then the API, then a local database.
+type Fallback struct {
+	params FallbackParams
+}
+
+var _ GeoipService = &Fallback{}
+
+// NewFallback creates Fallback with specified parameters.
+func NewFallback(params FallbackParams) *Fallback {
+	if params.ShouldFallback == nil {
+		params.ShouldFallback = ShouldFallback
+	}
+
+	return &Fallback{params: params}
+}
+
+// ShouldFallback reports whether the failure allows trying the next backend.
+// It's true for timeouts, network errors, exhausted quota, 5xx status codes, missing records
+// and the open circuit breaker, and false for invalid arguments and other client errors.
+func ShouldFallback(resp *Response, err error) bool {
+	var argErr *ArgError
+	if errors.As(err, &argErr) {
+		return false
+	}
+
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+
+	var errResp ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		return isFallbackStatus(errResp.Response.StatusCode)
+	}
+
+	var errMsg *ErrorMessage
+	if errors.As(err, &errMsg) {
+		return isFallbackStatus(errMsg.Code)
+	}
+
+	// the body of failed requests may be unparsable, so the status code is checked as well
+	if resp != nil && resp.Response != nil {
+		return isFallbackStatus(resp.StatusCode)
+	}
+
+	return false
+}
+
+// isFallbackStatus reports whether the status code means exhausted quota or the server failure.
+func isFallbackStatus(code int) bool {
+	switch code {
+	case http.StatusPaymentRequired, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+
+	return code >= http.StatusInternalServerError
+}
+
+// FallbackError is returned when none of Fallback backends answered.
+type FallbackError struct {
+	// Errors holds errors of the backends tried in order
+	Errors []BackendError
+}
+
+// BackendError is the error of a single Fallback backend.
+type BackendError struct {
+	Backend string
+	Err     error
+}
+
+// Error returns error message as a string.
+func (e *FallbackError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, be := range e.Errors {
+		msgs = append(msgs, be.Backend+": "+be.Err.Error())
+	}
+
+	return "all backends failed: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the error of the last backend tried.
+func (e *FallbackError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e.Errors[len(e.Errors)-1].Err
+}
+
+// try calls the backends in order until one of them succeeds or returns an error that must not fall through.
+func (f *Fallback) try(ctx context.Context, call func(ctx context.Context, b Backend) (*Response, error)) (*Response, error) {
+	if len(f.params.Backends) == 0 {
+		return nil, &ArgError{Name: "Backends", Message: "is empty"}
+	}
+
+	fallbackErr := &FallbackError{}
+
+	var resp *Response
+
+	for _, b := range f.params.Backends {
+		if err := ctx.Err(); err != nil {
+			fallbackErr.Errors = append(fallbackErr.Errors, BackendError{Backend: b.Name, Err: err})
+
+			return resp, fallbackErr
+		}
+
+		backendCtx, cancel := ctx, context.CancelFunc(func() {})
+		if b.Timeout > 0 {
+			backendCtx, cancel = context.WithTimeout(ctx, b.Timeout)
+		}
+
+		var err error
+
+		resp, err = call(backendCtx, b)
+
+		cancel()
+
+		if err == nil {
+			if resp == nil {
+				resp = &Response{}
+			}
+
+			resp.Backend = b.Name
+
+			return resp, nil
+		}
+
+		fallbackErr.Errors = append(fallbackErr.Errors, BackendError{Backend: b.Name, Err: err})
+
+		// the overall deadline has been reached, so there is no time left for other backends
+		if ctx.Err() != nil || !f.params.ShouldFallback(resp, err) {
+			return resp, fallbackErr
+		}
+	}
+
+	return resp, fallbackErr
+}
+
+// Get returns parsed response of the first backend that answered.
+func (f *Fallback) Get(
+	ctx context.Context,
+	opts ...Option,
+) (geoipResponse *GeoIPResponse, resp *Response, err error) {
+	resp, err = f.try(ctx, func(ctx context.Context, b Backend) (*Response, error) {
+		var resp *Response
+
+		geoipResponse, resp, err = b.Service.Get(ctx, opts...)
+
+		return resp, err
+	})
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return geoipResponse, resp, nil
+}
+
+// GetRaw returns raw response of the first backend that answered.
+func (f *Fallback) GetRaw(
+	ctx context.Context,
+	opts ...Option,
+) (resp *Response, err error) {
+	return f.try(ctx, func(ctx context.Context, b Backend) (*Response, error) {
+		return b.Service.GetRaw(ctx, opts...)
+	})
+}
@@ -0,0 +1,172 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// stubService is the GeoipService returning the programmed result.
+type stubService struct {
+	resp  *GeoIPResponse
+	err   error
+	delay time.Duration
+	calls int
+}
+
+// Get returns the programmed result after the delay.
+func (s *stubService) Get(ctx context.Context, _ ...Option) (*GeoIPResponse, *Response, error) {
+	s.calls++
+
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+
+	return s.resp, &Response{Body: []byte(`{}`)}, nil
+}
+
+// GetRaw returns the programmed result after the delay.
+func (s *stubService) GetRaw(ctx context.Context, opts ...Option) (*Response, error) {
+	_, resp, err := s.Get(ctx, opts...)
+
+	return resp, err
+}
+
+// TestFallbackGet tests the backends order and the error classes.
+func TestFallbackGet(t *testing.T) {
+	ok := &GeoIPResponse{IP: "8.8.8.8"}
+
+	tests := []struct {
+		name        string
+		first       *stubService
+		second      *stubService
+		timeout     time.Duration
+		wantCalls   int
+		wantBackend string
+		wantErr     string
+	}{
+		{
+			name:        "first answers",
+			first:       &stubService{resp: ok},
+			second:      &stubService{resp: ok},
+			wantBackend: "first",
+		},
+		{
+			name:        "not found",
+			first:       &stubService{err: ErrNotFound},
+			second:      &stubService{resp: ok},
+			wantBackend: "second",
+		},
+		{
+			name:        "server error",
+			first:       &stubService{err: ErrorResponse{Response: &http.Response{StatusCode: 503}}},
+			second:      &stubService{resp: ok},
+			wantBackend: "second",
+		},
+		{
+			name:        "quota exhausted",
+			first:       &stubService{err: &ErrorMessage{Code: 403, Message: "no credits"}},
+			second:      &stubService{resp: ok},
+			wantBackend: "second",
+		},
+		{
+			name:        "circuit open",
+			first:       &stubService{err: ErrCircuitOpen},
+			second:      &stubService{resp: ok},
+			wantBackend: "second",
+		},
+		{
+			name:        "backend timeout",
+			first:       &stubService{resp: ok, delay: time.Second},
+			second:      &stubService{resp: ok},
+			timeout:     10 * time.Millisecond,
+			wantBackend: "second",
+		},
+		{
+			name:    "invalid input",
+			first:   &stubService{err: &ArgError{Name: "ipAddress", Message: "is invalid"}},
+			second:  &stubService{resp: ok},
+			wantErr: `all backends failed: first: invalid argument: "ipAddress" is invalid`,
+		},
+		{
+			name:    "client error",
+			first:   &stubService{err: &ErrorMessage{Code: 422, Message: "bad domain"}},
+			second:  &stubService{resp: ok},
+			wantErr: "all backends failed: first: API error: [422] bad domain",
+		},
+		{
+			name:      "all failed",
+			first:     &stubService{err: ErrNotFound},
+			second:    &stubService{err: ErrNotFound},
+			wantCalls: 1,
+			wantErr:   "all backends failed: first: record not found; second: record not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFallback(FallbackParams{
+				Backends: []Backend{
+					{Name: "first", Service: tt.first, Timeout: tt.timeout},
+					{Name: "second", Service: tt.second},
+				},
+			})
+
+			got, resp, err := f.Get(context.Background())
+			checkErr(t, err, tt.wantErr)
+
+			if tt.wantErr != "" {
+				if got != nil {
+					t.Errorf("Get() got = %v, expected nil", got)
+				}
+
+				if tt.second.calls != tt.wantCalls {
+					t.Errorf("second backend called %d times, want %d", tt.second.calls, tt.wantCalls)
+				}
+
+				return
+			}
+
+			if got != ok {
+				t.Errorf("Get() got = %v, want %v", got, ok)
+			}
+
+			if resp.Backend != tt.wantBackend {
+				t.Errorf("Response.Backend = %q, want %q", resp.Backend, tt.wantBackend)
+			}
+		})
+	}
+}
+
+// TestFallbackDeadline tests that the overall deadline stops the chain.
+func TestFallbackDeadline(t *testing.T) {
+	second := &stubService{resp: &GeoIPResponse{}}
+
+	f := NewFallback(FallbackParams{
+		Backends: []Backend{
+			{Name: "slow", Service: &stubService{delay: time.Second}, Timeout: time.Second},
+			{Name: "fast", Service: second},
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := f.GetRaw(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRaw() error = %v, want deadline exceeded", err)
+	}
+
+	if second.calls != 0 {
+		t.Errorf("second backend called %d times, expected none", second.calls)
+	}
+}
@@ -1,10 +1,8 @@
 package simplegeoip
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"net/url"
 )
@@ -24,6 +22,19 @@ type Response struct {
 
 	// Body is the byte slice representation of http.Response Body
 	Body []byte
+
+	// Backend is the name of the backend that answered. It's set by Cache and Fallback only
+	Backend string
+
+	// Timing is the timing breakdown of the request. It's set if ClientParams.CollectTiming is true
+	Timing *Timing
+
+	// decoded is the body decoded while reading, decodeErr is the decoding error
+	decoded   interface{}
+	decodeErr error
+
+	// bytesRead is the number of body bytes read including ones not retained in Body
+	bytesRead int64
 }
 
 // geoipServiceOp is the type implementing the GeoipService interface.
@@ -34,8 +45,8 @@ type geoipServiceOp struct {
 
 var _ GeoipService = &geoipServiceOp{}
 
-// newRequest creates the API request with default parameters and the specified apiKey.
-func (service *geoipServiceOp) newRequest() (*http.Request, error) {
+// newRequest creates the API request with the specified apiKey and options.
+func (service *geoipServiceOp) newRequest(opts []Option) (*http.Request, error) {
 	req, err := service.client.NewRequest(http.MethodGet, service.baseURL, nil)
 	if err != nil {
 		return nil, err
@@ -44,6 +55,10 @@ func (service *geoipServiceOp) newRequest() (*http.Request, error) {
 	query := url.Values{}
 	query.Set("apiKey", service.client.apiKey)
 
+	for _, opt := range opts {
+		opt(query)
+	}
+
 	req.URL.RawQuery = query.Encode()
 
 	return req, nil
@@ -56,76 +71,111 @@ type apiResponse struct {
 	Message string `json:"error"`
 }
 
-// request returns intermediate API response for further actions.
-func (service *geoipServiceOp) request(ctx context.Context, opts ...Option) (*Response, error) {
-	req, err := service.newRequest()
+// request returns intermediate API response for further actions. The body is decoded with decode if it's not nil.
+func (service *geoipServiceOp) request(ctx context.Context, decode decodeFunc, opts ...Option) (*Response, error) {
+	req, err := service.newRequest(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	q := req.URL.Query()
+	return service.client.handler(ctx, &Call{Options: opts, Request: req, decode: decode})
+}
 
-	for _, opt := range opts {
-		opt(q)
-	}
+// Get returns parsed IP Geolocation API response.
+func (service geoipServiceOp) Get(
+	ctx context.Context,
+	opts ...Option,
+) (geoipResponse *GeoIPResponse, resp *Response, err error) {
+	ctx, span := startSpan(ctx, service.client.tracer, "geoip.Get", opts)
 
-	req.URL.RawQuery = q.Encode()
+	// the response is kept for the span even if it's not returned
+	var spanResp *Response
 
-	var b bytes.Buffer
+	defer func() {
+		endSpan(span, spanResp, err)
+	}()
+
+	optsJSON := make([]Option, 0, len(opts)+1)
+	optsJSON = append(optsJSON, opts...)
+	optsJSON = append(optsJSON, OptionOutputFormat("JSON"))
+
+	resp, err = service.request(ctx, decodeAPIResponse, optsJSON...)
+	spanResp = resp
 
-	resp, err := service.client.Do(ctx, req, &b)
 	if err != nil {
-		return &Response{
-			Response: resp,
-			Body:     b.Bytes(),
-		}, err
+		return nil, resp, err
 	}
 
-	return &Response{
-		Response: resp,
-		Body:     b.Bytes(),
-	}, nil
-}
+	geoipResp, err := resp.apiResponse()
+	if err != nil {
+		logDecodeFailure(ctx, service.client.logger, resp, err)
 
-// parse parses raw IP Geolocation API response.
-func parse(raw []byte) (*apiResponse, error) {
-	var response apiResponse
+		return nil, resp, err
+	}
 
-	err := json.NewDecoder(bytes.NewReader(raw)).Decode(&response)
-	if err != nil {
-		return nil, fmt.Errorf("cannot parse response: %w", err)
+	if geoipResp.Message != "" || geoipResp.Code != 0 {
+		return nil, nil, &ErrorMessage{
+			Code:    geoipResp.Code,
+			Message: geoipResp.Message,
+		}
 	}
 
-	return &response, nil
+	return &geoipResp.GeoIPResponse, resp, nil
 }
 
-// Get returns parsed IP Geolocation API response.
-func (service geoipServiceOp) Get(
+// GetInto parses IP Geolocation API response into dst reusing its memory, e.g. the Domains slice.
+// It's the low-allocation variant of Get for callers reusing dst between calls.
+func (service geoipServiceOp) GetInto(
 	ctx context.Context,
+	dst *GeoIPResponse,
 	opts ...Option,
-) (geoipResponse *GeoIPResponse, resp *Response, err error) {
+) (resp *Response, err error) {
+	if dst == nil {
+		return nil, &ArgError{Name: "dst", Message: "is nil"}
+	}
+
+	ctx, span := startSpan(ctx, service.client.tracer, "geoip.GetInto", opts)
+
+	// the response is kept for the span even if it's not returned
+	var spanResp *Response
+
+	defer func() {
+		endSpan(span, spanResp, err)
+	}()
+
 	optsJSON := make([]Option, 0, len(opts)+1)
 	optsJSON = append(optsJSON, opts...)
 	optsJSON = append(optsJSON, OptionOutputFormat("JSON"))
 
-	resp, err = service.request(ctx, optsJSON...)
+	resp, err = service.request(ctx, decodePooled, optsJSON...)
+	spanResp = resp
+
 	if err != nil {
-		return nil, resp, err
+		return resp, err
 	}
 
-	geoipResp, err := parse(resp.Body)
+	geoipResp, err := resp.apiResponse()
 	if err != nil {
-		return nil, resp, err
+		logDecodeFailure(ctx, service.client.logger, resp, err)
+
+		return resp, err
 	}
 
+	// the pooled response must not be reachable from the returned Response
+	resp.decoded = nil
+
+	defer apiResponsePool.Put(geoipResp)
+
 	if geoipResp.Message != "" || geoipResp.Code != 0 {
-		return nil, nil, &ErrorMessage{
+		return nil, &ErrorMessage{
 			Code:    geoipResp.Code,
 			Message: geoipResp.Message,
 		}
 	}
 
-	return &geoipResp.GeoIPResponse, resp, nil
+	geoipResp.copyInto(dst)
+
+	return resp, nil
 }
 
 // GetRaw returns raw IP Geolocation API response as Response struct with Body saved as a byte slice.
@@ -133,7 +183,13 @@ func (service geoipServiceOp) GetRaw(
 	ctx context.Context,
 	opts ...Option,
 ) (resp *Response, err error) {
-	resp, err = service.request(ctx, opts...)
+	ctx, span := startSpan(ctx, service.client.tracer, "geoip.GetRaw", opts)
+
+	defer func() {
+		endSpan(span, resp, err)
+	}()
+
+	resp, err = service.request(ctx, nil, opts...)
 	if err != nil {
 		return resp, err
 	}
@@ -145,6 +201,9 @@ func (service geoipServiceOp) GetRaw(
 	return resp, nil
 }
 
+// ErrNotFound is returned by offline backends when there is no record for the IP address.
+var ErrNotFound = errors.New("record not found")
+
 // ArgError is the argument error.
 type ArgError struct {
 	Name    string
@@ -0,0 +1,197 @@
+package geoiptest
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// ServerParams is used to create Server. None of parameters are mandatory.
+type ServerParams struct {
+	// Service answers the lookups. If it's nil then an empty Service is created
+	Service *Service
+
+	// APIKey is the only accepted API key. If it's empty then any non-empty key is accepted
+	APIKey string
+
+	// Latency is the delay before each response
+	Latency time.Duration
+}
+
+// Request is a request recorded by Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Time   time.Time
+}
+
+// Server is the httptest.Server emulating IP Geolocation API.
+type Server struct {
+	*httptest.Server
+
+	// Service answers the lookups
+	Service *Service
+
+	apiKey string
+
+	mu       sync.Mutex
+	latency  time.Duration
+	requests []Request
+}
+
+// NewServer starts Server with specified parameters. It must be closed when finished.
+func NewServer(params ServerParams) *Server {
+	s := &Server{
+		Service: params.Service,
+		apiKey:  params.APIKey,
+		latency: params.Latency,
+	}
+
+	if s.Service == nil {
+		s.Service = NewService()
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// NewClient creates simplegeoip.Client sending requests to the server.
+func (s *Server) NewClient(apiKey string) *simplegeoip.Client {
+	baseURL, err := url.Parse(s.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	return simplegeoip.NewClient(apiKey, simplegeoip.ClientParams{
+		HTTPClient:   s.Client(),
+		GeoipBaseURL: baseURL,
+	})
+}
+
+// SetLatency sets the delay before each response.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+// Requests returns all requests received in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+
+	return requests
+}
+
+// serveHTTP handles the API request.
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  query,
+		Header: req.Header.Clone(),
+		Time:   time.Now(),
+	})
+	latency := s.latency
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if req.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+
+		return
+	}
+
+	switch apiKey := query.Get("apiKey"); {
+	case apiKey == "":
+		writeError(w, http.StatusUnauthorized, "API key is required")
+
+		return
+	case s.apiKey != "" && apiKey != s.apiKey:
+		writeError(w, http.StatusForbidden, "Access restricted. Check credits balance or enter the correct API key.")
+
+		return
+	}
+
+	outputFormat := strings.ToUpper(query.Get("outputFormat"))
+	if outputFormat != "" && outputFormat != "JSON" && outputFormat != "XML" {
+		writeError(w, http.StatusUnprocessableEntity, "Output format should be JSON or XML")
+
+		return
+	}
+
+	if ip := query.Get("ipAddress"); ip != "" && net.ParseIP(ip) == nil {
+		writeError(w, http.StatusUnprocessableEntity, "Invalid IP address")
+
+		return
+	}
+
+	// the query is passed as is, so the options are reconstructed from it
+	opts := make([]simplegeoip.Option, 0, len(query))
+	for key := range query {
+		if key != "apiKey" {
+			key, values := key, query[key]
+			opts = append(opts, func(v url.Values) { v[key] = values })
+		}
+	}
+
+	resp, err := s.Service.GetRaw(req.Context(), opts...)
+	if err != nil {
+		var errMsg *simplegeoip.ErrorMessage
+
+		switch {
+		case errors.As(err, &errMsg) && errMsg.Code >= 100 && errMsg.Code <= 599:
+			writeError(w, errMsg.Code, errMsg.Message)
+		case errMsg != nil:
+			// the stubbed error without the valid status code
+			writeError(w, http.StatusInternalServerError, errMsg.Message)
+		case errors.Is(err, simplegeoip.ErrNotFound):
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+
+		return
+	}
+
+	contentType := "application/json"
+	if outputFormat == "XML" {
+		contentType = "application/xml"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(resp.Body)
+}
+
+// writeError writes the API error response.
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(simplegeoip.ErrorMessage{Code: code, Message: message})
+}
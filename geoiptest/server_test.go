@@ -0,0 +1,190 @@
+package geoiptest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+const apiKey = "at_LoremIpsumDolorSitAmetConsect"
+
+// testResponse is the sample IP Geolocation API response.
+var testResponse = &simplegeoip.GeoIPResponse{
+	IP:       "8.8.8.8",
+	Location: simplegeoip.Location{Country: "US", City: "Mountain View"},
+	Domains:  []string{"dns.google"},
+	AS:       simplegeoip.AS{ASN: 15169, Name: "GOOGLE"},
+}
+
+// TestServerGet tests the emulated API with the real client.
+func TestServerGet(t *testing.T) {
+	server := NewServer(ServerParams{APIKey: apiKey})
+	defer server.Close()
+
+	server.Service.Set(IP("8.8.8.8"), testResponse)
+	server.Service.Set(Domain("google.com"), testResponse)
+	server.Service.SetError(IP("1.1.1.1"), &simplegeoip.ErrorMessage{Code: 429, Message: "Too many requests"})
+	server.Service.SetError(IP("2.2.2.2"), &simplegeoip.ErrorMessage{Message: "No code"})
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		opts    []simplegeoip.Option
+		wantErr string
+	}{
+		{
+			name:   "IP address",
+			apiKey: apiKey,
+			opts:   []simplegeoip.Option{simplegeoip.OptionIPAddress("8.8.8.8")},
+		},
+		{
+			name:   "domain takes precedence",
+			apiKey: apiKey,
+			opts: []simplegeoip.Option{
+				simplegeoip.OptionIPAddress("1.1.1.1"),
+				simplegeoip.OptionDomain("Google.com"),
+			},
+		},
+		{
+			name:    "wrong API key",
+			apiKey:  "at_wrong",
+			opts:    []simplegeoip.Option{simplegeoip.OptionIPAddress("8.8.8.8")},
+			wantErr: "API error: [403] Access restricted. Check credits balance or enter the correct API key.",
+		},
+		{
+			name:    "invalid IP address",
+			apiKey:  apiKey,
+			opts:    []simplegeoip.Option{simplegeoip.OptionIPAddress("8.8.8")},
+			wantErr: "API error: [422] Invalid IP address",
+		},
+		{
+			name:    "programmed error",
+			apiKey:  apiKey,
+			opts:    []simplegeoip.Option{simplegeoip.OptionIPAddress("1.1.1.1")},
+			wantErr: "API error: [429] Too many requests",
+		},
+		{
+			name:    "programmed error without the code",
+			apiKey:  apiKey,
+			opts:    []simplegeoip.Option{simplegeoip.OptionIPAddress("2.2.2.2")},
+			wantErr: "API error: [500] No code",
+		},
+		{
+			name:    "not programmed",
+			apiKey:  apiKey,
+			opts:    []simplegeoip.Option{simplegeoip.OptionEmail("support@whoisxmlapi.com")},
+			wantErr: "API error: [404] record not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := server.NewClient(tt.apiKey).Get(context.Background(), tt.opts...)
+			if (err != nil || tt.wantErr != "") && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == "" && (got == nil || got.AS.ASN != testResponse.AS.ASN) {
+				t.Errorf("Get() got = %+v, want %+v", got, testResponse)
+			}
+		})
+	}
+
+	requests := server.Requests()
+	if len(requests) != len(tests) {
+		t.Fatalf("len(Requests()) = %d, want %d", len(requests), len(tests))
+	}
+
+	if q := requests[0].Query; q.Get("apiKey") != apiKey || q.Get("outputFormat") != "JSON" {
+		t.Errorf("Requests()[0].Query = %v", q)
+	}
+}
+
+// TestServerGetRaw tests the output formats and the reverse IP option.
+func TestServerGetRaw(t *testing.T) {
+	server := NewServer(ServerParams{})
+	defer server.Close()
+
+	server.Service.Set(Target{}, testResponse)
+
+	client := server.NewClient(apiKey)
+
+	resp, err := client.GetRaw(context.Background(), simplegeoip.OptionOutputFormat("xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body := string(resp.Body); !strings.Contains(body, "<domains><domain>dns.google</domain></domains>") {
+		t.Errorf("XML body = %s", body)
+	}
+
+	resp, err = client.GetRaw(context.Background(), simplegeoip.OptionReverseIP(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body := string(resp.Body); strings.Contains(body, "dns.google") || !strings.HasPrefix(body, "{") {
+		t.Errorf("JSON body = %s", body)
+	}
+
+	_, err = client.GetRaw(context.Background(), simplegeoip.OptionOutputFormat("CSV"))
+	if err == nil || err.Error() != "API failed with status code: 422" {
+		t.Errorf("GetRaw() error = %v", err)
+	}
+}
+
+// TestServerLatency tests the latency injection.
+func TestServerLatency(t *testing.T) {
+	server := NewServer(ServerParams{Latency: time.Second})
+	defer server.Close()
+
+	server.Service.Set(Target{}, testResponse)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err := server.NewClient(apiKey).Get(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get() error = %v, want deadline exceeded", err)
+	}
+
+	server.SetLatency(0)
+
+	if _, _, err := server.NewClient(apiKey).Get(context.Background()); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+}
+
+// TestService tests the fake service directly.
+func TestService(t *testing.T) {
+	service := NewService()
+	service.Set(Email("support@whoisxmlapi.com"), testResponse)
+
+	got, _, err := service.Get(context.Background(), simplegeoip.OptionEmail("Support@WhoisXMLAPI.com"))
+	if err != nil || got.IP != testResponse.IP {
+		t.Errorf("Get() got = %+v, error = %v", got, err)
+	}
+
+	got.Domains = nil
+	if testResponse.Domains == nil {
+		t.Error("programmed response modified by caller")
+	}
+
+	_, _, err = service.Get(context.Background(), simplegeoip.OptionIPAddress("8.8.8.8"))
+	if !errors.Is(err, simplegeoip.ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, simplegeoip.ErrNotFound)
+	}
+
+	if n := len(service.Requests()); n != 2 {
+		t.Errorf("len(Requests()) = %d, want 2", n)
+	}
+
+	service.Reset()
+
+	if n := len(service.Requests()); n != 0 {
+		t.Errorf("len(Requests()) = %d after Reset(), want 0", n)
+	}
+}
@@ -0,0 +1,253 @@
+// Package geoiptest provides fakes of IP Geolocation API for testing code that uses simplegeoip.
+package geoiptest
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"sync"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// Target selects the lookups answered by a programmed result. The zero value is the caller's own IP address.
+type Target struct {
+	kind  string
+	value string
+}
+
+// IP returns Target of lookups by the IP address.
+func IP(value string) Target {
+	return Target{kind: "ipAddress", value: value}
+}
+
+// Domain returns Target of lookups by the domain name.
+func Domain(value string) Target {
+	return Target{kind: "domain", value: strings.ToLower(value)}
+}
+
+// Email returns Target of lookups by the email address or domain name.
+func Email(value string) Target {
+	return Target{kind: "email", value: strings.ToLower(value)}
+}
+
+// String returns the target as a query parameter.
+func (t Target) String() string {
+	if t.kind == "" {
+		return "own IP address"
+	}
+
+	return t.kind + "=" + t.value
+}
+
+// targetOf returns Target of the query. Like the API, email takes precedence over domain and domain over IP address.
+func targetOf(query url.Values) Target {
+	for _, kind := range []string{"email", "domain", "ipAddress"} {
+		if value := query.Get(kind); value != "" {
+			if kind != "ipAddress" {
+				value = strings.ToLower(value)
+			}
+
+			return Target{kind: kind, value: value}
+		}
+	}
+
+	return Target{}
+}
+
+// result is a programmed result.
+type result struct {
+	resp *simplegeoip.GeoIPResponse
+	err  error
+}
+
+// Service is the in-memory fake GeoipService answering with programmed results.
+// Lookups of targets without programmed results fail with simplegeoip.ErrNotFound.
+type Service struct {
+	mu       sync.Mutex
+	results  map[Target]result
+	requests []url.Values
+}
+
+var _ simplegeoip.GeoipService = &Service{}
+
+// NewService creates Service without programmed results.
+func NewService() *Service {
+	return &Service{results: make(map[Target]result)}
+}
+
+// Set programs the response for the target.
+func (s *Service) Set(target Target, resp *simplegeoip.GeoIPResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results[target] = result{resp: resp}
+}
+
+// SetError programs the error for the target. Use *simplegeoip.ErrorMessage to emulate API errors.
+func (s *Service) SetError(target Target, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results[target] = result{err: err}
+}
+
+// Reset removes all programmed results and recorded requests.
+func (s *Service) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = make(map[Target]result)
+	s.requests = nil
+}
+
+// Requests returns the queries of all lookups in order.
+func (s *Service) Requests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]url.Values, len(s.requests))
+	copy(requests, s.requests)
+
+	return requests
+}
+
+// lookup records the query and returns a copy of the programmed response.
+// Domains are omitted if reverse IP search is disabled with reverseIp=0.
+func (s *Service) lookup(query url.Values) (*simplegeoip.GeoIPResponse, error) {
+	s.mu.Lock()
+	s.requests = append(s.requests, query)
+	res, ok := s.results[targetOf(query)]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, simplegeoip.ErrNotFound
+	}
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	resp := *res.resp
+	if query.Get("reverseIp") == "0" {
+		resp.Domains = nil
+	}
+
+	return &resp, nil
+}
+
+// queryOf applies the options to the empty query.
+func queryOf(opts []simplegeoip.Option) url.Values {
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+
+	return query
+}
+
+// Get returns the programmed response. Response contains it as JSON.
+func (s *Service) Get(
+	ctx context.Context,
+	opts ...simplegeoip.Option,
+) (geoipResponse *simplegeoip.GeoIPResponse, resp *simplegeoip.Response, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	geoipResponse, err = s.lookup(queryOf(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := json.Marshal(geoipResponse)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return geoipResponse, &simplegeoip.Response{Body: body}, nil
+}
+
+// GetRaw returns the programmed response as JSON or XML depending on the output format.
+func (s *Service) GetRaw(
+	ctx context.Context,
+	opts ...simplegeoip.Option,
+) (resp *simplegeoip.Response, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	query := queryOf(opts)
+
+	geoipResponse, err := s.lookup(query)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := encode(geoipResponse, query.Get("outputFormat"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &simplegeoip.Response{Body: body}, nil
+}
+
+// encode serializes the response in the output format.
+func encode(resp *simplegeoip.GeoIPResponse, outputFormat string) ([]byte, error) {
+	if strings.EqualFold(outputFormat, "XML") {
+		body, err := xml.Marshal(newXMLResponse(resp))
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte(xml.Header), body...), nil
+	}
+
+	return json.Marshal(resp)
+}
+
+// xmlResponse is the XML representation of the response using the same names as JSON.
+type xmlResponse struct {
+	XMLName        xml.Name    `xml:"GeoIPResponse"`
+	IP             string      `xml:"ip"`
+	Location       xmlLocation `xml:"location"`
+	Domains        []string    `xml:"domains>domain,omitempty"`
+	AS             xmlAS       `xml:"as"`
+	ISP            string      `xml:"isp"`
+	ConnectionType string      `xml:"connectionType"`
+}
+
+// xmlLocation is the XML representation of the location.
+type xmlLocation struct {
+	Country    string  `xml:"country"`
+	Region     string  `xml:"region"`
+	City       string  `xml:"city"`
+	Lat        float64 `xml:"lat"`
+	Lng        float64 `xml:"lng"`
+	PostalCode string  `xml:"postalCode"`
+	Timezone   string  `xml:"timezone"`
+	GeonameID  uint    `xml:"geonameId"`
+}
+
+// xmlAS is the XML representation of the autonomous system.
+type xmlAS struct {
+	ASN    int    `xml:"asn"`
+	Name   string `xml:"name"`
+	Route  string `xml:"route"`
+	Domain string `xml:"domain"`
+	Type   string `xml:"type"`
+}
+
+// newXMLResponse converts the response to its XML representation.
+func newXMLResponse(resp *simplegeoip.GeoIPResponse) xmlResponse {
+	return xmlResponse{
+		IP:             resp.IP,
+		Location:       xmlLocation(resp.Location),
+		Domains:        resp.Domains,
+		AS:             xmlAS(resp.AS),
+		ISP:            resp.ISP,
+		ConnectionType: resp.ConnectionType,
+	}
+}
@@ -0,0 +1,316 @@
+package simplegeoip
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute keys added by GeoLogHandler.
+const (
+	LogKeyGeoCountry = "geo.country"
+	LogKeyGeoCity    = "geo.city"
+	LogKeyGeoASN     = "geo.asn"
+)
+
+const (
+	// defaultGeoLogQueueSize is the default number of pending lookups of GeoLogHandler.
+	defaultGeoLogQueueSize = 1000
+
+	// geoLogRetryInterval is the time before failed lookups of GeoLogHandler are retried.
+	geoLogRetryInterval = time.Minute
+)
+
+// defaultGeoLogKeys are the default keys of IP address attributes.
+var defaultGeoLogKeys = []string{"ip", "ip_address", "client_ip", "remote_ip", "remote_addr"}
+
+// GeoLogHandlerParams is used to create GeoLogHandler. Service is mandatory.
+type GeoLogHandlerParams struct {
+	// Service looks up IP addresses. It's wrapped in Cache with CacheParams unless it's Cache already
+	Service GeoipService
+
+	// CacheParams are parameters of the cache created for Service
+	CacheParams CacheParams
+
+	// Keys are keys of string attributes holding IP addresses, optionally with the port. They are compared
+	// case-insensitively. Attributes of the netip.Addr type are detected by any key.
+	// Default: "ip", "ip_address", "client_ip", "remote_ip" and "remote_addr"
+	Keys []string
+
+	// Concurrency is the number of concurrent lookups. Default: 4
+	Concurrency int
+
+	// QueueSize is the maximum number of pending lookups, addresses are not looked up if the queue is full.
+	// Default: 1000
+	QueueSize int
+
+	// LookupTimeout is the timeout of every lookup. Default: 10 seconds
+	LookupTimeout time.Duration
+
+	// Options are added to the query of every lookup, e.g. OptionReverseIP(0)
+	Options []Option
+}
+
+// GeoLogHandler is the slog.Handler adding the location of the IP address found in the record attributes:
+// geo.country, geo.city and geo.asn. It never waits for lookups: the record of the address missing
+// in the cache is passed on as is, and the address is looked up in the background for the next records.
+// Only the first public IP address of the record is looked up.
+type GeoLogHandler struct {
+	next   slog.Handler
+	lookup *geoLogLookup
+
+	// addr is the address found in attributes added by WithAttrs
+	addr netip.Addr
+}
+
+var _ slog.Handler = &GeoLogHandler{}
+
+// geoLogLookup looks up addresses in the background, it's shared by handlers derived with WithAttrs and WithGroup.
+type geoLogLookup struct {
+	cache  *Cache
+	params GeoLogHandlerParams
+	keys   map[string]bool
+	queue  chan netip.Addr
+
+	mu sync.Mutex
+
+	// pending are queued addresses with the zero time and failed ones with the time of the retry
+	pending map[netip.Addr]time.Time
+
+	// ctx is canceled by Close to stop lookups
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewGeoLogHandler creates GeoLogHandler passing records to next. Lookups go on until Close is called.
+func NewGeoLogHandler(next slog.Handler, params GeoLogHandlerParams) (*GeoLogHandler, error) {
+	if next == nil {
+		return nil, &ArgError{Name: "next", Message: "cannot be nil"}
+	}
+
+	if params.Service == nil {
+		return nil, &ArgError{Name: "Service", Message: "cannot be nil"}
+	}
+
+	if len(params.Keys) == 0 {
+		params.Keys = defaultGeoLogKeys
+	}
+
+	if params.Concurrency <= 0 {
+		params.Concurrency = defaultBatchConcurrency
+	}
+
+	if params.QueueSize <= 0 {
+		params.QueueSize = defaultGeoLogQueueSize
+	}
+
+	if params.LookupTimeout <= 0 {
+		params.LookupTimeout = defaultMiddlewareLookupTimeout
+	}
+
+	cache, ok := params.Service.(*Cache)
+	if !ok {
+		cache = NewCache(params.Service, params.CacheParams)
+	}
+
+	lookup := &geoLogLookup{
+		cache:   cache,
+		params:  params,
+		keys:    make(map[string]bool, len(params.Keys)),
+		queue:   make(chan netip.Addr, params.QueueSize),
+		pending: make(map[netip.Addr]time.Time),
+	}
+
+	lookup.ctx, lookup.cancel = context.WithCancel(context.Background())
+
+	for _, key := range params.Keys {
+		lookup.keys[strings.ToLower(key)] = true
+	}
+
+	for i := 0; i < params.Concurrency; i++ {
+		lookup.wg.Add(1)
+
+		go lookup.run()
+	}
+
+	return &GeoLogHandler{next: next, lookup: lookup}, nil
+}
+
+// Enabled reports whether the wrapped handler handles records at the level.
+func (h *GeoLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle adds the location of the IP address to the record if it's cached and passes the record on.
+func (h *GeoLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	addr := h.addr
+
+	if !addr.IsValid() {
+		r.Attrs(func(a slog.Attr) bool {
+			addr = h.lookup.find(a)
+
+			return !addr.IsValid()
+		})
+	}
+
+	if !addr.IsValid() {
+		return h.next.Handle(ctx, r)
+	}
+
+	resp, ok := h.lookup.cache.Peek(h.lookup.options(addr)...)
+	if !ok {
+		h.lookup.enqueue(addr)
+
+		return h.next.Handle(ctx, r)
+	}
+
+	r = r.Clone()
+
+	if resp.Location.Country != "" {
+		r.AddAttrs(slog.String(LogKeyGeoCountry, resp.Location.Country))
+	}
+
+	if resp.Location.City != "" {
+		r.AddAttrs(slog.String(LogKeyGeoCity, resp.Location.City))
+	}
+
+	if resp.AS.ASN != 0 {
+		r.AddAttrs(slog.Int(LogKeyGeoASN, resp.AS.ASN))
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns the handler with the attributes, the IP address is looked for in them too.
+func (h *GeoLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	derived := &GeoLogHandler{next: h.next.WithAttrs(attrs), lookup: h.lookup, addr: h.addr}
+
+	for _, a := range attrs {
+		if derived.addr.IsValid() {
+			break
+		}
+
+		derived.addr = h.lookup.find(a)
+	}
+
+	return derived
+}
+
+// WithGroup returns the handler with the group.
+func (h *GeoLogHandler) WithGroup(name string) slog.Handler {
+	return &GeoLogHandler{next: h.next.WithGroup(name), lookup: h.lookup, addr: h.addr}
+}
+
+// Close stops lookups and waits for running ones. Records are still passed on with cached locations.
+func (h *GeoLogHandler) Close() {
+	h.lookup.cancel()
+	h.lookup.wg.Wait()
+}
+
+// find returns the public IP address of the attribute or of the attributes of the group.
+func (l *geoLogLookup) find(a slog.Attr) netip.Addr {
+	value := a.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindGroup:
+		for _, attr := range value.Group() {
+			if addr := l.find(attr); addr.IsValid() {
+				return addr
+			}
+		}
+
+		return netip.Addr{}
+	case slog.KindString:
+		if l.keys[strings.ToLower(a.Key)] {
+			return publicAddr(parseHost(value.String()))
+		}
+	case slog.KindAny:
+		if addr, ok := value.Any().(netip.Addr); ok {
+			return publicAddr(addr.Unmap())
+		}
+	}
+
+	return netip.Addr{}
+}
+
+// publicAddr returns the address if it's public, otherwise it returns the invalid address.
+func publicAddr(addr netip.Addr) netip.Addr {
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return netip.Addr{}
+	}
+
+	return addr
+}
+
+// options returns the lookup options of the address.
+func (l *geoLogLookup) options(addr netip.Addr) []Option {
+	return append([]Option{OptionIPAddress(addr.String())}, l.params.Options...)
+}
+
+// enqueue queues the lookup of the address unless it's queued, has failed recently, or the queue is full.
+func (l *geoLogLookup) enqueue(addr netip.Addr) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	if retry, ok := l.pending[addr]; ok && (retry.IsZero() || now.Before(retry)) {
+		return
+	}
+
+	if l.ctx.Err() != nil {
+		return
+	}
+
+	select {
+	case l.queue <- addr:
+		l.pending[addr] = time.Time{}
+	default:
+		return
+	}
+
+	// failed addresses are forgotten after the retry interval to keep the map small
+	if len(l.pending) > 2*l.params.QueueSize {
+		for pending, retry := range l.pending {
+			if !retry.IsZero() && !now.Before(retry) {
+				delete(l.pending, pending)
+			}
+		}
+	}
+}
+
+// run looks up queued addresses until the handler is closed.
+func (l *geoLogLookup) run() {
+	defer l.wg.Done()
+
+	for {
+		select {
+		case addr := <-l.queue:
+			ctx, cancel := context.WithTimeout(l.ctx, l.params.LookupTimeout)
+			_, _, err := l.cache.Get(ctx, l.options(addr)...)
+
+			cancel()
+			l.done(addr, err)
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
+
+// done forgets the looked up address, or delays the retry if the lookup has failed.
+func (l *geoLogLookup) done(addr netip.Addr, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err != nil {
+		l.pending[addr] = time.Now().Add(geoLogRetryInterval)
+
+		return
+	}
+
+	delete(l.pending, addr)
+}
@@ -0,0 +1,244 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is the buffer safe for concurrent writes of the log handler.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write appends the data to the buffer.
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// records returns the logged JSON records and resets the buffer.
+func (b *syncBuffer) records(t *testing.T) []map[string]interface{} {
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, record)
+	}
+
+	b.buf.Reset()
+
+	return records
+}
+
+// waitCached waits until the address is looked up by the handler.
+func waitCached(t *testing.T, h *GeoLogHandler, ip string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		if _, ok := h.lookup.cache.Peek(OptionIPAddress(ip)); ok {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("%s is not looked up", ip)
+}
+
+// TestGeoLogHandler tests enriching records with the location of the IP address.
+func TestGeoLogHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   func(logger *slog.Logger)
+		group string
+	}{
+		{name: "key", log: func(logger *slog.Logger) { logger.Info("login", "client_ip", "1.1.1.1") }},
+		{name: "key with port", log: func(logger *slog.Logger) { logger.Info("login", "Remote_Addr", "1.1.1.1:443") }},
+		{name: "netip.Addr", log: func(logger *slog.Logger) { logger.Info("login", "peer", netip.MustParseAddr("1.1.1.1")) }},
+		{name: "WithAttrs", log: func(logger *slog.Logger) { logger.With("ip", "1.1.1.1").Info("login") }},
+		{name: "group", log: func(logger *slog.Logger) { logger.Info("login", slog.Group("req", slog.String("ip", "1.1.1.1"))) }},
+		{
+			name:  "WithGroup",
+			log:   func(logger *slog.Logger) { logger.WithGroup("req").Info("login", "ip", "1.1.1.1") },
+			group: "req",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf syncBuffer
+
+			handler, err := NewGeoLogHandler(slog.NewJSONHandler(&buf, nil), GeoLogHandlerParams{Service: newLocationService()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer handler.Close()
+
+			logger := slog.New(handler)
+
+			// the first record is not enriched
+			tt.log(logger)
+			waitCached(t, handler, "1.1.1.1")
+			tt.log(logger)
+
+			records := buf.records(t)
+			if len(records) != 2 {
+				t.Fatalf("got %d records, want 2", len(records))
+			}
+
+			for i, want := range []bool{false, true} {
+				attrs := records[i]
+				if tt.group != "" {
+					attrs, _ = attrs[tt.group].(map[string]interface{})
+				}
+
+				country, asn := attrs[LogKeyGeoCountry], attrs[LogKeyGeoASN]
+				if enriched := country != nil; enriched != want {
+					t.Errorf("record %d = %v, want enriched %v", i, records[i], want)
+				}
+
+				if want && (country != "US" || asn != float64(7922) || attrs[LogKeyGeoCity] != nil) {
+					t.Errorf("record %d = %v, want US and 7922 without the city", i, records[i])
+				}
+			}
+		})
+	}
+}
+
+// TestGeoLogHandlerSkipped tests records without public IP addresses and failed lookups.
+func TestGeoLogHandlerSkipped(t *testing.T) {
+	var buf syncBuffer
+
+	handler, err := NewGeoLogHandler(slog.NewJSONHandler(&buf, nil), GeoLogHandlerParams{
+		Service: newLocationService(),
+		Keys:    []string{"addr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+
+	logger := slog.New(handler)
+
+	logger.Info("private", "addr", "192.168.1.1")
+	logger.Info("not an address", "addr", "localhost")
+	logger.Info("unknown key", "ip", "1.1.1.1")
+	logger.Info("not found", "addr", "4.4.4.4")
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		handler.lookup.mu.Lock()
+		retry := handler.lookup.pending[netip.MustParseAddr("4.4.4.4")]
+		pending := len(handler.lookup.pending)
+		handler.lookup.mu.Unlock()
+
+		if !retry.IsZero() {
+			if pending != 1 {
+				t.Errorf("%d addresses are looked up, want 1", pending)
+			}
+
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the failed lookup is not recorded")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// the failed address is not looked up again until the retry interval
+	logger.Info("not found", "addr", "4.4.4.4")
+
+	if n := len(handler.lookup.queue); n != 0 {
+		t.Errorf("%d lookups are queued, want 0", n)
+	}
+
+	if n := handler.lookup.cache.Len(); n != 0 {
+		t.Errorf("%d responses are cached, want 0", n)
+	}
+
+	for _, record := range buf.records(t) {
+		if record[LogKeyGeoCountry] != nil {
+			t.Errorf("record %v is enriched", record)
+		}
+	}
+}
+
+// TestGeoLogHandlerNonBlocking tests that logging doesn't wait for slow lookups or the full queue.
+func TestGeoLogHandlerNonBlocking(t *testing.T) {
+	var buf syncBuffer
+
+	handler, err := NewGeoLogHandler(slog.NewJSONHandler(&buf, nil), GeoLogHandlerParams{
+		Service:     &slowService{delay: time.Hour},
+		Concurrency: 1,
+		QueueSize:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(handler)
+	start := time.Now()
+
+	for i := 0; i < 100; i++ {
+		logger.Info("request", "ip", netip.AddrFrom4([4]byte{8, 8, 8, byte(i)}).String())
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("logging took %v", elapsed)
+	}
+
+	if n := len(buf.records(t)); n != 100 {
+		t.Errorf("got %d records, want 100", n)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		handler.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close() waits for the slow lookup")
+	}
+
+	if err := handler.Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "closed", 0)); err != nil {
+		t.Errorf("Handle() after Close() = %v", err)
+	}
+
+	_, err = NewGeoLogHandler(nil, GeoLogHandlerParams{Service: newLocationService()})
+	checkErr(t, err, `invalid argument: "next" cannot be nil`)
+
+	_, err = NewGeoLogHandler(slog.NewJSONHandler(&buf, nil), GeoLogHandlerParams{})
+	checkErr(t, err, `invalid argument: "Service" cannot be nil`)
+}
@@ -1,3 +1,3 @@
 module github.com/whois-api-llc/go-simple-geoip
 
-go 1.17
+go 1.21
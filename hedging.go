@@ -0,0 +1,217 @@
+package simplegeoip
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHedgePercentile is the default latency percentile used as the hedging delay.
+	defaultHedgePercentile = 0.95
+
+	// defaultHedgeInitialDelay is the default hedging delay until enough latencies are observed.
+	defaultHedgeInitialDelay = 100 * time.Millisecond
+
+	// defaultHedgeBudget is the default ratio of hedged requests to all requests.
+	defaultHedgeBudget = 0.1
+
+	// hedgeLatencies is the number of recent latencies the percentile is computed from.
+	hedgeLatencies = 100
+
+	// hedgeMinLatencies is the number of latencies needed to use the percentile instead of InitialDelay.
+	hedgeMinLatencies = 20
+
+	// hedgeMaxTokens is the maximum number of hedges saved up by the budget.
+	hedgeMaxTokens = 10
+)
+
+// MetricHedgedRequests is the name of the counter of hedged requests.
+const MetricHedgedRequests = "geoip_hedged_requests_total"
+
+// HedgingParams is used to enable hedged requests with ClientParams.Hedging. None of parameters are mandatory.
+type HedgingParams struct {
+	// Delay is the time to wait for the answer before the second request is sent.
+	// If it's zero then Percentile of recent latencies is used
+	Delay time.Duration
+
+	// Percentile is the percentile of recent latencies used as the delay. Default: 0.95
+	Percentile float64
+
+	// InitialDelay is the delay used until enough latencies are observed. Default: 100 milliseconds
+	InitialDelay time.Duration
+
+	// Budget is the maximum ratio of hedged requests to all requests. It's capped at 1,
+	// so hedging never more than doubles the number of requests. Default: 0.1
+	Budget float64
+}
+
+// hedger sends the second request if the first one is slow and uses whichever answers first.
+type hedger struct {
+	params HedgingParams
+	sink   MetricsSink
+
+	mu sync.Mutex
+
+	// latencies is the ring buffer of recent latencies, next is the index to write to
+	latencies []time.Duration
+	next      int
+
+	// tokens is the number of hedges allowed by the budget
+	tokens float64
+}
+
+// newHedger creates hedger with specified parameters.
+func newHedger(params HedgingParams, sink MetricsSink) *hedger {
+	if params.Percentile <= 0 || params.Percentile > 1 {
+		params.Percentile = defaultHedgePercentile
+	}
+
+	if params.InitialDelay <= 0 {
+		params.InitialDelay = defaultHedgeInitialDelay
+	}
+
+	if params.Budget <= 0 {
+		params.Budget = defaultHedgeBudget
+	}
+
+	if params.Budget > 1 {
+		params.Budget = 1
+	}
+
+	return &hedger{
+		params:    params,
+		sink:      sink,
+		latencies: make([]time.Duration, 0, hedgeLatencies),
+	}
+}
+
+// hedgeResult is the result of a single attempt.
+type hedgeResult struct {
+	resp *Response
+	err  error
+}
+
+// interceptor returns the interceptor hedging GET requests.
+func (h *hedger) interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			// only idempotent requests may be sent twice
+			if call.Request.Method != http.MethodGet {
+				return next(ctx, call)
+			}
+
+			h.earn()
+
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			// the buffer lets the losing attempt finish after the result is returned
+			results := make(chan hedgeResult, 2)
+
+			attempt := func() {
+				start := time.Now()
+
+				attemptCall := *call
+				attemptCall.Request = call.Request.Clone(ctx)
+
+				resp, err := next(ctx, &attemptCall)
+				if err == nil {
+					h.observe(time.Since(start))
+				}
+
+				results <- hedgeResult{resp: resp, err: err}
+			}
+
+			go attempt()
+
+			timer := time.NewTimer(h.delay())
+			defer timer.Stop()
+
+			pending := 1
+
+			for {
+				select {
+				case <-timer.C:
+					if h.spend() {
+						h.sink.AddCounter(MetricHedgedRequests, 1)
+
+						pending++
+
+						go attempt()
+					}
+				case result := <-results:
+					pending--
+
+					// the failed attempt is returned only if there is no other one to wait for
+					if result.err == nil || pending == 0 {
+						return result.resp, result.err
+					}
+				}
+			}
+		}
+	}
+}
+
+// delay returns the time to wait before the hedged request.
+func (h *hedger) delay() time.Duration {
+	if h.params.Delay > 0 {
+		return h.params.Delay
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < hedgeMinLatencies {
+		return h.params.InitialDelay
+	}
+
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	return sorted[int(h.params.Percentile*float64(len(sorted)-1))]
+}
+
+// observe records the latency of the successful attempt.
+func (h *hedger) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < hedgeLatencies {
+		h.latencies = append(h.latencies, latency)
+
+		return
+	}
+
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgeLatencies
+}
+
+// earn adds Budget to the budget, it's called for every request.
+func (h *hedger) earn() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tokens += h.params.Budget
+	if h.tokens > hedgeMaxTokens {
+		h.tokens = hedgeMaxTokens
+	}
+}
+
+// spend reports whether the budget allows the hedged request and takes it from the budget.
+func (h *hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.tokens < 1 {
+		return false
+	}
+
+	h.tokens--
+
+	return true
+}
@@ -0,0 +1,158 @@
+package simplegeoip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestHedging tests that the hedged request answers when the first one is slow.
+func TestHedging(t *testing.T) {
+	var requests atomic.Int32
+
+	release := make(chan struct{})
+	defer close(release)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the first request hangs until the test ends or the request is canceled
+		if requests.Add(1) == 1 {
+			select {
+			case <-release:
+			case <-req.Context().Done():
+			}
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(apiKey, ClientParams{
+		HTTPClient:   server.Client(),
+		GeoipBaseURL: apiURL,
+		Hedging:      &HedgingParams{Delay: 20 * time.Millisecond, Budget: 1},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	geoipResp, _, err := client.Get(ctx, OptionIPAddress("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if geoipResp.IP != "8.8.8.8" {
+		t.Errorf("IP = %s, want 8.8.8.8", geoipResp.IP)
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+
+	// the canceled attempt is counted once it has finished
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		rec := httptest.NewRecorder()
+		client.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		text := rec.Body.String()
+		if strings.Contains(text, `geoip_requests_total{outcome="canceled"} 1`) {
+			if !strings.Contains(text, MetricHedgedRequests+" 1\n") ||
+				!strings.Contains(text, `geoip_requests_total{outcome="success"} 1`) {
+				t.Errorf("metrics have no hedged attempts:\n%s", text)
+			}
+
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("canceled attempt is not counted:\n%s", text)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestHedgingBudget tests that hedged requests are limited by the budget and sent for GET requests only.
+func TestHedgingBudget(t *testing.T) {
+	var calls atomic.Int32
+
+	h := newHedger(HedgingParams{Delay: time.Millisecond, Budget: 0.5}, NewMetrics())
+
+	handler := h.interceptor()(func(ctx context.Context, call *Call) (*Response, error) {
+		calls.Add(1)
+
+		select {
+		case <-time.After(20 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		return &Response{}, nil
+	})
+
+	for i := 0; i < 4; i++ {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := handler(context.Background(), &Call{Request: req}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every second request is hedged
+	if n := calls.Load(); n != 6 {
+		t.Errorf("got %d calls, want 6", n)
+	}
+
+	calls.Store(0)
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handler(context.Background(), &Call{Request: req}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("POST request: got %d calls, want 1", n)
+	}
+}
+
+// TestHedgingDelay tests the percentile delay.
+func TestHedgingDelay(t *testing.T) {
+	h := newHedger(HedgingParams{Percentile: 0.9, InitialDelay: time.Second}, NewMetrics())
+
+	for i := 1; i < hedgeMinLatencies; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	if d := h.delay(); d != time.Second {
+		t.Errorf("delay() = %s, want initial delay", d)
+	}
+
+	for i := hedgeMinLatencies; i <= 2*hedgeLatencies; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	// the latest 100 latencies are 101..200ms
+	if d := h.delay(); d != 190*time.Millisecond {
+		t.Errorf("delay() = %s, want 190ms", d)
+	}
+}
@@ -0,0 +1,122 @@
+package simplegeoip
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Call is the API call passed through the interceptors.
+type Call struct {
+	// Options are the query options of the call
+	Options []Option
+
+	// Request is the HTTP request built from the options. Interceptors may modify it before calling next
+	Request *http.Request
+
+	// decode decodes the body while it's read, it's set by Get
+	decode decodeFunc
+}
+
+// Handler performs the API call and returns the response with Body read. Body of Get calls is empty
+// unless ClientParams.RetainBody is set, as the response is decoded while it's read.
+// The response is not nil if the server has answered, even when the error is returned.
+type Handler func(ctx context.Context, call *Call) (*Response, error)
+
+// Interceptor wraps Handler to add behavior around API calls.
+type Interceptor func(next Handler) Handler
+
+var _ = []Interceptor{
+	InterceptorHeader("X-Request-Source", "example"),
+	InterceptorLogging(log.Default()),
+}
+
+// chain wraps the handler with the interceptors. The first interceptor is the outermost one.
+func chain(handler Handler, interceptors []Interceptor) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		handler = interceptors[i](handler)
+	}
+
+	return handler
+}
+
+// send is the innermost Handler executing the request with Client.Do.
+func (c *Client) send(ctx context.Context, call *Call) (*Response, error) {
+	var collector *timingCollector
+	if c.collectTiming {
+		ctx, collector = newTimingCollector(ctx)
+	}
+
+	response := &Response{}
+
+	resp, err := c.do(ctx, call.Request, func(body io.Reader) error {
+		return c.readBody(body, call, response)
+	})
+
+	response.Response = resp
+
+	if collector != nil {
+		response.Timing = collector.finish()
+	}
+
+	return response, err
+}
+
+// InterceptorHeader sets the header on every request.
+func InterceptorHeader(key, value string) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			call.Request.Header.Set(key, value)
+
+			return next(ctx, call)
+		}
+	}
+}
+
+// InterceptorLogging logs every request with its status code, duration and error. The API key is redacted.
+func InterceptorLogging(logger *log.Logger) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			start := time.Now()
+
+			resp, err := next(ctx, call)
+
+			status := 0
+			if resp != nil && resp.Response != nil {
+				status = resp.StatusCode
+			}
+
+			if err != nil {
+				logger.Printf("%s %s: status %d in %s: %v",
+					call.Request.Method, RedactURL(call.Request.URL), status, time.Since(start), err)
+			} else {
+				logger.Printf("%s %s: status %d in %s",
+					call.Request.Method, RedactURL(call.Request.URL), status, time.Since(start))
+			}
+
+			return resp, err
+		}
+	}
+}
+
+// RedactURL returns the URL as a string with the API key replaced.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	query := u.Query()
+	if query.Get("apiKey") == "" {
+		return u.String()
+	}
+
+	query.Set("apiKey", "REDACTED")
+
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+
+	return redacted.String()
+}
@@ -0,0 +1,117 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestInterceptors tests the interceptors order and the built-in interceptors.
+func TestInterceptors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(`{"ip":"` + req.URL.Query().Get("ipAddress") + `","isp":"` + req.Header.Get("X-Team") + `"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+
+	tracer := func(name string) Interceptor {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) (*Response, error) {
+				order = append(order, name+" before "+strings.Join(callQuery(call)["ipAddress"], ""))
+
+				resp, err := next(ctx, call)
+
+				order = append(order, name+" after "+string(resp.Body[:6]))
+
+				return resp, err
+			}
+		}
+	}
+
+	var logs bytes.Buffer
+
+	client := NewClient(apiKey, ClientParams{
+		HTTPClient:   server.Client(),
+		GeoipBaseURL: apiURL,
+		RetainBody:   true,
+		Interceptors: []Interceptor{
+			tracer("outer"),
+			InterceptorLogging(log.New(&logs, "", 0)),
+			InterceptorHeader("X-Team", "geo"),
+			tracer("inner"),
+		},
+	})
+
+	got, _, err := client.Get(context.Background(), OptionIPAddress("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ISP != "geo" {
+		t.Errorf("header is not set, ISP = %q", got.ISP)
+	}
+
+	want := []string{"outer before 8.8.8.8", "inner before 8.8.8.8", "inner after {\"ip\":", "outer after {\"ip\":"}
+	if strings.Join(order, "|") != strings.Join(want, "|") {
+		t.Errorf("order = %q, want %q", order, want)
+	}
+
+	logged := logs.String()
+	if strings.Contains(logged, apiKey) || !strings.Contains(logged, "apiKey=REDACTED") ||
+		!strings.Contains(logged, ": status 200 in ") {
+		t.Errorf("log = %q", logged)
+	}
+}
+
+// callQuery returns the query the call options produce.
+func callQuery(call *Call) url.Values {
+	query := url.Values{}
+	for _, opt := range call.Options {
+		opt(query)
+	}
+
+	return query
+}
+
+// TestRedactURL tests the API key redaction.
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "API key",
+			url:  "https://ip-geolocation.whoisxmlapi.com/api/v1?apiKey=secret&ipAddress=8.8.8.8",
+			want: "https://ip-geolocation.whoisxmlapi.com/api/v1?apiKey=REDACTED&ipAddress=8.8.8.8",
+		},
+		{
+			name: "no API key",
+			url:  "https://ip-geolocation.whoisxmlapi.com/api/v1?ipAddress=8.8.8.8",
+			want: "https://ip-geolocation.whoisxmlapi.com/api/v1?ipAddress=8.8.8.8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := RedactURL(u); got != tt.want {
+				t.Errorf("RedactURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package simplegeoip
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Attribute keys of log records written with ClientParams.Logger and CacheParams.Logger.
+const (
+	LogKeyMethod   = "geoip.method"
+	LogKeyURL      = "geoip.url"
+	LogKeyStatus   = "geoip.status"
+	LogKeyLatency  = "geoip.latency"
+	LogKeyBytes    = "geoip.bytes"
+	LogKeyBody     = "geoip.body"
+	LogKeyError    = "geoip.error"
+	LogKeyCacheKey = "geoip.cache_key"
+	LogKeyTiming   = "geoip.timing"
+	LogKeyAttempt  = "geoip.attempt"
+	LogKeyBackoff  = "geoip.backoff"
+)
+
+// maxLoggedBody is the maximum number of body bytes logged at debug level.
+const maxLoggedBody = 512
+
+// interceptorSlog logs start and finish of every API call. The response body is logged at debug level only.
+func interceptorSlog(logger *slog.Logger) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			u := RedactURL(call.Request.URL)
+
+			logger.LogAttrs(ctx, slog.LevelDebug, "geoip request started",
+				slog.String(LogKeyMethod, call.Request.Method),
+				slog.String(LogKeyURL, u))
+
+			start := time.Now()
+
+			resp, err := next(ctx, call)
+
+			attrs := []slog.Attr{
+				slog.String(LogKeyMethod, call.Request.Method),
+				slog.String(LogKeyURL, u),
+				slog.Duration(LogKeyLatency, time.Since(start)),
+			}
+
+			if resp != nil && resp.Timing != nil {
+				attrs = append(attrs, resp.Timing.logAttr())
+			}
+
+			if resp != nil && resp.Response != nil {
+				attrs = append(attrs,
+					slog.Int(LogKeyStatus, resp.StatusCode),
+					slog.Int64(LogKeyBytes, resp.size()))
+
+				if logger.Enabled(ctx, slog.LevelDebug) {
+					attrs = append(attrs, slog.String(LogKeyBody, truncateBody(resp.Body)))
+				}
+			}
+
+			if err != nil {
+				logger.LogAttrs(ctx, slog.LevelError, "geoip request failed",
+					append(attrs, slog.String(LogKeyError, err.Error()))...)
+
+				return resp, err
+			}
+
+			logger.LogAttrs(ctx, slog.LevelInfo, "geoip request finished", attrs...)
+
+			return resp, nil
+		}
+	}
+}
+
+// truncateBody returns the body as a string cut to maxLoggedBody bytes.
+func truncateBody(body []byte) string {
+	if len(body) <= maxLoggedBody {
+		return string(body)
+	}
+
+	return string(body[:maxLoggedBody]) + "...(truncated)"
+}
+
+// logDecodeFailure logs the response that cannot be parsed.
+func logDecodeFailure(ctx context.Context, logger *slog.Logger, resp *Response, err error) {
+	if logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String(LogKeyError, err.Error())}
+
+	if resp != nil && resp.Response != nil {
+		attrs = append(attrs, slog.Int(LogKeyStatus, resp.StatusCode))
+
+		if resp.Request != nil {
+			attrs = append(attrs, slog.String(LogKeyURL, RedactURL(resp.Request.URL)))
+		}
+	}
+
+	if resp != nil && logger.Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, slog.String(LogKeyBody, truncateBody(resp.Body)))
+	}
+
+	logger.LogAttrs(ctx, slog.LevelError, "geoip response decode failed", attrs...)
+}
@@ -0,0 +1,104 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestLogging tests the log records of API calls, decode failures and cache hits.
+func TestLogging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ipAddress") == "0.0.0.0" {
+			_, _ = w.Write([]byte(`<html>` + strings.Repeat("x", 2*maxLoggedBody)))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client := NewClient(apiKey, ClientParams{
+		HTTPClient:   server.Client(),
+		GeoipBaseURL: apiURL,
+		Logger:       logger,
+		RetainBody:   true,
+	})
+	cache := NewCache(client.GeoipService, CacheParams{Logger: logger})
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := cache.Get(ctx, OptionIPAddress("8.8.8.8")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := client.Get(ctx, OptionIPAddress("0.0.0.0")); err == nil {
+		t.Fatal("Get() expected decode error")
+	}
+
+	if strings.Contains(logs.String(), apiKey) {
+		t.Errorf("API key is logged: %s", logs.String())
+	}
+
+	var records []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, record)
+	}
+
+	want := []struct {
+		msg  string
+		keys []string
+	}{
+		{msg: "geoip cache miss", keys: []string{LogKeyCacheKey}},
+		{msg: "geoip request started", keys: []string{LogKeyMethod, LogKeyURL}},
+		{msg: "geoip request finished", keys: []string{LogKeyStatus, LogKeyLatency, LogKeyBytes, LogKeyBody}},
+		{msg: "geoip cache hit", keys: []string{LogKeyCacheKey}},
+		{msg: "geoip request started", keys: []string{LogKeyURL}},
+		{msg: "geoip request finished", keys: []string{LogKeyStatus}},
+		{msg: "geoip response decode failed", keys: []string{LogKeyError, LogKeyStatus, LogKeyURL, LogKeyBody}},
+	}
+
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %s", len(records), len(want), logs.String())
+	}
+
+	for i, w := range want {
+		if records[i]["msg"] != w.msg {
+			t.Errorf("record %d msg = %v, want %v", i, records[i]["msg"], w.msg)
+		}
+
+		for _, key := range w.keys {
+			if _, ok := records[i][key]; !ok {
+				t.Errorf("record %d has no %s: %v", i, key, records[i])
+			}
+		}
+	}
+
+	if body, _ := records[6][LogKeyBody].(string); !strings.HasSuffix(body, "...(truncated)") {
+		t.Errorf("body is not truncated: %q", body)
+	}
+}
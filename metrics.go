@@ -0,0 +1,312 @@
+package simplegeoip
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of metrics recorded by Client, Cache and RateLimiter. Custom interceptors can record them with Client.Metrics.
+const (
+	MetricRequests        = "geoip_requests_total"
+	MetricRequestDuration = "geoip_request_duration_seconds"
+	MetricResponseBytes   = "geoip_response_bytes_total"
+	MetricRetries         = "geoip_retries_total"
+	MetricCacheRequests   = "geoip_cache_requests_total"
+	MetricRateLimitWait   = "geoip_rate_limit_wait_seconds"
+	MetricRequestPhase    = "geoip_request_phase_seconds"
+)
+
+// Outcomes reported in the "outcome" label of MetricRequests.
+const (
+	OutcomeSuccess      = "success"
+	OutcomeHTTPError    = "http_error"
+	OutcomeNetworkError = "network_error"
+	OutcomeCircuitOpen  = "circuit_open"
+	OutcomeCanceled     = "canceled"
+)
+
+// metricHelp is the help text of the known metrics.
+var metricHelp = map[string]string{
+	MetricRequests:        "Number of API requests by outcome.",
+	MetricRequestDuration: "Duration of API requests in seconds.",
+	MetricResponseBytes:   "Number of response body bytes read.",
+	MetricRetries:         "Number of retried API requests.",
+	MetricCacheRequests:   "Number of cache lookups by result.",
+	MetricRateLimitWait:   "Time spent waiting for the rate limiter in seconds.",
+	MetricRequestPhase:    "Duration of API request phases in seconds.",
+	MetricHedgedRequests:  "Number of hedged API requests.",
+}
+
+// metricBuckets are the upper bounds of histogram buckets. All histograms are in seconds.
+var metricBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Label is the metric label.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// MetricsSink receives metrics recorded by Client and Cache. Implement it to export metrics to other backends.
+type MetricsSink interface {
+	// AddCounter adds the delta to the counter
+	AddCounter(name string, delta float64, labels ...Label)
+
+	// ObserveHistogram records the value in the histogram
+	ObserveHistogram(name string, value float64, labels ...Label)
+}
+
+// Metrics is the in-memory MetricsSink exposing metrics in Prometheus text format.
+type Metrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+var _ MetricsSink = &Metrics{}
+
+// histogram is the cumulative histogram with metricBuckets.
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewMetrics creates empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// AddCounter adds the delta to the counter.
+func (m *Metrics) AddCounter(name string, delta float64, labels ...Label) {
+	key := formatLabels(labels)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+
+	series[key] += delta
+}
+
+// ObserveHistogram records the value in the histogram.
+func (m *Metrics) ObserveHistogram(name string, value float64, labels ...Label) {
+	key := formatLabels(labels)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.histograms[name]
+	if !ok {
+		series = make(map[string]*histogram)
+		m.histograms[name] = series
+	}
+
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(metricBuckets))}
+		series[key] = h
+	}
+
+	for i, bound := range metricBuckets {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+// Handler returns the handler serving the metrics in Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bw := bufio.NewWriter(w)
+		m.write(bw)
+		_ = bw.Flush()
+	})
+}
+
+// write writes the metrics in Prometheus text format sorted by name and labels.
+func (m *Metrics) write(w *bufio.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range sortedKeys(m.counters) {
+		writeHeader(w, name, "counter")
+
+		series := m.counters[name]
+		for _, labels := range sortedKeys(series) {
+			writeSample(w, name, labels, series[labels])
+		}
+	}
+
+	for _, name := range sortedKeys(m.histograms) {
+		writeHeader(w, name, "histogram")
+
+		series := m.histograms[name]
+		for _, labels := range sortedKeys(series) {
+			h := series[labels]
+
+			for i, bound := range metricBuckets {
+				writeSample(w, name+"_bucket", joinLabels(labels, `le="`+formatFloat(bound)+`"`), float64(h.buckets[i]))
+			}
+
+			writeSample(w, name+"_bucket", joinLabels(labels, `le="+Inf"`), float64(h.count))
+			writeSample(w, name+"_sum", labels, h.sum)
+			writeSample(w, name+"_count", labels, float64(h.count))
+		}
+	}
+}
+
+// writeHeader writes HELP and TYPE lines of the metric.
+func writeHeader(w *bufio.Writer, name, typ string) {
+	if help, ok := metricHelp[name]; ok {
+		_, _ = w.WriteString("# HELP " + name + " " + help + "\n")
+	}
+
+	_, _ = w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// writeSample writes the sample line.
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	_, _ = w.WriteString(name)
+
+	if labels != "" {
+		_, _ = w.WriteString("{" + labels + "}")
+	}
+
+	_, _ = w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// formatLabels formats the labels sorted by name. The result is used both as the series key and in the output.
+func formatLabels(labels []Label) string {
+	switch len(labels) {
+	case 0:
+		return ""
+	case 1:
+		return labels[0].Name + `="` + labelEscaper.Replace(labels[0].Value) + `"`
+	}
+
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	parts := make([]string, len(sorted))
+	for i, label := range sorted {
+		parts[i] = label.Name + `="` + labelEscaper.Replace(label.Value) + `"`
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// labelEscaper escapes label values as required by Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// joinLabels appends the label to the formatted labels.
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+
+	return labels + "," + label
+}
+
+// formatFloat formats the value as Prometheus does.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys[V interface{}](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// multiSink records metrics to all sinks.
+type multiSink []MetricsSink
+
+// AddCounter adds the delta to the counter of all sinks.
+func (s multiSink) AddCounter(name string, delta float64, labels ...Label) {
+	for _, sink := range s {
+		sink.AddCounter(name, delta, labels...)
+	}
+}
+
+// ObserveHistogram records the value in the histogram of all sinks.
+func (s multiSink) ObserveHistogram(name string, value float64, labels ...Label) {
+	for _, sink := range s {
+		sink.ObserveHistogram(name, value, labels...)
+	}
+}
+
+// interceptorMetrics records the outcome, the duration and the body size of every HTTP request.
+func interceptorMetrics(sink MetricsSink) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			start := time.Now()
+
+			resp, err := next(ctx, call)
+
+			outcome := OutcomeSuccess
+
+			switch {
+			case errors.Is(err, ErrCircuitOpen):
+				outcome = OutcomeCircuitOpen
+			case errors.Is(err, context.Canceled):
+				outcome = OutcomeCanceled
+			case resp == nil || resp.Response == nil:
+				outcome = OutcomeNetworkError
+			case checkResponse(resp.Response) != nil:
+				outcome = OutcomeHTTPError
+			case err != nil:
+				outcome = OutcomeNetworkError
+			}
+
+			sink.AddCounter(MetricRequests, 1, Label{Name: "outcome", Value: outcome})
+			sink.ObserveHistogram(MetricRequestDuration, time.Since(start).Seconds())
+
+			if resp != nil {
+				sink.AddCounter(MetricResponseBytes, float64(resp.size()))
+			}
+
+			if resp != nil && resp.Timing != nil {
+				for _, phase := range resp.Timing.phases() {
+					sink.ObserveHistogram(MetricRequestPhase, phase.duration.Seconds(), Label{Name: "phase", Value: phase.name})
+				}
+			}
+
+			return resp, err
+		}
+	}
+}
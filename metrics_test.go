@@ -0,0 +1,148 @@
+package simplegeoip
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingSink records counter names.
+type recordingSink struct {
+	mu       sync.Mutex
+	counters []string
+}
+
+// AddCounter records the counter name.
+func (s *recordingSink) AddCounter(name string, delta float64, labels ...Label) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters = append(s.counters, name)
+}
+
+// ObserveHistogram does nothing.
+func (s *recordingSink) ObserveHistogram(name string, value float64, labels ...Label) {}
+
+// TestMetrics tests metrics of API calls and cache lookups in Prometheus text format.
+func TestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ipAddress") == "0.0.0.0" {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &recordingSink{}
+
+	client := NewClient(apiKey, ClientParams{
+		HTTPClient:   server.Client(),
+		GeoipBaseURL: apiURL,
+		MetricsSink:  sink,
+	})
+	cache := NewCache(client.GeoipService, CacheParams{MetricsSink: client.Metrics()})
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := cache.Get(ctx, OptionIPAddress("8.8.8.8")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := client.GetRaw(ctx, OptionIPAddress("0.0.0.0")); err == nil {
+		t.Fatal("GetRaw() expected error")
+	}
+
+	unreachable := NewClient(apiKey, ClientParams{
+		GeoipBaseURL: &url.URL{Scheme: "http", Host: "127.0.0.1:1"},
+	})
+	if _, err := unreachable.GetRaw(ctx); err == nil {
+		t.Fatal("GetRaw() expected error")
+	}
+
+	rec := httptest.NewRecorder()
+	client.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+
+	want := []string{
+		"# HELP geoip_requests_total Number of API requests by outcome.",
+		"# TYPE geoip_requests_total counter",
+		`geoip_requests_total{outcome="success"} 1`,
+		`geoip_requests_total{outcome="http_error"} 1`,
+		`geoip_cache_requests_total{result="hit"} 1`,
+		`geoip_cache_requests_total{result="miss"} 1`,
+		"geoip_response_bytes_total 16",
+		"# TYPE geoip_request_duration_seconds histogram",
+		`geoip_request_duration_seconds_bucket{le="+Inf"} 2`,
+		"geoip_request_duration_seconds_count 2",
+	}
+
+	for _, line := range want {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("metrics have no %q:\n%s", line, text)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	unreachable.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if !strings.Contains(rec.Body.String(), `geoip_requests_total{outcome="network_error"} 1`) {
+		t.Errorf("network error is not counted:\n%s", rec.Body.String())
+	}
+
+	if len(sink.counters) != 6 {
+		t.Errorf("sink got %d counters, want 6: %v", len(sink.counters), sink.counters)
+	}
+}
+
+// TestFormatLabels tests label sorting and escaping.
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []Label
+		want   string
+	}{
+		{
+			name: "empty",
+			want: "",
+		},
+		{
+			name:   "sorted",
+			labels: []Label{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}},
+			want:   `a="1",b="2"`,
+		},
+		{
+			name:   "escaped",
+			labels: []Label{{Name: "a", Value: "x\"y\\z\n"}},
+			want:   `a="x\"y\\z\n"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatLabels(tt.labels); got != tt.want {
+				t.Errorf("formatLabels() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package simplegeoip
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMiddlewareBudget is the default time the request waits for the lookup.
+	defaultMiddlewareBudget = 100 * time.Millisecond
+
+	// defaultMiddlewareLookupTimeout is the default timeout of lookups continued after the budget.
+	defaultMiddlewareLookupTimeout = 10 * time.Second
+)
+
+// MiddlewareParams is used to create Middleware. Service is mandatory.
+type MiddlewareParams struct {
+	// Service looks up client IP addresses. It's wrapped in Cache with CacheParams unless it's Cache already
+	Service GeoipService
+
+	// CacheParams are parameters of the cache created for Service
+	CacheParams CacheParams
+
+	// TrustedProxies are networks of proxies whose forwarding headers are trusted, see ClientIP.
+	// If it's empty then the peer address is the client IP
+	TrustedProxies []netip.Prefix
+
+	// Budget is the maximum time the request waits for the lookup. If it's exceeded then the request
+	// is handled without the result, and the lookup goes on to warm the cache. Default: 100 milliseconds
+	Budget time.Duration
+
+	// LookupTimeout is the timeout of lookups continued after the budget. Default: 10 seconds
+	LookupTimeout time.Duration
+
+	// Options are added to the query of every lookup, e.g. OptionReverseIP(0)
+	Options []Option
+}
+
+// Middleware is the net/http middleware looking up the client IP of requests.
+// Handlers read the result with GeoIPFromContext.
+type Middleware struct {
+	service GeoipService
+	params  MiddlewareParams
+
+	mu sync.Mutex
+
+	// inflight are results of running lookups by client IP, so concurrent requests share one lookup
+	inflight map[netip.Addr]*middlewareLookup
+}
+
+// middlewareLookup is the running lookup, done is closed when the result is set.
+type middlewareLookup struct {
+	done chan struct{}
+	resp *GeoIPResponse
+	err  error
+}
+
+// geoContextKey is the context key of the lookup result.
+type geoContextKey struct{}
+
+// geoContext is the lookup result stored in the request context.
+type geoContext struct {
+	addr netip.Addr
+	resp *GeoIPResponse
+	err  error
+}
+
+// NewMiddleware creates Middleware with specified parameters.
+func NewMiddleware(params MiddlewareParams) (*Middleware, error) {
+	if params.Service == nil {
+		return nil, &ArgError{Name: "Service", Message: "cannot be nil"}
+	}
+
+	if params.Budget <= 0 {
+		params.Budget = defaultMiddlewareBudget
+	}
+
+	if params.LookupTimeout <= 0 {
+		params.LookupTimeout = defaultMiddlewareLookupTimeout
+	}
+
+	service := params.Service
+	if _, ok := service.(*Cache); !ok {
+		service = NewCache(service, params.CacheParams)
+	}
+
+	return &Middleware{
+		service:  service,
+		params:   params,
+		inflight: make(map[netip.Addr]*middlewareLookup),
+	}, nil
+}
+
+// Handler returns the handler looking up the client IP before calling next.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+
+		geo := &geoContext{addr: ClientIP(req, m.params.TrustedProxies)}
+		geo.resp, geo.err = m.Lookup(ctx, geo.addr)
+
+		next.ServeHTTP(w, req.WithContext(context.WithValue(ctx, geoContextKey{}, geo)))
+	})
+}
+
+// Lookup looks up the address within the budget, it fails with context.DeadlineExceeded if the budget is exceeded.
+// Private, loopback and invalid addresses are not looked up, the result is nil for them.
+func (m *Middleware) Lookup(ctx context.Context, addr netip.Addr) (*GeoIPResponse, error) {
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return nil, nil
+	}
+
+	lookup := m.start(ctx, addr)
+
+	timer := time.NewTimer(m.params.Budget)
+	defer timer.Stop()
+
+	select {
+	case <-lookup.done:
+		return lookup.resp, lookup.err
+	case <-timer.C:
+		return nil, context.DeadlineExceeded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start starts the lookup of the address unless it's running already.
+func (m *Middleware) start(ctx context.Context, addr netip.Addr) *middlewareLookup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if lookup, ok := m.inflight[addr]; ok {
+		return lookup
+	}
+
+	lookup := &middlewareLookup{done: make(chan struct{})}
+	m.inflight[addr] = lookup
+
+	// the lookup outlives the request to warm the cache
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.params.LookupTimeout)
+
+	go func() {
+		defer cancel()
+
+		opts := append([]Option{OptionIPAddress(addr.String())}, m.params.Options...)
+		lookup.resp, _, lookup.err = m.service.Get(ctx, opts...)
+
+		m.mu.Lock()
+		delete(m.inflight, addr)
+		m.mu.Unlock()
+
+		close(lookup.done)
+	}()
+
+	return lookup
+}
+
+// GeoIPFromContext returns the client location stored by Middleware. It's nil if the request hasn't passed
+// through Middleware, the client IP is unknown or private, or the lookup has failed or exceeded the budget.
+// The response is shared by concurrent requests, so it must not be modified.
+func GeoIPFromContext(ctx context.Context) *GeoIPResponse {
+	geo, _ := ctx.Value(geoContextKey{}).(*geoContext)
+	if geo == nil {
+		return nil
+	}
+
+	return geo.resp
+}
+
+// ClientIPFromContext returns the client IP found by Middleware.
+func ClientIPFromContext(ctx context.Context) (netip.Addr, bool) {
+	geo, _ := ctx.Value(geoContextKey{}).(*geoContext)
+	if geo == nil || !geo.addr.IsValid() {
+		return netip.Addr{}, false
+	}
+
+	return geo.addr, true
+}
+
+// LookupErrorFromContext returns the error of the lookup made by Middleware.
+// It's context.DeadlineExceeded if the lookup has exceeded the budget.
+func LookupErrorFromContext(ctx context.Context) error {
+	geo, _ := ctx.Value(geoContextKey{}).(*geoContext)
+	if geo == nil {
+		return nil
+	}
+
+	return geo.err
+}
@@ -0,0 +1,173 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowService is the GeoipService answering with the queried IP address after the delay, 203.0.113.1 is not found.
+type slowService struct {
+	delay time.Duration
+	calls atomic.Int32
+}
+
+// Get returns the response with the queried IP address after the delay.
+func (s *slowService) Get(ctx context.Context, opts ...Option) (*GeoIPResponse, *Response, error) {
+	s.calls.Add(1)
+
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	values := url.Values{}
+	for _, opt := range opts {
+		opt(values)
+	}
+
+	if values.Get("ipAddress") == "203.0.113.1" {
+		return nil, nil, ErrNotFound
+	}
+
+	return &GeoIPResponse{IP: values.Get("ipAddress")}, &Response{}, nil
+}
+
+// GetRaw is not used by Middleware.
+func (s *slowService) GetRaw(ctx context.Context, opts ...Option) (*Response, error) {
+	_, resp, err := s.Get(ctx, opts...)
+
+	return resp, err
+}
+
+// TestMiddleware tests the lookup result in the request context.
+func TestMiddleware(t *testing.T) {
+	service := &slowService{}
+
+	middleware, err := NewMiddleware(MiddlewareParams{
+		Service:        service,
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+		Budget:         time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  string
+		wantIP        string
+		wantLocation  string
+		wantErr       error
+		wantNoClients bool
+	}{
+		{name: "direct", remoteAddr: "8.8.8.8:1234", wantIP: "8.8.8.8", wantLocation: "8.8.8.8"},
+		{name: "behind proxy", remoteAddr: "127.0.0.1:1234", forwardedFor: "1.1.1.1", wantIP: "1.1.1.1", wantLocation: "1.1.1.1"},
+		{name: "not found", remoteAddr: "203.0.113.1:1234", wantIP: "203.0.113.1"},
+		{name: "private", remoteAddr: "192.168.1.1:1234", wantIP: "192.168.1.1"},
+		{name: "unknown", remoteAddr: "127.0.0.1:1234", forwardedFor: "unknown", wantNoClients: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				geoIP   *GeoIPResponse
+				ip      netip.Addr
+				ok      bool
+				lookErr error
+			)
+
+			handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				geoIP = GeoIPFromContext(req.Context())
+				ip, ok = ClientIPFromContext(req.Context())
+				lookErr = LookupErrorFromContext(req.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if ok == tt.wantNoClients || ok && ip.String() != tt.wantIP {
+				t.Errorf("ClientIPFromContext() = %s, %v, want %s", ip, ok, tt.wantIP)
+			}
+
+			switch {
+			case tt.wantLocation == "" && geoIP != nil:
+				t.Errorf("GeoIPFromContext() = %+v, want nil", geoIP)
+			case tt.wantLocation != "" && (geoIP == nil || geoIP.IP != tt.wantLocation):
+				t.Errorf("GeoIPFromContext() = %+v, want %s", geoIP, tt.wantLocation)
+			}
+
+			if tt.name == "not found" && !errors.Is(lookErr, ErrNotFound) {
+				t.Errorf("LookupErrorFromContext() = %v, want %v", lookErr, ErrNotFound)
+			}
+		})
+	}
+
+	if GeoIPFromContext(context.Background()) != nil || LookupErrorFromContext(context.Background()) != nil {
+		t.Error("the context without the lookup has the result")
+	}
+
+	_, err = NewMiddleware(MiddlewareParams{})
+	checkErr(t, err, `invalid argument: "Service" cannot be nil`)
+}
+
+// TestMiddlewareBudget tests that slow lookups don't block requests and warm the cache once.
+func TestMiddlewareBudget(t *testing.T) {
+	service := &slowService{delay: 50 * time.Millisecond}
+
+	middleware, err := NewMiddleware(MiddlewareParams{Service: service, Budget: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := netip.MustParseAddr("8.8.8.8")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+
+			resp, err := middleware.Lookup(context.Background(), addr)
+			if resp != nil || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Lookup() = %v, %v, want %v", resp, err, context.DeadlineExceeded)
+			}
+
+			if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+				t.Errorf("Lookup() took %v", elapsed)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	time.Sleep(100 * time.Millisecond)
+
+	resp, err := middleware.Lookup(context.Background(), addr)
+	if err != nil || resp == nil || resp.IP != "8.8.8.8" {
+		t.Errorf("Lookup() = %v, %v after the cache is warmed", resp, err)
+	}
+
+	if calls := service.calls.Load(); calls != 1 {
+		t.Errorf("got %d lookups, want 1", calls)
+	}
+}
@@ -0,0 +1,354 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Data field types of the MaxMind DB data section.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// encoder serializes Go values into the MaxMind DB data section format.
+type encoder struct {
+	buf []byte
+}
+
+// encode appends the serialized value to the buffer.
+func (e *encoder) encode(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		e.writeControl(typeString, len(v))
+		e.buf = append(e.buf, v...)
+	case []byte:
+		e.writeControl(typeBytes, len(v))
+		e.buf = append(e.buf, v...)
+	case float64:
+		e.writeControl(typeDouble, 8)
+
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+		e.buf = append(e.buf, b[:]...)
+	case uint16:
+		e.writeUint(typeUint16, uint64(v))
+	case uint32:
+		e.writeUint(typeUint32, uint64(v))
+	case uint64:
+		e.writeUint(typeUint64, v)
+	case int32:
+		e.writeUint(typeInt32, uint64(uint32(v)))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+
+		e.writeControl(typeBool, size)
+	case []interface{}:
+		e.writeControl(typeArray, len(v))
+
+		for _, item := range v {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+	case []string:
+		e.writeControl(typeArray, len(v))
+
+		for _, item := range v {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		e.writeControl(typeMap, len(v))
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		// sorting keys makes the output deterministic and lets identical records share one offset
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if err := e.encode(key); err != nil {
+				return err
+			}
+
+			if err := e.encode(v[key]); err != nil {
+				return err
+			}
+		}
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[key] = val
+		}
+
+		return e.encode(m)
+	default:
+		return fmt.Errorf("cannot encode value of type %T", value)
+	}
+
+	return nil
+}
+
+// writeUint writes an unsigned integer using the minimal number of bytes.
+func (e *encoder) writeUint(typ int, v uint64) {
+	size := 0
+	for n := v; n > 0; n >>= 8 {
+		size++
+	}
+
+	e.writeControl(typ, size)
+
+	for i := size - 1; i >= 0; i-- {
+		e.buf = append(e.buf, byte(v>>(8*uint(i))))
+	}
+}
+
+// writeControl writes the control byte followed by the extended type and size bytes if required.
+func (e *encoder) writeControl(typ, size int) {
+	var ctrl byte
+
+	if typ <= typeMap {
+		ctrl = byte(typ) << 5
+	}
+
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+	case size < 65821:
+		ctrl |= 30
+	default:
+		ctrl |= 31
+	}
+
+	e.buf = append(e.buf, ctrl)
+
+	if typ > typeMap {
+		e.buf = append(e.buf, byte(typ-7))
+	}
+
+	switch {
+	case size < 29:
+	case size < 285:
+		e.buf = append(e.buf, byte(size-29))
+	case size < 65821:
+		s := size - 285
+		e.buf = append(e.buf, byte(s>>8), byte(s))
+	default:
+		s := size - 65821
+		e.buf = append(e.buf, byte(s>>16), byte(s>>8), byte(s))
+	}
+}
+
+// decoder deserializes values from the MaxMind DB data section.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value stored at the offset and the offset of the next value.
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	typ, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		value, _, err := d.decode(pointer)
+
+		return value, next, err
+	}
+
+	return d.decodeValue(typ, size, offset)
+}
+
+// decodeControl parses the control byte at the offset.
+func (d *decoder) decodeControl(offset uint) (typ int, size uint, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errInvalidData
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+
+	typ = int(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errInvalidData
+		}
+
+		typ = int(d.buf[offset]) + 7
+		offset++
+	}
+
+	size = uint(ctrl & 0x1f)
+	if typ == typePointer || size < 29 {
+		return typ, size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, 0, errInvalidData
+	}
+
+	v := uint(0)
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+
+	switch size {
+	case 29:
+		size = 29 + v
+	case 30:
+		size = 285 + v
+	default:
+		size = 65821 + v
+	}
+
+	return typ, size, offset + n, nil
+}
+
+// decodePointer resolves the pointer whose control byte size bits are passed in.
+func (d *decoder) decodePointer(size, offset uint) (uint, uint, error) {
+	n := (size>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errInvalidData
+	}
+
+	prefix := size & 0x7
+	if n == 4 {
+		prefix = 0
+	}
+
+	v := prefix
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+
+	return v, offset + n, nil
+}
+
+// decodeValue decodes a value of the known type and size.
+func (d *decoder) decodeValue(typ int, size, offset uint) (interface{}, uint, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errInvalidData
+			}
+
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			m[k] = value
+			offset = next
+		}
+
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			a = append(a, value)
+			offset = next
+		}
+
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeEndMarker, typeContainer:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errInvalidData
+	}
+
+	payload := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(payload), next, nil
+	case typeBytes:
+		return append([]byte(nil), payload...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errInvalidData
+		}
+
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errInvalidData
+		}
+
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), next, nil
+	case typeUint16, typeUint32, typeUint64, typeUint128:
+		v := uint64(0)
+		for _, b := range payload {
+			v = v<<8 | uint64(b)
+		}
+
+		return v, next, nil
+	case typeInt32:
+		v := uint32(0)
+		for _, b := range payload {
+			v = v<<8 | uint32(b)
+		}
+
+		return int64(int32(v)), next, nil
+	}
+
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
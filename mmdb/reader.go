@@ -0,0 +1,277 @@
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+var (
+	// ErrNotFound is returned when the database has no record for the IP address.
+	ErrNotFound = simplegeoip.ErrNotFound
+
+	// errInvalidData is returned when the database is corrupted.
+	errInvalidData = errors.New("invalid database data")
+)
+
+// Metadata is the metadata section of MaxMind DB file.
+type Metadata struct {
+	// NodeCount is the number of nodes in the search tree.
+	NodeCount uint
+
+	// RecordSize is the search tree record size in bits.
+	RecordSize uint
+
+	// IPVersion is 4 for IPv4-only databases and 6 otherwise.
+	IPVersion uint
+
+	// DatabaseType is the database type.
+	DatabaseType string
+
+	// Description is the database description by language.
+	Description map[string]string
+
+	// Languages is the list of locale codes the database may contain.
+	Languages []string
+
+	// BuildTime is the database build time.
+	BuildTime time.Time
+
+	// Source is the origin of the records. Empty for databases not built by Writer.
+	Source string
+}
+
+// Reader looks up records in MaxMind DB file.
+type Reader struct {
+	// Metadata is the database metadata
+	Metadata Metadata
+
+	tree      []byte
+	data      decoder
+	ipv4Start uint
+}
+
+// Open reads the MaxMind DB file.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read database: %w", err)
+	}
+
+	return NewReader(buf)
+}
+
+// NewReader creates Reader for MaxMind DB file contents.
+func NewReader(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataStartMarker)
+	if start == -1 {
+		return nil, fmt.Errorf("cannot parse database: %w", errors.New("metadata not found"))
+	}
+
+	metaDecoder := decoder{buf: buf[start+len(metadataStartMarker):]}
+
+	raw, _, err := metaDecoder.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse metadata: %w", err)
+	}
+
+	meta, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot parse metadata: %w", errInvalidData)
+	}
+
+	r := &Reader{
+		Metadata: Metadata{
+			NodeCount:    uint(uintValue(meta, "node_count")),
+			RecordSize:   uint(uintValue(meta, "record_size")),
+			IPVersion:    uint(uintValue(meta, "ip_version")),
+			DatabaseType: stringValue(meta, "database_type"),
+			Description:  map[string]string{},
+			BuildTime:    time.Unix(int64(uintValue(meta, "build_epoch")), 0).UTC(),
+			Source:       stringValue(meta, "source"),
+		},
+	}
+
+	if description, ok := meta["description"].(map[string]interface{}); ok {
+		for lang := range description {
+			r.Metadata.Description[lang] = stringValue(description, lang)
+		}
+	}
+
+	if languages, ok := meta["languages"].([]interface{}); ok {
+		for _, lang := range languages {
+			if s, ok := lang.(string); ok {
+				r.Metadata.Languages = append(r.Metadata.Languages, s)
+			}
+		}
+	}
+
+	switch r.Metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("cannot parse metadata: unsupported record size %d", r.Metadata.RecordSize)
+	}
+
+	treeSize := r.Metadata.NodeCount * r.Metadata.RecordSize / 4
+	if treeSize+dataSectionSeparatorSize > uint(start) {
+		return nil, fmt.Errorf("cannot parse database: %w", errInvalidData)
+	}
+
+	r.tree = buf[:treeSize]
+	r.data = decoder{buf: buf[treeSize+dataSectionSeparatorSize : start]}
+
+	if r.Metadata.IPVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.Metadata.NodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+
+	return r, nil
+}
+
+// Lookup returns the record for the IP address. The IP field is set to the address looked up.
+func (r *Reader) Lookup(ip net.IP) (*simplegeoip.GeoIPResponse, error) {
+	key := ip.To4()
+	start := uint(0)
+
+	switch {
+	case key != nil && r.Metadata.IPVersion == 6:
+		start = r.ipv4Start
+	case key == nil:
+		key = ip.To16()
+		if key == nil {
+			return nil, &simplegeoip.ArgError{Name: "ip", Message: "is not a valid IP address"}
+		}
+
+		if r.Metadata.IPVersion != 6 {
+			return nil, &simplegeoip.ArgError{Name: "ip", Message: "is IPv6 while the database is IPv4-only"}
+		}
+	}
+
+	nodeCount := r.Metadata.NodeCount
+	current := start
+
+	for i := 0; i < 8*len(key) && current < nodeCount; i++ {
+		current = r.record(current, bit(key, i))
+	}
+
+	if current == nodeCount {
+		return nil, ErrNotFound
+	}
+
+	if current < nodeCount {
+		return nil, fmt.Errorf("cannot look up %s: %w", ip, errInvalidData)
+	}
+
+	raw, _, err := r.data.decode(current - nodeCount - dataSectionSeparatorSize)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode record: %w", err)
+	}
+
+	record, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot decode record: %w", errInvalidData)
+	}
+
+	resp := parseRecord(record)
+	resp.IP = ip.String()
+
+	return resp, nil
+}
+
+// record returns the left (0) or right (1) record of the search tree node.
+func (r *Reader) record(node uint, side int) uint {
+	size := r.Metadata.RecordSize
+	b := r.tree[node*size/4 : (node+1)*size/4]
+
+	switch size {
+	case 24:
+		b = b[3*side:]
+
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if side == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b = b[4*side:]
+
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// parseRecord converts the data section record to the response.
+func parseRecord(record map[string]interface{}) *simplegeoip.GeoIPResponse {
+	var resp simplegeoip.GeoIPResponse
+
+	if location, ok := record["location"].(map[string]interface{}); ok {
+		resp.Location = simplegeoip.Location{
+			Country:    stringValue(location, "country"),
+			Region:     stringValue(location, "region"),
+			City:       stringValue(location, "city"),
+			Lat:        floatValue(location, "lat"),
+			Lng:        floatValue(location, "lng"),
+			PostalCode: stringValue(location, "postalCode"),
+			Timezone:   stringValue(location, "timezone"),
+			GeonameID:  uint(uintValue(location, "geonameId")),
+		}
+	}
+
+	resp.ISP = stringValue(record, "isp")
+	resp.ConnectionType = stringValue(record, "connectionType")
+
+	if domains, ok := record["domains"].([]interface{}); ok {
+		resp.Domains = make([]string, 0, len(domains))
+
+		for _, domain := range domains {
+			if s, ok := domain.(string); ok {
+				resp.Domains = append(resp.Domains, s)
+			}
+		}
+	}
+
+	if as, ok := record["as"].(map[string]interface{}); ok {
+		resp.AS = simplegeoip.AS{
+			ASN:    int(uintValue(as, "asn")),
+			Name:   stringValue(as, "name"),
+			Route:  stringValue(as, "route"),
+			Domain: stringValue(as, "domain"),
+			Type:   stringValue(as, "type"),
+		}
+	}
+
+	return &resp
+}
+
+// stringValue returns the string value of the key or an empty string.
+func stringValue(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+
+	return s
+}
+
+// floatValue returns the float value of the key or zero.
+func floatValue(m map[string]interface{}, key string) float64 {
+	f, _ := m[key].(float64)
+
+	return f
+}
+
+// uintValue returns the unsigned integer value of the key or zero.
+func uintValue(m map[string]interface{}, key string) uint64 {
+	switch v := m[key].(type) {
+	case uint64:
+		return v
+	case int64:
+		return uint64(v)
+	}
+
+	return 0
+}
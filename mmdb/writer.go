@@ -0,0 +1,400 @@
+// Package mmdb reads and writes IP Geolocation API results as MaxMind DB files.
+package mmdb
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+const (
+	// defaultDatabaseType is the database type stored in the metadata unless specified.
+	defaultDatabaseType = "GoSimpleGeoIP"
+
+	// defaultSource is the source stored in the metadata unless specified.
+	defaultSource = "IP Geolocation API"
+
+	// dataSectionSeparatorSize is the number of zero bytes between the search tree and the data section.
+	dataSectionSeparatorSize = 16
+)
+
+// metadataStartMarker precedes the metadata section.
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// WriterParams is used to create Writer. None of parameters are mandatory.
+type WriterParams struct {
+	// DatabaseType is the database type stored in the metadata. Default: "GoSimpleGeoIP"
+	DatabaseType string
+
+	// Description is the English description of the database
+	Description string
+
+	// Source is the origin of the records stored in the metadata. Default: "IP Geolocation API"
+	Source string
+
+	// BuildTime is the build time stored in the metadata. If it's zero then the time of writing is used
+	BuildTime time.Time
+}
+
+// Writer builds a MaxMind DB file from IP Geolocation API responses.
+type Writer struct {
+	params  WriterParams
+	entries []entry
+}
+
+// entry is a single network with its record.
+type entry struct {
+	network *net.IPNet
+	record  map[string]interface{}
+}
+
+// NewWriter creates Writer with specified parameters.
+func NewWriter(params WriterParams) *Writer {
+	if params.DatabaseType == "" {
+		params.DatabaseType = defaultDatabaseType
+	}
+
+	if params.Source == "" {
+		params.Source = defaultSource
+	}
+
+	return &Writer{params: params}
+}
+
+// Insert adds the response as the record for the network.
+// More specific networks take precedence over less specific ones regardless of the insertion order.
+func (w *Writer) Insert(network *net.IPNet, resp *simplegeoip.GeoIPResponse) error {
+	if network == nil {
+		return &simplegeoip.ArgError{Name: "network", Message: "is nil"}
+	}
+
+	if resp == nil {
+		return &simplegeoip.ArgError{Name: "resp", Message: "is nil"}
+	}
+
+	network, err := normalizeNetwork(network)
+	if err != nil {
+		return err
+	}
+
+	w.entries = append(w.entries, entry{network: network, record: newRecord(resp, true)})
+
+	return nil
+}
+
+// InsertIP adds the response as the record for its single IP address.
+func (w *Writer) InsertIP(resp *simplegeoip.GeoIPResponse) error {
+	if resp == nil {
+		return &simplegeoip.ArgError{Name: "resp", Message: "is nil"}
+	}
+
+	ip := net.ParseIP(resp.IP)
+	if ip == nil {
+		return &simplegeoip.ArgError{Name: "resp.IP", Message: "is not a valid IP address"}
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+
+	return w.Insert(&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, resp)
+}
+
+// InsertRoute adds the response as the record for its autonomous system route.
+// Domains are not stored as they belong to the single IP address rather than the whole route.
+func (w *Writer) InsertRoute(resp *simplegeoip.GeoIPResponse) error {
+	if resp == nil {
+		return &simplegeoip.ArgError{Name: "resp", Message: "is nil"}
+	}
+
+	_, network, err := net.ParseCIDR(resp.AS.Route)
+	if err != nil {
+		return &simplegeoip.ArgError{Name: "resp.AS.Route", Message: "is not a valid CIDR"}
+	}
+
+	network, err = normalizeNetwork(network)
+	if err != nil {
+		return err
+	}
+
+	w.entries = append(w.entries, entry{network: network, record: newRecord(resp, false)})
+
+	return nil
+}
+
+// WriteTo writes the MaxMind DB file.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	ipVersion := 4
+	for _, e := range w.entries {
+		if e.network.IP.To4() == nil {
+			ipVersion = 6
+
+			break
+		}
+	}
+
+	entries := make([]entry, len(w.entries))
+	copy(entries, w.entries)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		iOnes, _ := entries[i].network.Mask.Size()
+		jOnes, _ := entries[j].network.Mask.Size()
+
+		return iOnes < jOnes
+	})
+
+	var data encoder
+
+	offsets := make(map[string]int)
+	root := &node{}
+
+	for _, e := range entries {
+		var rec encoder
+		if err := rec.encode(e.record); err != nil {
+			return 0, err
+		}
+
+		offset, ok := offsets[string(rec.buf)]
+		if !ok {
+			offset = len(data.buf)
+			offsets[string(rec.buf)] = offset
+			data.buf = append(data.buf, rec.buf...)
+		}
+
+		ip, prefixLen := treeKey(e.network, ipVersion)
+		root.insert(ip, prefixLen, &node{leaf: true, offset: offset})
+	}
+
+	nodes := root.number()
+	nodeCount := len(nodes)
+
+	recordSize := recordSizeFor(nodeCount + dataSectionSeparatorSize + len(data.buf))
+	nodeSize := recordSize / 4
+
+	buf := make([]byte, 0, nodeCount*nodeSize+dataSectionSeparatorSize+len(data.buf))
+
+	for _, n := range nodes {
+		var records [2]uint
+
+		for i, child := range n.children {
+			switch {
+			case child == nil:
+				records[i] = uint(nodeCount)
+			case child.leaf:
+				records[i] = uint(nodeCount + dataSectionSeparatorSize + child.offset)
+			default:
+				records[i] = uint(child.index)
+			}
+		}
+
+		buf = appendNode(buf, recordSize, records[0], records[1])
+	}
+
+	buf = append(buf, make([]byte, dataSectionSeparatorSize)...)
+	buf = append(buf, data.buf...)
+	buf = append(buf, metadataStartMarker...)
+
+	buildTime := w.params.BuildTime
+	if buildTime.IsZero() {
+		buildTime = time.Now()
+	}
+
+	meta := encoder{buf: buf}
+
+	err := meta.encode(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(buildTime.Unix()),
+		"database_type":               w.params.DatabaseType,
+		"description":                 map[string]string{"en": w.params.Description},
+		"ip_version":                  uint16(ipVersion),
+		"languages":                   []string{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"source":                      w.params.Source,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := out.Write(meta.buf)
+	if err != nil {
+		return int64(n), fmt.Errorf("cannot write database: %w", err)
+	}
+
+	return int64(n), nil
+}
+
+// normalizeNetwork returns the network with the IPv4 address and the IPv4 mask if it's IPv4-mapped IPv6 network,
+// e.g. 1.2.3.0/24 for ::ffff:1.2.3.0/120, so it's placed and ordered like other IPv4 networks.
+func normalizeNetwork(network *net.IPNet) (*net.IPNet, error) {
+	ones, bits := network.Mask.Size()
+	if bits == 0 {
+		return nil, &simplegeoip.ArgError{Name: "network", Message: "has a non-canonical mask"}
+	}
+
+	ip4 := network.IP.To4()
+
+	switch {
+	case ip4 != nil && bits == 8*net.IPv6len && ones >= 96:
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(ones-96, 8*net.IPv4len)}, nil
+	case ip4 != nil && bits == 8*net.IPv4len:
+		return &net.IPNet{IP: ip4, Mask: network.Mask}, nil
+	case ip4 == nil && len(network.IP) == net.IPv6len && bits == 8*net.IPv6len:
+		return network, nil
+	default:
+		return nil, &simplegeoip.ArgError{Name: "network", Message: "has the mask not matching the address"}
+	}
+}
+
+// treeKey returns the address bytes and the prefix length of the network inside the search tree.
+// IPv4 networks are placed into the ::/96 subtree of IPv6 databases.
+func treeKey(network *net.IPNet, ipVersion int) ([]byte, int) {
+	ones, _ := network.Mask.Size()
+
+	ip4 := network.IP.To4()
+	if ip4 == nil {
+		return network.IP.To16(), ones
+	}
+
+	if ipVersion == 4 {
+		return ip4, ones
+	}
+
+	ip := make([]byte, net.IPv6len)
+	copy(ip[12:], ip4)
+
+	return ip, ones + 96
+}
+
+// recordSizeFor returns the smallest record size in bits able to hold the value.
+func recordSizeFor(maxValue int) int {
+	switch {
+	case maxValue < 1<<24:
+		return 24
+	case maxValue < 1<<28:
+		return 28
+	default:
+		return 32
+	}
+}
+
+// appendNode appends the search tree node with the left and right records.
+func appendNode(buf []byte, recordSize int, left, right uint) []byte {
+	switch recordSize {
+	case 24:
+		return append(buf,
+			byte(left>>16), byte(left>>8), byte(left),
+			byte(right>>16), byte(right>>8), byte(right))
+	case 28:
+		return append(buf,
+			byte(left>>16), byte(left>>8), byte(left),
+			byte((left>>20)&0xf0|(right>>24)&0x0f),
+			byte(right>>16), byte(right>>8), byte(right))
+	default:
+		return append(buf,
+			byte(left>>24), byte(left>>16), byte(left>>8), byte(left),
+			byte(right>>24), byte(right>>16), byte(right>>8), byte(right))
+	}
+}
+
+// node is a node of the search tree being built.
+type node struct {
+	children [2]*node
+
+	// leaf is true if the node points to a record in the data section at the offset
+	leaf   bool
+	offset int
+
+	// index is the node number assigned before writing
+	index int
+}
+
+// insert sets the leaf as the value for the prefix, splitting existing leaves on its way.
+func (n *node) insert(ip []byte, prefixLen int, leaf *node) {
+	if prefixLen == 0 {
+		n.children = [2]*node{leaf, leaf}
+
+		return
+	}
+
+	cur := n
+
+	for i := 0; i < prefixLen-1; i++ {
+		b := bit(ip, i)
+
+		next := cur.children[b]
+
+		switch {
+		case next == nil:
+			next = &node{}
+			cur.children[b] = next
+		case next.leaf:
+			next = &node{children: [2]*node{next, next}}
+			cur.children[b] = next
+		}
+
+		cur = next
+	}
+
+	cur.children[bit(ip, prefixLen-1)] = leaf
+}
+
+// number assigns indexes to the non-leaf nodes in breadth-first order and returns them.
+func (n *node) number() []*node {
+	nodes := []*node{n}
+
+	for i := 0; i < len(nodes); i++ {
+		nodes[i].index = i
+
+		for _, child := range nodes[i].children {
+			if child != nil && !child.leaf {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+
+	return nodes
+}
+
+// bit returns the i-th most significant bit of the address.
+func bit(ip []byte, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// newRecord converts the response to the data section record.
+func newRecord(resp *simplegeoip.GeoIPResponse, withDomains bool) map[string]interface{} {
+	record := map[string]interface{}{
+		"location": map[string]interface{}{
+			"country":    resp.Location.Country,
+			"region":     resp.Location.Region,
+			"city":       resp.Location.City,
+			"lat":        resp.Location.Lat,
+			"lng":        resp.Location.Lng,
+			"postalCode": resp.Location.PostalCode,
+			"timezone":   resp.Location.Timezone,
+			"geonameId":  uint64(resp.Location.GeonameID),
+		},
+		"isp":            resp.ISP,
+		"connectionType": resp.ConnectionType,
+		"as": map[string]interface{}{
+			"asn":    uint32(resp.AS.ASN),
+			"name":   resp.AS.Name,
+			"route":  resp.AS.Route,
+			"domain": resp.AS.Domain,
+			"type":   resp.AS.Type,
+		},
+	}
+
+	if withDomains && resp.Domains != nil {
+		record["domains"] = resp.Domains
+	}
+
+	return record
+}
@@ -0,0 +1,324 @@
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+)
+
+// testResponses returns the sample IP Geolocation API responses.
+func testResponses() []*simplegeoip.GeoIPResponse {
+	return []*simplegeoip.GeoIPResponse{
+		{
+			IP: "8.8.8.8",
+			Location: simplegeoip.Location{
+				Country:    "US",
+				Region:     "California",
+				City:       "Mountain View",
+				Lat:        37.38605,
+				Lng:        -122.08385,
+				PostalCode: "94035",
+				Timezone:   "-07:00",
+				GeonameID:  5375480,
+			},
+			Domains: []string{"dns.google"},
+			AS: simplegeoip.AS{
+				ASN:    15169,
+				Name:   "GOOGLE",
+				Route:  "8.8.8.0/24",
+				Domain: "https://about.google/intl/en/",
+				Type:   "Content",
+			},
+			ISP: "Google LLC",
+		},
+		{
+			IP: "1.1.1.1",
+			Location: simplegeoip.Location{
+				Country: "AU",
+				Region:  "Queensland",
+				City:    "South Brisbane",
+				Lat:     -27.47636,
+				Lng:     153.01562,
+			},
+			Domains: []string{"one.one.one.one", strings.Repeat("long-domain-name.", 20) + "com"},
+			AS: simplegeoip.AS{
+				ASN:   13335,
+				Name:  "CLOUDFLARENET",
+				Route: "1.1.1.0/24",
+				Type:  "Content",
+			},
+			ISP:            "Cloudflare, Inc.",
+			ConnectionType: "broadband",
+		},
+		{
+			IP: "2001:4860:4860::8888",
+			Location: simplegeoip.Location{
+				Country: "US",
+				City:    "Mountain View",
+			},
+			AS: simplegeoip.AS{
+				ASN:   15169,
+				Route: "2001:4860::/32",
+			},
+		},
+	}
+}
+
+// TestRoundTrip tests writing the database and reading it back.
+func TestRoundTrip(t *testing.T) {
+	responses := testResponses()
+	buildTime := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	w := NewWriter(WriterParams{
+		Description: "test database",
+		Source:      "unit test",
+		BuildTime:   buildTime,
+	})
+
+	checkErr(t, w.InsertRoute(responses[0]), "")
+	checkErr(t, w.InsertIP(responses[1]), "")
+	checkErr(t, w.InsertRoute(responses[2]), "")
+
+	var buf bytes.Buffer
+
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	wantMeta := Metadata{
+		NodeCount:    r.Metadata.NodeCount,
+		RecordSize:   24,
+		IPVersion:    6,
+		DatabaseType: defaultDatabaseType,
+		Description:  map[string]string{"en": "test database"},
+		Languages:    []string{"en"},
+		BuildTime:    buildTime,
+		Source:       "unit test",
+	}
+	if !reflect.DeepEqual(r.Metadata, wantMeta) {
+		t.Errorf("Metadata = %+v, want %+v", r.Metadata, wantMeta)
+	}
+
+	routeResp := *responses[0]
+	routeResp.IP = "8.8.4.4"
+	routeResp.AS.Route = "8.8.8.0/24"
+	routeResp.Domains = nil
+
+	tests := []struct {
+		name    string
+		ip      string
+		want    *simplegeoip.GeoIPResponse
+		wantErr error
+	}{
+		{
+			name: "route record",
+			ip:   "8.8.8.8",
+			want: func() *simplegeoip.GeoIPResponse {
+				resp := routeResp
+				resp.IP = "8.8.8.8"
+
+				return &resp
+			}(),
+		},
+		{
+			name:    "outside of route",
+			ip:      "8.8.4.4",
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "single IP record",
+			ip:   "1.1.1.1",
+			want: responses[1],
+		},
+		{
+			name:    "neighbour of single IP",
+			ip:      "1.1.1.2",
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "IPv6 route record",
+			ip:   "2001:4860::1",
+			want: &simplegeoip.GeoIPResponse{
+				IP:       "2001:4860::1",
+				Location: responses[2].Location,
+				AS:       responses[2].AS,
+			},
+		},
+		{
+			name:    "unknown IPv6",
+			ip:      "2606:4700::1111",
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Lookup(net.ParseIP(tt.ip))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIPv4Database tests that IPv4-only input produces IPv4 database.
+func TestIPv4Database(t *testing.T) {
+	responses := testResponses()
+
+	w := NewWriter(WriterParams{})
+	checkErr(t, w.InsertRoute(responses[0]), "")
+	checkErr(t, w.InsertIP(responses[0]), "")
+
+	var buf bytes.Buffer
+
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	r, err := NewReader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	if r.Metadata.IPVersion != 4 {
+		t.Errorf("IPVersion = %d, want 4", r.Metadata.IPVersion)
+	}
+
+	if r.Metadata.Source != defaultSource {
+		t.Errorf("Source = %q, want %q", r.Metadata.Source, defaultSource)
+	}
+
+	got, err := r.Lookup(net.ParseIP("8.8.8.8"))
+	checkErr(t, err, "")
+
+	if got == nil || !reflect.DeepEqual(got.Domains, responses[0].Domains) {
+		t.Errorf("Lookup() got = %+v, want the single IP record", got)
+	}
+
+	got, err = r.Lookup(net.ParseIP("8.8.8.1"))
+	checkErr(t, err, "")
+
+	if got == nil || got.Domains != nil {
+		t.Errorf("Lookup() got = %+v, want the route record", got)
+	}
+
+	_, err = r.Lookup(net.ParseIP("::1"))
+	checkErr(t, err, `invalid argument: "ip" is IPv6 while the database is IPv4-only`)
+}
+
+// TestIPv4MappedNetworks tests that IPv4-mapped IPv6 networks are stored as IPv4 networks.
+func TestIPv4MappedNetworks(t *testing.T) {
+	responses := testResponses()
+	responses[0].AS.Route = "::ffff:8.8.8.0/120"
+
+	_, mapped, err := net.ParseCIDR("::ffff:1.1.1.0/120")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := NewWriter(WriterParams{})
+	checkErr(t, w.InsertRoute(responses[0]), "")
+	checkErr(t, w.Insert(mapped, responses[1]), "")
+
+	// the less specific IPv4 network must not override the mapped one
+	checkErr(t, w.Insert(&net.IPNet{IP: net.IPv4(1, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}, responses[0]), "")
+
+	var buf bytes.Buffer
+
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	r, err := NewReader(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	if r.Metadata.IPVersion != 4 {
+		t.Errorf("IPVersion = %d, want 4", r.Metadata.IPVersion)
+	}
+
+	for ip, want := range map[string]string{"8.8.8.1": "US", "1.1.1.1": "AU", "1.2.3.4": "US"} {
+		got, err := r.Lookup(net.ParseIP(ip))
+		checkErr(t, err, "")
+
+		if got == nil || got.Location.Country != want {
+			t.Errorf("Lookup(%s) got = %+v, want %s", ip, got, want)
+		}
+	}
+}
+
+// TestInsertErrors tests the Writer argument validation.
+func TestInsertErrors(t *testing.T) {
+	w := NewWriter(WriterParams{})
+
+	checkErr(t, w.InsertIP(&simplegeoip.GeoIPResponse{IP: "localhost"}),
+		`invalid argument: "resp.IP" is not a valid IP address`)
+	checkErr(t, w.InsertRoute(&simplegeoip.GeoIPResponse{}),
+		`invalid argument: "resp.AS.Route" is not a valid CIDR`)
+	checkErr(t, w.Insert(nil, &simplegeoip.GeoIPResponse{}),
+		`invalid argument: "network" is nil`)
+	checkErr(t, w.Insert(&net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(24, 32)}, &simplegeoip.GeoIPResponse{}),
+		`invalid argument: "network" has the mask not matching the address`)
+	checkErr(t, w.Insert(&net.IPNet{IP: net.ParseIP("1.2.3.0").To4(), Mask: net.IPMask{255, 0, 255, 0}}, &simplegeoip.GeoIPResponse{}),
+		`invalid argument: "network" has a non-canonical mask`)
+}
+
+// TestRecordSizes tests the search tree node encoding for all record sizes.
+func TestRecordSizes(t *testing.T) {
+	tests := []struct {
+		recordSize  int
+		left, right uint
+	}{
+		{recordSize: 24, left: 0xabcdef, right: 0x123456},
+		{recordSize: 28, left: 0xabcdef1, right: 0x1234567},
+		{recordSize: 32, left: 0xabcdef12, right: 0x12345678},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.recordSize), func(t *testing.T) {
+			r := Reader{
+				Metadata: Metadata{RecordSize: uint(tt.recordSize)},
+				tree:     appendNode(nil, tt.recordSize, tt.left, tt.right),
+			}
+
+			if got := r.record(0, 0); got != tt.left {
+				t.Errorf("left = %x, want %x", got, tt.left)
+			}
+
+			if got := r.record(0, 1); got != tt.right {
+				t.Errorf("right = %x, want %x", got, tt.right)
+			}
+		})
+	}
+}
+
+// checkErr checks for an error.
+func checkErr(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if (err != nil || want != "") && (err == nil || err.Error() != want) {
+		t.Errorf("error = %v, wantErr %v", err, want)
+	}
+}
@@ -2,8 +2,12 @@ package simplegeoip
 
 import (
 	"fmt"
+	"math"
 )
 
+// earthRadius is the mean Earth radius in kilometers.
+const earthRadius = 6371.0
+
 // Location is the part of IP Geolocation API response that contains location details.
 type Location struct {
 	// Country is the two letters country code from ISO 3166.
@@ -31,6 +35,18 @@ type Location struct {
 	GeonameID uint `json:"geonameId"`
 }
 
+// Distance returns the great-circle distance to the other location in kilometers.
+func (l Location) Distance(other Location) float64 {
+	lat1 := l.Lat * math.Pi / 180
+	lat2 := other.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (other.Lng - l.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
 // AS is an Autonomous System. It works for IPv4 only. The field is omitted if the record is not found.
 type AS struct {
 	// ASN is the autonomous system number.
@@ -2,6 +2,7 @@ package simplegeoip
 
 import (
 	"encoding/json"
+	"math"
 	"testing"
 )
 
@@ -62,3 +63,38 @@ func checkErr(t *testing.T, err error, want string) {
 		t.Errorf("error = %v, wantErr %v", err, want)
 	}
 }
+
+// TestDistance tests the great-circle distance calculation.
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Location
+		want float64
+	}{
+		{
+			name: "same point",
+			a:    Location{Lat: 37.38605, Lng: -122.08385},
+			b:    Location{Lat: 37.38605, Lng: -122.08385},
+			want: 0,
+		},
+		{
+			name: "London to Paris",
+			a:    Location{Lat: 51.5074, Lng: -0.1278},
+			b:    Location{Lat: 48.8566, Lng: 2.3522},
+			want: 343.5,
+		},
+		{
+			name: "antipodes",
+			a:    Location{Lat: 0, Lng: 0},
+			b:    Location{Lat: 0, Lng: 180},
+			want: math.Pi * earthRadius,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Distance(tt.b); math.Abs(got-tt.want) > 1 {
+				t.Errorf("Distance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
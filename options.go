@@ -1,6 +1,7 @@
 package simplegeoip
 
 import (
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
@@ -54,3 +55,51 @@ func OptionReverseIP(value int) Option {
 		v.Set("reverseIp", strconv.Itoa(value))
 	}
 }
+
+// OptionTarget sets the IP address, the domain name or the email address to search location by.
+// The kind of the value is detected automatically. The empty value means the client request's public IP address.
+func OptionTarget(value string) (Option, error) {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case value == "":
+		return func(url.Values) {}, nil
+	case net.ParseIP(value) != nil:
+		return OptionIPAddress(value), nil
+	case strings.Contains(value, "@"):
+		local, domain, _ := strings.Cut(value, "@")
+		if local == "" || !isDomain(domain) {
+			return nil, &ArgError{Name: "target", Message: "is not a valid email: " + strconv.Quote(value)}
+		}
+
+		return OptionEmail(value), nil
+	case isDomain(value):
+		return OptionDomain(value), nil
+	}
+
+	return nil, &ArgError{Name: "target", Message: "is not an IP address, a domain or an email: " + strconv.Quote(value)}
+}
+
+// isDomain reports whether the value looks like a domain name.
+func isDomain(value string) bool {
+	value = strings.TrimSuffix(value, ".")
+
+	labels := strings.Split(value, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, r := range label {
+			if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r > 0x7f) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
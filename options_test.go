@@ -54,3 +54,42 @@ func TestOptions(t *testing.T) {
 		})
 	}
 }
+
+// TestOptionTarget tests the target kind detection.
+func TestOptionTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "", want: ""},
+		{target: " 8.8.8.8\n", want: "ipAddress=8.8.8.8"},
+		{target: "2001:4860:4860::8888", want: "ipAddress=2001%3A4860%3A4860%3A%3A8888"},
+		{target: "dns.google", want: "domain=dns.google"},
+		{target: "xn--e1afmkfd.xn--p1ai.", want: "domain=xn--e1afmkfd.xn--p1ai."},
+		{target: "support@dns.google", want: "email=support%40dns.google"},
+		{target: "localhost", want: "error"},
+		{target: "-bad.com", want: "error"},
+		{target: "user@localhost", want: "error"},
+		{target: "@dns.google", want: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			option, err := OptionTarget(tt.target)
+			if err != nil {
+				if tt.want != "error" {
+					t.Errorf("OptionTarget() error = %v", err)
+				}
+
+				return
+			}
+
+			values := url.Values{}
+			option(values)
+
+			if got := values.Encode(); got != tt.want {
+				t.Errorf("OptionTarget() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
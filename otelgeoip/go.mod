@@ -0,0 +1,21 @@
+module github.com/whois-api-llc/go-simple-geoip/otelgeoip
+
+go 1.21
+
+require (
+	github.com/whois-api-llc/go-simple-geoip v0.0.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+)
+
+// The core library with tracing hooks isn't tagged yet, the replace is dropped in favor of
+// the tagged version on release.
+replace github.com/whois-api-llc/go-simple-geoip => ../
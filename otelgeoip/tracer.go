@@ -0,0 +1,80 @@
+// Package otelgeoip adapts OpenTelemetry tracers to simplegeoip.Tracer.
+package otelgeoip
+
+import (
+	"context"
+	"fmt"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracer creates simplegeoip.Tracer starting client spans with the OpenTelemetry tracer.
+func NewTracer(tracer trace.Tracer) simplegeoip.Tracer {
+	return &otelTracer{tracer: tracer}
+}
+
+// otelTracer is simplegeoip.Tracer backed by trace.Tracer.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// Start starts the client span as a child of the span from the context.
+func (t *otelTracer) Start(
+	ctx context.Context,
+	name string,
+	attrs ...simplegeoip.Attribute,
+) (context.Context, simplegeoip.Span) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(convert(attrs)...))
+
+	return ctx, &otelSpan{span: span}
+}
+
+// otelSpan is simplegeoip.Span backed by trace.Span.
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttributes adds the attributes to the span.
+func (s *otelSpan) SetAttributes(attrs ...simplegeoip.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+// RecordError records the error event and sets the error status of the span.
+func (s *otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span.
+func (s *otelSpan) End() {
+	s.span.End()
+}
+
+// convert converts the attributes to OpenTelemetry ones. Values of unknown types are formatted as strings.
+func convert(attrs []simplegeoip.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+
+	for _, attr := range attrs {
+		switch value := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, value))
+		case int:
+			kvs = append(kvs, attribute.Int(attr.Key, value))
+		case int64:
+			kvs = append(kvs, attribute.Int64(attr.Key, value))
+		case bool:
+			kvs = append(kvs, attribute.Bool(attr.Key, value))
+		case float64:
+			kvs = append(kvs, attribute.Float64(attr.Key, value))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, fmt.Sprint(value)))
+		}
+	}
+
+	return kvs
+}
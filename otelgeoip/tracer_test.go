@@ -0,0 +1,97 @@
+package otelgeoip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	simplegeoip "github.com/whois-api-llc/go-simple-geoip"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestTracer tests spans started by the client with the adapter.
+func TestTracer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ipAddress") == "0.0.0.0" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"code":403,"error":"access restricted"}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := provider.Tracer("test")
+
+	client := simplegeoip.NewClient("key", simplegeoip.ClientParams{
+		HTTPClient:   server.Client(),
+		GeoipBaseURL: apiURL,
+		Tracer:       NewTracer(tracer),
+	})
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+
+	if _, _, err := client.Get(ctx, simplegeoip.OptionIPAddress("8.8.8.8")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := client.Get(ctx, simplegeoip.OptionIPAddress("0.0.0.0")); err == nil {
+		t.Fatal("Get() expected error")
+	}
+
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+
+	tests := []struct {
+		status int
+		code   codes.Code
+	}{
+		{status: http.StatusOK, code: codes.Unset},
+		{status: http.StatusForbidden, code: codes.Error},
+	}
+
+	for i, tt := range tests {
+		span := spans[i]
+
+		if span.Name() != "geoip.Get" || span.SpanKind() != trace.SpanKindClient {
+			t.Errorf("span %d = %s (%s), want geoip.Get (client)", i, span.Name(), span.SpanKind())
+		}
+
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %d parent = %s, want %s", i, span.Parent().SpanID(), parent.SpanContext().SpanID())
+		}
+
+		if span.Status().Code != tt.code {
+			t.Errorf("span %d status = %v, want %v", i, span.Status().Code, tt.code)
+		}
+
+		attrs := attribute.NewSet(span.Attributes()...)
+
+		if v, _ := attrs.Value(simplegeoip.TraceKeyStatus); v.AsInt64() != int64(tt.status) {
+			t.Errorf("span %d %s = %v, want %d", i, simplegeoip.TraceKeyStatus, v.Emit(), tt.status)
+		}
+
+		if v, _ := attrs.Value(simplegeoip.TraceKeyQueryType); v.AsString() != simplegeoip.QueryTypeIP {
+			t.Errorf("span %d %s = %v, want %s", i, simplegeoip.TraceKeyQueryType, v.Emit(), simplegeoip.QueryTypeIP)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package simplegeoip
+
+// raceEnabled reports whether the race detector is on. It drops sync.Pool items at random.
+const raceEnabled = true
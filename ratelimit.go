@@ -0,0 +1,147 @@
+package simplegeoip
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiterParams is used to create RateLimiter. RequestsPerSecond is mandatory.
+type RateLimiterParams struct {
+	// RequestsPerSecond is the sustained rate of requests
+	RequestsPerSecond float64
+
+	// Burst is the number of requests allowed at once. Default: 1
+	Burst int
+
+	// MetricsSink receives the time spent waiting in MetricRateLimitWait. If it's nil then nothing is recorded
+	MetricsSink MetricsSink
+}
+
+// RateLimiter is the token bucket limiting the rate of requests. It's safe for concurrent use.
+type RateLimiter struct {
+	params RateLimiterParams
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// now returns the current time, it's replaced in tests
+	now func() time.Time
+}
+
+// NewRateLimiter creates RateLimiter with specified parameters. The bucket is full initially.
+func NewRateLimiter(params RateLimiterParams) (*RateLimiter, error) {
+	if params.RequestsPerSecond <= 0 {
+		return nil, &ArgError{Name: "RequestsPerSecond", Message: "must be positive"}
+	}
+
+	if params.Burst <= 0 {
+		params.Burst = 1
+	}
+
+	return &RateLimiter{
+		params: params,
+		tokens: float64(params.Burst),
+		last:   time.Now(),
+		now:    time.Now,
+	}, nil
+}
+
+// Wait blocks until the request is allowed or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		l.record(0)
+
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		l.record(delay)
+
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+
+		return ctx.Err()
+	}
+}
+
+// Allow reports whether the request is allowed now without waiting.
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+
+	return true
+}
+
+// reserve takes the token and returns the time to wait until it's available.
+// Tokens may go negative, so waiting requests are served in order.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.params.RequestsPerSecond * float64(time.Second))
+}
+
+// cancel returns the reserved token.
+func (l *RateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+}
+
+// refill adds tokens for the time passed since the last refill.
+func (l *RateLimiter) refill() {
+	now := l.now()
+
+	l.tokens += now.Sub(l.last).Seconds() * l.params.RequestsPerSecond
+	if l.tokens > float64(l.params.Burst) {
+		l.tokens = float64(l.params.Burst)
+	}
+
+	l.last = now
+}
+
+// record records the wait time.
+func (l *RateLimiter) record(wait time.Duration) {
+	if l.params.MetricsSink != nil {
+		l.params.MetricsSink.ObserveHistogram(MetricRateLimitWait, wait.Seconds())
+	}
+}
+
+// Interceptor returns the interceptor waiting for the rate limiter before every API call,
+// e.g. to share the rate limit of the API key by several clients. Added to ClientParams.Interceptors it
+// wraps retries and hedging, use ClientParams.RateLimiter to limit every HTTP request.
+func (l *RateLimiter) Interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			if err := l.Wait(ctx); err != nil {
+				return nil, err
+			}
+
+			return next(ctx, call)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestRateLimiter tests the token bucket refill and reservations.
+func TestRateLimiter(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimiterParams{RequestsPerSecond: 10, Burst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.last = now
+	limiter.now = func() time.Time {
+		return now
+	}
+
+	if !limiter.Allow() || !limiter.Allow() {
+		t.Fatal("Allow() = false within the burst")
+	}
+
+	if limiter.Allow() {
+		t.Error("Allow() = true after the burst")
+	}
+
+	now = now.Add(50 * time.Millisecond)
+
+	if delay := limiter.reserve(); delay != 50*time.Millisecond {
+		t.Errorf("reserve() = %v, want %v", delay, 50*time.Millisecond)
+	}
+
+	if delay := limiter.reserve(); delay != 150*time.Millisecond {
+		t.Errorf("reserve() = %v, want %v", delay, 150*time.Millisecond)
+	}
+
+	limiter.cancel()
+	limiter.cancel()
+
+	now = now.Add(time.Second)
+
+	if !limiter.Allow() || !limiter.Allow() || limiter.Allow() {
+		t.Error("the bucket is not capped by the burst")
+	}
+}
+
+// TestRateLimiterWait tests waiting and cancellation.
+func TestRateLimiterWait(t *testing.T) {
+	_, err := NewRateLimiter(RateLimiterParams{})
+	checkErr(t, err, `invalid argument: "RequestsPerSecond" must be positive`)
+
+	limiter, err := NewRateLimiter(RateLimiterParams{RequestsPerSecond: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("3 requests at 100 rps took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestRateLimiterInterceptor tests that API calls share the rate limiter.
+func TestRateLimiterInterceptor(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimiterParams{RequestsPerSecond: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+
+	handler := chain(func(ctx context.Context, call *Call) (*Response, error) {
+		calls++
+
+		return &Response{}, nil
+	}, []Interceptor{limiter.Interceptor()})
+
+	if _, err := handler(context.Background(), &Call{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := handler(ctx, &Call{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+}
@@ -0,0 +1,180 @@
+package simplegeoip
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Region is the named location requests are routed to, e.g. the datacenter.
+type Region struct {
+	// Name is the unique name of the region
+	Name string `json:"name"`
+
+	// Lat is the latitude of the region
+	Lat float64 `json:"lat"`
+
+	// Lng is the longitude of the region
+	Lng float64 `json:"lng"`
+
+	// Weight is the preference of the region, the distance to it is divided by the weight.
+	// E.g. the region with the weight 2 is preferred to the region half as far. Default: 1
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// RankedRegion is the region with the distance to the client.
+type RankedRegion struct {
+	Region
+
+	// Distance is the great-circle distance to the client in kilometers. It's negative if the location is unknown
+	Distance float64
+}
+
+// RegionSelectorParams is used to create RegionSelector. Regions are mandatory.
+type RegionSelectorParams struct {
+	// Regions are the regions to choose from
+	Regions []Region
+
+	// CountryOverrides are names of regions chosen for countries regardless of the distance, e.g. "CN" to "ap-east"
+	CountryOverrides map[string]string
+
+	// Default is the name of the region chosen if the location is unknown. Default: the first region
+	Default string
+}
+
+// RegionSelector ranks regions by the distance to the client. It's safe for concurrent use.
+type RegionSelector struct {
+	regions   []Region
+	overrides map[string]int
+	fallback  int
+}
+
+// NewRegionSelector creates RegionSelector with specified parameters.
+func NewRegionSelector(params RegionSelectorParams) (*RegionSelector, error) {
+	if len(params.Regions) == 0 {
+		return nil, &ArgError{Name: "Regions", Message: "cannot be empty"}
+	}
+
+	s := &RegionSelector{
+		regions:   make([]Region, len(params.Regions)),
+		overrides: make(map[string]int, len(params.CountryOverrides)),
+	}
+
+	index := make(map[string]int, len(params.Regions))
+
+	for i, region := range params.Regions {
+		_, duplicated := index[region.Name]
+
+		switch {
+		case region.Name == "":
+			return nil, &ArgError{Name: "Regions", Message: fmt.Sprintf("region %d has no name", i+1)}
+		case duplicated:
+			return nil, &ArgError{Name: "Regions", Message: fmt.Sprintf("region %q is duplicated", region.Name)}
+		case region.Lat < -90 || region.Lat > 90 || region.Lng < -180 || region.Lng > 180:
+			return nil, &ArgError{Name: "Regions", Message: fmt.Sprintf("region %q has invalid coordinates", region.Name)}
+		case region.Weight < 0:
+			return nil, &ArgError{Name: "Regions", Message: fmt.Sprintf("region %q has negative weight", region.Name)}
+		}
+
+		if region.Weight == 0 {
+			region.Weight = 1
+		}
+
+		s.regions[i] = region
+		index[region.Name] = i
+	}
+
+	for country, name := range params.CountryOverrides {
+		i, ok := index[name]
+		if !ok {
+			return nil, &ArgError{Name: "CountryOverrides", Message: fmt.Sprintf("region %q of %s is unknown", name, country)}
+		}
+
+		s.overrides[strings.ToUpper(country)] = i
+	}
+
+	if params.Default != "" {
+		i, ok := index[params.Default]
+		if !ok {
+			return nil, &ArgError{Name: "Default", Message: fmt.Sprintf("region %q is unknown", params.Default)}
+		}
+
+		s.fallback = i
+	}
+
+	return s, nil
+}
+
+// Nearest returns the region of the client: the country override, the nearest region by weighted distance,
+// or the default region if the location is unknown. The response may be nil.
+func (s *RegionSelector) Nearest(resp *GeoIPResponse) Region {
+	if first, ok := s.first(resp); ok {
+		return s.regions[first]
+	}
+
+	best, bestDistance := 0, 0.0
+
+	for i, region := range s.regions {
+		if d := s.weighted(region, resp.Location); i == 0 || d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+
+	return s.regions[best]
+}
+
+// Rank returns all regions ordered by preference: the country override first, then by weighted distance.
+// If the location is unknown then the default region goes first, and others keep their order.
+func (s *RegionSelector) Rank(resp *GeoIPResponse) []RankedRegion {
+	ranked := make([]RankedRegion, len(s.regions))
+	known := isKnownLocation(resp)
+
+	for i, region := range s.regions {
+		ranked[i] = RankedRegion{Region: region, Distance: -1}
+
+		if known {
+			ranked[i].Distance = resp.Location.Distance(Location{Lat: region.Lat, Lng: region.Lng})
+		}
+	}
+
+	firstName := ""
+	if first, ok := s.first(resp); ok {
+		firstName = s.regions[first].Name
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Name == firstName || ranked[j].Name == firstName {
+			return ranked[i].Name == firstName
+		}
+
+		return known && ranked[i].Distance/ranked[i].Weight < ranked[j].Distance/ranked[j].Weight
+	})
+
+	return ranked
+}
+
+// first returns the region chosen regardless of the distance: the country override or the default region
+// if the location is unknown.
+func (s *RegionSelector) first(resp *GeoIPResponse) (int, bool) {
+	if resp != nil {
+		if i, ok := s.overrides[strings.ToUpper(resp.Location.Country)]; ok {
+			return i, true
+		}
+	}
+
+	if !isKnownLocation(resp) {
+		return s.fallback, true
+	}
+
+	return 0, false
+}
+
+// weighted returns the distance to the region divided by its weight.
+func (s *RegionSelector) weighted(region Region, location Location) float64 {
+	return location.Distance(Location{Lat: region.Lat, Lng: region.Lng}) / region.Weight
+}
+
+// isKnownLocation reports whether the response has coordinates.
+func isKnownLocation(resp *GeoIPResponse) bool {
+	return resp != nil && (resp.Location.Lat != 0 || resp.Location.Lng != 0)
+}
@@ -0,0 +1,171 @@
+package simplegeoip
+
+import "testing"
+
+// testRegions are datacenters in Virginia, Frankfurt, Singapore and Tokyo.
+var testRegions = []Region{
+	{Name: "us-east", Lat: 38.95, Lng: -77.45},
+	{Name: "eu-central", Lat: 50.11, Lng: 8.68},
+	{Name: "ap-southeast", Lat: 1.35, Lng: 103.82},
+	{Name: "ap-northeast", Lat: 35.68, Lng: 139.69},
+}
+
+// newRegionResponse returns the response with the location.
+func newRegionResponse(country string, lat, lng float64) *GeoIPResponse {
+	resp := &GeoIPResponse{}
+	resp.Location.Country = country
+	resp.Location.Lat, resp.Location.Lng = lat, lng
+
+	return resp
+}
+
+// TestRegionSelector tests ranking regions.
+func TestRegionSelector(t *testing.T) {
+	tests := []struct {
+		name   string
+		params RegionSelectorParams
+		resp   *GeoIPResponse
+		want   []string
+	}{
+		{
+			name:   "London",
+			params: RegionSelectorParams{Regions: testRegions},
+			resp:   newRegionResponse("GB", 51.51, -0.13),
+			want:   []string{"eu-central", "us-east", "ap-northeast", "ap-southeast"},
+		},
+		{
+			name:   "Seoul",
+			params: RegionSelectorParams{Regions: testRegions},
+			resp:   newRegionResponse("KR", 37.57, 126.98),
+			want:   []string{"ap-northeast", "ap-southeast", "eu-central", "us-east"},
+		},
+		{
+			name:   "country override",
+			params: RegionSelectorParams{Regions: testRegions, CountryOverrides: map[string]string{"cn": "ap-southeast"}},
+			resp:   newRegionResponse("CN", 39.90, 116.41),
+			want:   []string{"ap-southeast", "ap-northeast", "eu-central", "us-east"},
+		},
+		{
+			name: "weighted",
+			params: RegionSelectorParams{Regions: []Region{
+				{Name: "us-east", Lat: 38.95, Lng: -77.45, Weight: 3},
+				{Name: "eu-central", Lat: 50.11, Lng: 8.68},
+			}},
+			resp: newRegionResponse("IS", 64.15, -21.94),
+			want: []string{"us-east", "eu-central"},
+		},
+		{
+			name:   "unknown location",
+			params: RegionSelectorParams{Regions: testRegions, Default: "ap-southeast"},
+			resp:   newRegionResponse("", 0, 0),
+			want:   []string{"ap-southeast", "us-east", "eu-central", "ap-northeast"},
+		},
+		{
+			name:   "nil response",
+			params: RegionSelectorParams{Regions: testRegions},
+			want:   []string{"us-east", "eu-central", "ap-southeast", "ap-northeast"},
+		},
+		{
+			name:   "override without coordinates",
+			params: RegionSelectorParams{Regions: testRegions, CountryOverrides: map[string]string{"JP": "ap-northeast"}},
+			resp:   newRegionResponse("JP", 0, 0),
+			want:   []string{"ap-northeast", "us-east", "eu-central", "ap-southeast"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := NewRegionSelector(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ranked := selector.Rank(tt.resp)
+
+			var got []string
+			for _, region := range ranked {
+				got = append(got, region.Name)
+
+				if known := isKnownLocation(tt.resp); known != (region.Distance >= 0) {
+					t.Errorf("distance to %s = %v with the known location %v", region.Name, region.Distance, known)
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Rank() = %v, want %v", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Rank() = %v, want %v", got, tt.want)
+				}
+			}
+
+			if nearest := selector.Nearest(tt.resp); nearest.Name != tt.want[0] {
+				t.Errorf("Nearest() = %s, want %s", nearest.Name, tt.want[0])
+			}
+		})
+	}
+}
+
+// TestNewRegionSelector tests parameter errors.
+func TestNewRegionSelector(t *testing.T) {
+	tests := []struct {
+		name   string
+		params RegionSelectorParams
+		want   string
+	}{
+		{name: "no regions", params: RegionSelectorParams{}, want: `invalid argument: "Regions" cannot be empty`},
+		{
+			name:   "no name",
+			params: RegionSelectorParams{Regions: []Region{{Name: "a"}, {}}},
+			want:   `invalid argument: "Regions" region 2 has no name`,
+		},
+		{
+			name:   "duplicated",
+			params: RegionSelectorParams{Regions: []Region{{Name: "a"}, {Name: "a"}}},
+			want:   `invalid argument: "Regions" region "a" is duplicated`,
+		},
+		{
+			name:   "invalid coordinates",
+			params: RegionSelectorParams{Regions: []Region{{Name: "a", Lat: 91}}},
+			want:   `invalid argument: "Regions" region "a" has invalid coordinates`,
+		},
+		{
+			name:   "negative weight",
+			params: RegionSelectorParams{Regions: []Region{{Name: "a", Weight: -1}}},
+			want:   `invalid argument: "Regions" region "a" has negative weight`,
+		},
+		{
+			name:   "unknown override",
+			params: RegionSelectorParams{Regions: testRegions, CountryOverrides: map[string]string{"CN": "cn-north"}},
+			want:   `invalid argument: "CountryOverrides" region "cn-north" of CN is unknown`,
+		},
+		{
+			name:   "unknown default",
+			params: RegionSelectorParams{Regions: testRegions, Default: "cn-north"},
+			want:   `invalid argument: "Default" region "cn-north" is unknown`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegionSelector(tt.params)
+			checkErr(t, err, tt.want)
+		})
+	}
+}
+
+// TestRegionSelectorNearestAllocs tests that choosing the region per request doesn't allocate.
+func TestRegionSelectorNearestAllocs(t *testing.T) {
+	selector, err := NewRegionSelector(RegionSelectorParams{Regions: testRegions})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := newRegionResponse("GB", 51.51, -0.13)
+
+	if allocs := testing.AllocsPerRun(100, func() { selector.Nearest(resp) }); allocs > 0 {
+		t.Errorf("Nearest() makes %.0f allocations, want 0", allocs)
+	}
+}
@@ -0,0 +1,148 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultRetryMaxAttempts is the default number of attempts including the first one.
+	defaultRetryMaxAttempts = 3
+
+	// defaultRetryInitialBackoff is the default delay before the first retry.
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+
+	// defaultRetryMaxBackoff is the default maximum delay between retries.
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+// RetryParams is used to enable retries with ClientParams.Retry. None of parameters are mandatory.
+type RetryParams struct {
+	// MaxAttempts is the maximum number of attempts including the first one. Default: 3
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, it's doubled for every next one. Default: 100 milliseconds
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum delay between retries. Default: 2 seconds
+	MaxBackoff time.Duration
+
+	// IsRetryable reports whether the failed attempt is retried. Default: IsRetryable
+	IsRetryable func(resp *Response, err error) bool
+}
+
+// IsRetryable reports whether the request failed with 429, 5xx or a network error.
+// Canceled requests, exceeded deadlines and requests rejected by the open circuit are not retried.
+func IsRetryable(resp *Response, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrBodyTooLarge) {
+		return false
+	}
+
+	return IsCircuitFailure(resp, err)
+}
+
+// retrier sends the request again with exponential backoff if it fails.
+type retrier struct {
+	params RetryParams
+	sink   MetricsSink
+
+	// logger logs every retry, it may be nil
+	logger *slog.Logger
+}
+
+// newRetrier creates retrier with specified parameters.
+func newRetrier(params RetryParams, sink MetricsSink, logger *slog.Logger) *retrier {
+	if params.MaxAttempts <= 0 {
+		params.MaxAttempts = defaultRetryMaxAttempts
+	}
+
+	if params.InitialBackoff <= 0 {
+		params.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if params.MaxBackoff <= 0 {
+		params.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	if params.IsRetryable == nil {
+		params.IsRetryable = IsRetryable
+	}
+
+	return &retrier{params: params, sink: sink, logger: logger}
+}
+
+// interceptor returns the interceptor retrying failed GET requests.
+func (r *retrier) interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Response, error) {
+			// only idempotent requests may be sent again
+			if call.Request.Method != http.MethodGet {
+				return next(ctx, call)
+			}
+
+			for attempt := 1; ; attempt++ {
+				attemptCall := *call
+				attemptCall.Request = call.Request.Clone(ctx)
+
+				resp, err := next(ctx, &attemptCall)
+				if attempt >= r.params.MaxAttempts || !r.params.IsRetryable(resp, err) {
+					return resp, err
+				}
+
+				backoff := r.backoff(attempt)
+				r.log(ctx, call, attempt, backoff, resp, err)
+
+				timer := time.NewTimer(backoff)
+
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+
+					return resp, err
+				}
+
+				r.sink.AddCounter(MetricRetries, 1)
+			}
+		}
+	}
+}
+
+// log logs the failed attempt to be retried after the backoff.
+func (r *retrier) log(ctx context.Context, call *Call, attempt int, backoff time.Duration, resp *Response, err error) {
+	if r.logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String(LogKeyMethod, call.Request.Method),
+		slog.String(LogKeyURL, RedactURL(call.Request.URL)),
+		slog.Int(LogKeyAttempt, attempt),
+		slog.Duration(LogKeyBackoff, backoff),
+	}
+
+	if resp != nil && resp.Response != nil {
+		attrs = append(attrs, slog.Int(LogKeyStatus, resp.StatusCode))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String(LogKeyError, err.Error()))
+	}
+
+	r.logger.LogAttrs(ctx, slog.LevelWarn, "geoip request retried", attrs...)
+}
+
+// backoff returns the delay before the retry after the attempt. It's jittered between half and full value.
+func (r *retrier) backoff(attempt int) time.Duration {
+	backoff := r.params.InitialBackoff << (attempt - 1)
+	if backoff <= 0 || backoff > r.params.MaxBackoff {
+		backoff = r.params.MaxBackoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
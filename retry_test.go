@@ -0,0 +1,182 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRetry tests retries of failed requests, the retries metric and the log records of retries.
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		wantRequests int32
+		wantErr      string
+	}{
+		{
+			name:         "success after 503",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantRequests: 2,
+		},
+		{
+			name:         "success after 429",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			maxAttempts:  2,
+			wantRequests: 2,
+			wantErr:      "API failed with status code: 502",
+		},
+		{
+			name:         "not retryable",
+			statuses:     []int{http.StatusForbidden, http.StatusOK},
+			wantRequests: 1,
+			wantErr:      "API failed with status code: 403",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				status := tt.statuses[requests.Add(1)-1]
+				if status != http.StatusOK {
+					w.WriteHeader(status)
+					_, _ = w.Write([]byte(`{}`))
+
+					return
+				}
+
+				_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+			}))
+			defer server.Close()
+
+			apiURL, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sink := &recordingSink{}
+
+			var logs bytes.Buffer
+
+			client := NewClient(apiKey, ClientParams{
+				HTTPClient:   server.Client(),
+				GeoipBaseURL: apiURL,
+				Logger:       slog.New(slog.NewJSONHandler(&logs, nil)),
+				MetricsSink:  sink,
+				Retry:        &RetryParams{MaxAttempts: tt.maxAttempts, InitialBackoff: time.Millisecond},
+			})
+
+			_, err = client.GetRaw(context.Background())
+			checkErr(t, err, tt.wantErr)
+
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+
+			retries := 0
+
+			for _, name := range sink.counters {
+				if name == MetricRetries {
+					retries++
+				}
+			}
+
+			if retries != int(tt.wantRequests-1) {
+				t.Errorf("%s = %d, want %d", MetricRetries, retries, tt.wantRequests-1)
+			}
+
+			var attempts []int
+
+			decoder := json.NewDecoder(&logs)
+			for decoder.More() {
+				var record map[string]interface{}
+				if err := decoder.Decode(&record); err != nil {
+					t.Fatal(err)
+				}
+
+				if record["msg"] != "geoip request retried" {
+					continue
+				}
+
+				attempt, _ := record[LogKeyAttempt].(float64)
+				attempts = append(attempts, int(attempt))
+
+				if record["level"] != "WARN" || record[LogKeyBackoff] == nil ||
+					record[LogKeyStatus] != float64(tt.statuses[int(attempt)-1]) {
+					t.Errorf("retry record = %v, want WARN with the backoff and status %d", record, tt.statuses[int(attempt)-1])
+				}
+			}
+
+			if len(attempts) != retries {
+				t.Fatalf("got %d retry records, want %d", len(attempts), retries)
+			}
+
+			for i, attempt := range attempts {
+				if attempt != i+1 {
+					t.Errorf("retry record %d has attempt %d", i, attempt)
+				}
+			}
+		})
+	}
+}
+
+// TestRetryBackoff tests the exponential backoff with jitter.
+func TestRetryBackoff(t *testing.T) {
+	r := newRetrier(RetryParams{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}, nil, nil)
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 10; i++ {
+			if got := r.backoff(attempt); got < want/2 || got > want {
+				t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+// TestIsRetryable tests the classification of failed requests.
+func TestIsRetryable(t *testing.T) {
+	status := func(code int) *Response {
+		return &Response{Response: &http.Response{StatusCode: code}}
+	}
+
+	tests := []struct {
+		name string
+		resp *Response
+		err  error
+		want bool
+	}{
+		{name: "success", resp: status(http.StatusOK), want: false},
+		{name: "not found", resp: status(http.StatusNotFound), want: false},
+		{name: "too many requests", resp: status(http.StatusTooManyRequests), want: true},
+		{name: "server error", resp: status(http.StatusInternalServerError), want: true},
+		{name: "network error", err: &url.Error{Op: "Get", Err: context.DeadlineExceeded}, want: false},
+		{name: "connection refused", err: &url.Error{Op: "Get", Err: errors.New("connection refused")}, want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "circuit open", err: ErrCircuitOpen, want: false},
+		{name: "body too large", resp: status(http.StatusOK), err: ErrBodyTooLarge, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.resp, tt.err); got != tt.want {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
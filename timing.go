@@ -0,0 +1,175 @@
+package simplegeoip
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases reported in the "phase" label of MetricRequestPhase.
+const (
+	PhaseDNS          = "dns"
+	PhaseConnect      = "connect"
+	PhaseTLSHandshake = "tls_handshake"
+	PhaseFirstByte    = "first_byte"
+	PhaseBodyRead     = "body_read"
+)
+
+// Timing is the timing breakdown of the HTTP request. Durations of the phases that have not happened are zero,
+// for example DNS, Connect and TLSHandshake when the connection is reused.
+type Timing struct {
+	// DNS is the duration of the DNS lookup
+	DNS time.Duration
+
+	// Connect is the duration of establishing the TCP connection
+	Connect time.Duration
+
+	// TLSHandshake is the duration of the TLS handshake
+	TLSHandshake time.Duration
+
+	// FirstByte is the time from the start of the request to the first response byte
+	FirstByte time.Duration
+
+	// BodyRead is the time from the first response byte to the end of the body
+	BodyRead time.Duration
+
+	// Total is the duration of the whole request
+	Total time.Duration
+
+	// ConnReused is true if the idle connection has been reused
+	ConnReused bool
+}
+
+// timingPhase is the duration of the request phase.
+type timingPhase struct {
+	name     string
+	duration time.Duration
+}
+
+// phases returns the durations of the phases that have happened.
+func (t *Timing) phases() []timingPhase {
+	all := []timingPhase{
+		{name: PhaseDNS, duration: t.DNS},
+		{name: PhaseConnect, duration: t.Connect},
+		{name: PhaseTLSHandshake, duration: t.TLSHandshake},
+		{name: PhaseFirstByte, duration: t.FirstByte},
+		{name: PhaseBodyRead, duration: t.BodyRead},
+	}
+
+	phases := all[:0]
+
+	for _, phase := range all {
+		if phase.duration > 0 {
+			phases = append(phases, phase)
+		}
+	}
+
+	return phases
+}
+
+// logAttr returns the log group of the timing.
+func (t *Timing) logAttr() slog.Attr {
+	attrs := make([]interface{}, 0, 6)
+	for _, phase := range t.phases() {
+		attrs = append(attrs, slog.Duration(phase.name, phase.duration))
+	}
+
+	attrs = append(attrs, slog.Bool("conn_reused", t.ConnReused))
+
+	return slog.Group(LogKeyTiming, attrs...)
+}
+
+// timingCollector collects Timing with httptrace hooks. The hooks may be called concurrently.
+type timingCollector struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	firstByte    time.Time
+
+	timing Timing
+}
+
+// newTimingCollector starts collecting the timing of the request sent with the returned context.
+func newTimingCollector(ctx context.Context) (context.Context, *timingCollector) {
+	c := &timingCollector{start: time.Now()}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.timing.ConnReused = info.Reused
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.timing.DNS = time.Since(c.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			// dual-stack dialers start several connections, the first start is kept
+			if c.connectStart.IsZero() {
+				c.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			if err == nil {
+				c.timing.Connect = time.Since(c.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.timing.TLSHandshake = time.Since(c.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.firstByte = time.Now()
+			c.timing.FirstByte = c.firstByte.Sub(c.start)
+		},
+	}), c
+}
+
+// finish returns the timing of the request which body has been read.
+func (c *timingCollector) finish() *Timing {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	timing := c.timing
+	timing.Total = now.Sub(c.start)
+
+	if !c.firstByte.IsZero() {
+		timing.BodyRead = now.Sub(c.firstByte)
+	}
+
+	return &timing
+}
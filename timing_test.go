@@ -0,0 +1,101 @@
+package simplegeoip
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestTiming tests the timing breakdown of new and reused TLS connections.
+func TestTiming(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+
+	client := NewClient(apiKey, ClientParams{
+		HTTPClient:    server.Client(),
+		GeoipBaseURL:  apiURL,
+		Logger:        slog.New(slog.NewTextHandler(&logs, nil)),
+		CollectTiming: true,
+	})
+
+	ctx := context.Background()
+
+	_, first, err := client.Get(ctx, OptionIPAddress("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, second, err := client.Get(ctx, OptionIPAddress("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Timing == nil || second.Timing == nil {
+		t.Fatal("Timing is not collected")
+	}
+
+	if first.Timing.ConnReused || first.Timing.Connect <= 0 || first.Timing.TLSHandshake <= 0 {
+		t.Errorf("first request timing = %+v, want new connection", first.Timing)
+	}
+
+	if !second.Timing.ConnReused || second.Timing.Connect != 0 || second.Timing.TLSHandshake != 0 {
+		t.Errorf("second request timing = %+v, want reused connection", second.Timing)
+	}
+
+	for _, timing := range []*Timing{first.Timing, second.Timing} {
+		if timing.FirstByte <= 0 || timing.Total < timing.FirstByte+timing.BodyRead {
+			t.Errorf("timing = %+v, want FirstByte > 0 and Total >= FirstByte + BodyRead", timing)
+		}
+	}
+
+	if !strings.Contains(logs.String(), LogKeyTiming+".tls_handshake=") {
+		t.Errorf("timing is not logged: %s", logs.String())
+	}
+
+	rec := httptest.NewRecorder()
+	client.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, phase := range []string{PhaseConnect, PhaseTLSHandshake, PhaseFirstByte} {
+		if !strings.Contains(rec.Body.String(), MetricRequestPhase+`_count{phase="`+phase+`"}`) {
+			t.Errorf("phase %s is not in metrics:\n%s", phase, rec.Body.String())
+		}
+	}
+}
+
+// TestTimingDisabled tests that Timing is not collected by default.
+func TestTimingDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(apiKey, ClientParams{HTTPClient: server.Client(), GeoipBaseURL: apiURL})
+
+	resp, err := client.GetRaw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Timing != nil {
+		t.Errorf("Timing = %+v, want nil", resp.Timing)
+	}
+}
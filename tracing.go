@@ -0,0 +1,116 @@
+package simplegeoip
+
+import (
+	"context"
+	"net/url"
+)
+
+// Attribute keys of spans started with ClientParams.Tracer and CacheParams.Tracer.
+const (
+	TraceKeyQueryType = "geoip.query.type"
+	TraceKeyTarget    = "geoip.query.target"
+	TraceKeyStatus    = "http.response.status_code"
+	TraceKeyCacheHit  = "geoip.cache.hit"
+	TraceKeyBackend   = "geoip.backend"
+)
+
+// Query types reported in TraceKeyQueryType attribute.
+const (
+	QueryTypeIP     = "ip"
+	QueryTypeDomain = "domain"
+	QueryTypeEmail  = "email"
+	QueryTypeOwnIP  = "own_ip"
+)
+
+// Tracer starts spans around API calls. It keeps the library independent of tracing libraries,
+// adapters such as the otelgeoip module implement it.
+type Tracer interface {
+	// Start starts the span and returns the context carrying it
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by Tracer.
+type Span interface {
+	// SetAttributes adds the attributes to the span
+	SetAttributes(attrs ...Attribute)
+
+	// RecordError marks the span as failed with the error
+	RecordError(err error)
+
+	// End finishes the span
+	End()
+}
+
+// Attribute is a span attribute. Value is a string, int or bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// QueryTarget returns the type and the value of the lookup target of the options.
+// Like the API, email takes precedence over domain and domain over IP address.
+func QueryTarget(opts ...Option) (queryType, target string) {
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+
+	switch {
+	case query.Get("email") != "":
+		return QueryTypeEmail, query.Get("email")
+	case query.Get("domain") != "":
+		return QueryTypeDomain, query.Get("domain")
+	case query.Get("ipAddress") != "":
+		return QueryTypeIP, query.Get("ipAddress")
+	}
+
+	return QueryTypeOwnIP, ""
+}
+
+// startSpan starts the span of the API call with the query attributes. It returns a no-op span if tracer is nil.
+func startSpan(ctx context.Context, tracer Tracer, name string, opts []Option) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	queryType, target := QueryTarget(opts...)
+
+	return tracer.Start(ctx, name,
+		Attribute{Key: TraceKeyQueryType, Value: queryType},
+		Attribute{Key: TraceKeyTarget, Value: target})
+}
+
+// endSpan records the call result and finishes the span.
+func endSpan(span Span, resp *Response, err error) {
+	if _, ok := span.(noopSpan); ok {
+		return
+	}
+
+	if resp != nil {
+		if resp.Response != nil {
+			span.SetAttributes(Attribute{Key: TraceKeyStatus, Value: resp.StatusCode})
+		}
+
+		if resp.Backend != "" {
+			span.SetAttributes(Attribute{Key: TraceKeyBackend, Value: resp.Backend})
+		}
+	}
+
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	span.End()
+}
+
+// noopSpan is the Span doing nothing.
+type noopSpan struct{}
+
+// SetAttributes does nothing.
+func (noopSpan) SetAttributes(...Attribute) {}
+
+// RecordError does nothing.
+func (noopSpan) RecordError(error) {}
+
+// End does nothing.
+func (noopSpan) End() {}
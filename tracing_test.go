@@ -0,0 +1,171 @@
+package simplegeoip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// spanKey is the context key of the current fakeSpan.
+type spanKey struct{}
+
+// fakeTracer records the spans it starts.
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+// fakeSpan records its attributes and errors.
+type fakeSpan struct {
+	name   string
+	attrs  map[string]interface{}
+	err    error
+	parent *fakeSpan
+	ended  bool
+}
+
+// Start starts the span as a child of the span from the context.
+func (t *fakeTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*fakeSpan)
+	span := &fakeSpan{name: name, attrs: map[string]interface{}{}, parent: parent}
+	span.SetAttributes(attrs...)
+	t.spans = append(t.spans, span)
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttributes records the attributes.
+func (s *fakeSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+// RecordError records the error.
+func (s *fakeSpan) RecordError(err error) {
+	s.err = err
+}
+
+// End marks the span as ended.
+func (s *fakeSpan) End() {
+	s.ended = true
+}
+
+// TestTracing tests the spans of client and cache calls.
+func TestTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("domain") != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"code":422,"error":"invalid domain"}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ip":"8.8.8.8"}`))
+	}))
+	defer server.Close()
+
+	apiURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := &fakeTracer{}
+
+	var doSpans []*fakeSpan
+
+	client := NewClient(apiKey, ClientParams{
+		HTTPClient:   server.Client(),
+		GeoipBaseURL: apiURL,
+		Tracer:       tracer,
+		Interceptors: []Interceptor{
+			func(next Handler) Handler {
+				return func(ctx context.Context, call *Call) (*Response, error) {
+					span, _ := ctx.Value(spanKey{}).(*fakeSpan)
+					doSpans = append(doSpans, span)
+
+					return next(ctx, call)
+				}
+			},
+		},
+	})
+	cache := NewCache(client.GeoipService, CacheParams{Tracer: tracer})
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := cache.Get(ctx, OptionIPAddress("8.8.8.8")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := client.GetRaw(ctx, OptionDomain("invalid")); err == nil {
+		t.Fatal("GetRaw() expected error")
+	}
+
+	if len(tracer.spans) != 4 {
+		t.Fatalf("got %d spans, want 4", len(tracer.spans))
+	}
+
+	want := []struct {
+		name   string
+		parent int
+		attrs  map[string]interface{}
+		err    bool
+	}{
+		{
+			name:   "geoip.Cache.Get",
+			parent: -1,
+			attrs: map[string]interface{}{
+				TraceKeyQueryType: QueryTypeIP, TraceKeyTarget: "8.8.8.8", TraceKeyCacheHit: false,
+				TraceKeyStatus: 200,
+			},
+		},
+		{
+			name:   "geoip.Get",
+			parent: 0,
+			attrs: map[string]interface{}{
+				TraceKeyQueryType: QueryTypeIP, TraceKeyTarget: "8.8.8.8", TraceKeyStatus: 200,
+			},
+		},
+		{
+			name:   "geoip.Cache.Get",
+			parent: -1,
+			attrs: map[string]interface{}{
+				TraceKeyQueryType: QueryTypeIP, TraceKeyTarget: "8.8.8.8", TraceKeyCacheHit: true,
+				TraceKeyBackend: CacheBackend,
+			},
+		},
+		{
+			name:   "geoip.GetRaw",
+			parent: -1,
+			attrs: map[string]interface{}{
+				TraceKeyQueryType: QueryTypeDomain, TraceKeyTarget: "invalid", TraceKeyStatus: 422,
+			},
+			err: true,
+		},
+	}
+
+	for i, w := range want {
+		span := tracer.spans[i]
+
+		if span.name != w.name || !span.ended || (span.err != nil) != w.err {
+			t.Errorf("span %d = %+v, want %+v", i, span, w)
+		}
+
+		if !reflect.DeepEqual(span.attrs, w.attrs) {
+			t.Errorf("span %d attributes = %v, want %v", i, span.attrs, w.attrs)
+		}
+
+		if (w.parent == -1 && span.parent != nil) || (w.parent >= 0 && span.parent != tracer.spans[w.parent]) {
+			t.Errorf("span %d has wrong parent", i)
+		}
+	}
+
+	// the context of the span is passed down to the HTTP call
+	if len(doSpans) != 2 || doSpans[0] != tracer.spans[1] || doSpans[1] != tracer.spans[3] {
+		t.Errorf("context is not propagated to Do")
+	}
+}
@@ -0,0 +1,327 @@
+package simplegeoip
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTravelMaxSpeed is the default maximum plausible speed in km/h, a bit faster than airliners.
+	defaultTravelMaxSpeed = 1000
+
+	// defaultTravelAccuracyRadius is the default accuracy of city-level locations in kilometers.
+	defaultTravelAccuracyRadius = 50
+)
+
+// TravelEvent is the event of the user, e.g. the sign-in.
+type TravelEvent struct {
+	// UserID identifies the user
+	UserID string
+
+	// Time is the time of the event
+	Time time.Time
+
+	// IP is the IP address of the user
+	IP string
+}
+
+// Sighting is the location where the user has been seen.
+type Sighting struct {
+	// Time is the time of the event
+	Time time.Time `json:"time"`
+
+	// IP is the IP address of the user
+	IP string `json:"ip"`
+
+	// Location is the location of the IP address
+	Location Location `json:"location"`
+}
+
+// SightingStore keeps the last seen locations of users. Implementations must be safe for concurrent use.
+type SightingStore interface {
+	// LastSeen returns the last seen location of the user, it's nil if the user hasn't been seen
+	LastSeen(ctx context.Context, userID string) (*Sighting, error)
+
+	// SetLastSeen replaces the last seen location of the user
+	SetLastSeen(ctx context.Context, userID string, sighting Sighting) error
+}
+
+// MemorySightingStore is SightingStore keeping locations in memory. It grows with the number of users,
+// so large user bases need a shared store, e.g. in the database.
+type MemorySightingStore struct {
+	mu        sync.Mutex
+	sightings map[string]Sighting
+}
+
+// NewMemorySightingStore creates the empty MemorySightingStore.
+func NewMemorySightingStore() *MemorySightingStore {
+	return &MemorySightingStore{sightings: make(map[string]Sighting)}
+}
+
+// LastSeen returns the last seen location of the user.
+func (s *MemorySightingStore) LastSeen(_ context.Context, userID string) (*Sighting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sighting, ok := s.sightings[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &sighting, nil
+}
+
+// SetLastSeen replaces the last seen location of the user.
+func (s *MemorySightingStore) SetLastSeen(_ context.Context, userID string, sighting Sighting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sightings[userID] = sighting
+
+	return nil
+}
+
+// TravelAlert reports two events of the user too far apart for the time between them.
+type TravelAlert struct {
+	// UserID identifies the user
+	UserID string
+
+	// From is the earlier location of the user
+	From Sighting
+
+	// To is the later location of the user
+	To Sighting
+
+	// Distance is the great-circle distance between the locations in kilometers
+	Distance float64
+
+	// Speed is the implied speed in km/h, the distance is reduced by the accuracy of both locations.
+	// It's infinite if events have the same time
+	Speed float64
+}
+
+// TravelDetectorParams is used to create TravelDetector. Service is mandatory.
+type TravelDetectorParams struct {
+	// Service looks up IP addresses of events
+	Service GeoipService
+
+	// Store keeps the last seen locations of users. Default: MemorySightingStore
+	Store SightingStore
+
+	// MaxSpeed is the maximum plausible speed in km/h. Default: 1000
+	MaxSpeed float64
+
+	// AccuracyRadius is the accuracy of locations in kilometers. Locations are city-level, so the distance
+	// between events is reduced by the radius of both of them. Default: 50
+	AccuracyRadius float64
+
+	// IgnoreASNs are autonomous systems of known VPNs and proxies. Their events are neither checked nor recorded,
+	// so switching the VPN on and off isn't a travel
+	IgnoreASNs []int
+
+	// IgnoreASTypes are autonomous system types ignored like IgnoreASNs, e.g. "Content" for hosting providers
+	IgnoreASTypes []string
+
+	// Concurrency is the number of concurrent lookups of Stream. Default: 4
+	Concurrency int
+
+	// Options are added to the query of every lookup, e.g. OptionReverseIP(0)
+	Options []Option
+}
+
+// TravelDetector detects impossible travel: successive events of the user from locations too far apart
+// for the time between them.
+type TravelDetector struct {
+	params TravelDetectorParams
+}
+
+// TravelResult is the result of checking the event by Stream.
+type TravelResult struct {
+	// Event is the checked event
+	Event TravelEvent
+
+	// Alert is the detected travel, it's nil if the travel is possible or the event is ignored
+	Alert *TravelAlert
+
+	// Err is the error of the lookup or the store
+	Err error
+}
+
+// NewTravelDetector creates TravelDetector with specified parameters.
+func NewTravelDetector(params TravelDetectorParams) (*TravelDetector, error) {
+	if params.Service == nil {
+		return nil, &ArgError{Name: "Service", Message: "cannot be nil"}
+	}
+
+	if params.MaxSpeed < 0 {
+		return nil, &ArgError{Name: "MaxSpeed", Message: "cannot be negative"}
+	}
+
+	if params.AccuracyRadius < 0 {
+		return nil, &ArgError{Name: "AccuracyRadius", Message: "cannot be negative"}
+	}
+
+	if params.Store == nil {
+		params.Store = NewMemorySightingStore()
+	}
+
+	if params.MaxSpeed == 0 {
+		params.MaxSpeed = defaultTravelMaxSpeed
+	}
+
+	if params.AccuracyRadius == 0 {
+		params.AccuracyRadius = defaultTravelAccuracyRadius
+	}
+
+	if params.Concurrency <= 0 {
+		params.Concurrency = defaultBatchConcurrency
+	}
+
+	return &TravelDetector{params: params}, nil
+}
+
+// Check looks up the event, compares its location with the last seen location of the user, and records it.
+// The alert is nil if the travel is possible, the user hasn't been seen, or the event is from an ignored
+// network or an unknown location. Events of the same user must be checked one at a time, and events older
+// than the last seen one are checked but not recorded.
+func (d *TravelDetector) Check(ctx context.Context, event TravelEvent) (*TravelAlert, error) {
+	resp, _, err := d.params.Service.Get(ctx, append([]Option{OptionIPAddress(event.IP)}, d.params.Options...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ignored(resp) {
+		return nil, nil
+	}
+
+	current := Sighting{Time: event.Time, IP: event.IP, Location: resp.Location}
+
+	last, err := d.params.Store.LastSeen(ctx, event.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read last seen location: %w", err)
+	}
+
+	if last == nil || !event.Time.Before(last.Time) {
+		if err := d.params.Store.SetLastSeen(ctx, event.UserID, current); err != nil {
+			return nil, fmt.Errorf("cannot record last seen location: %w", err)
+		}
+	}
+
+	if last == nil {
+		return nil, nil
+	}
+
+	return d.compare(event.UserID, *last, current), nil
+}
+
+// ignored reports whether the lookup result is from the ignored network or the location is unknown.
+func (d *TravelDetector) ignored(resp *GeoIPResponse) bool {
+	if resp.Location.Lat == 0 && resp.Location.Lng == 0 {
+		return true
+	}
+
+	return len(d.params.IgnoreASNs) > 0 && matchInt(d.params.IgnoreASNs, resp.AS.ASN) ||
+		len(d.params.IgnoreASTypes) > 0 && matchString(d.params.IgnoreASTypes, resp.AS.Type)
+}
+
+// compare returns the alert if the travel between sightings is impossible.
+func (d *TravelDetector) compare(userID string, from, to Sighting) *TravelAlert {
+	if to.Time.Before(from.Time) {
+		from, to = to, from
+	}
+
+	distance := from.Location.Distance(to.Location)
+
+	reduced := distance - 2*d.params.AccuracyRadius
+	if reduced <= 0 {
+		return nil
+	}
+
+	speed := math.Inf(1)
+	if elapsed := to.Time.Sub(from.Time); elapsed > 0 {
+		speed = reduced / elapsed.Hours()
+	}
+
+	if speed <= d.params.MaxSpeed {
+		return nil
+	}
+
+	return &TravelAlert{UserID: userID, From: from, To: to, Distance: distance, Speed: speed}
+}
+
+// Stream checks events concurrently. Events of the same user are checked one at a time in the order they
+// are received. Results are sent to the returned channel, it's closed after the events channel is closed and
+// all events are checked, or after ctx is done.
+func (d *TravelDetector) Stream(ctx context.Context, events <-chan TravelEvent) <-chan TravelResult {
+	shards := make([]chan TravelEvent, d.params.Concurrency)
+	for i := range shards {
+		shards[i] = make(chan TravelEvent)
+	}
+
+	results := make(chan TravelResult)
+
+	go func() {
+		defer func() {
+			for _, shard := range shards {
+				close(shard)
+			}
+		}()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+
+				select {
+				case shards[userShard(event.UserID, len(shards))] <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for i := range shards {
+		wg.Add(1)
+
+		go func(shard <-chan TravelEvent) {
+			defer wg.Done()
+
+			for event := range shard {
+				result := TravelResult{Event: event}
+				result.Alert, result.Err = d.Check(ctx, event)
+
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(shards[i])
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// userShard returns the worker checking events of the user.
+func userShard(userID string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+
+	return int(h.Sum32() % uint32(n))
+}
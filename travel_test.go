@@ -0,0 +1,253 @@
+package simplegeoip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// newTravelService returns the service with addresses in New York, Brooklyn, Boston and London,
+// the VPN and the hosting provider in London, and the address without the location.
+func newTravelService() locationService {
+	at := func(lat, lng float64, asn int, asType string) *GeoIPResponse {
+		resp := &GeoIPResponse{}
+		resp.Location.Lat, resp.Location.Lng = lat, lng
+		resp.AS.ASN, resp.AS.Type = asn, asType
+
+		return resp
+	}
+
+	return locationService{
+		"1.0.0.1": at(40.71, -74.01, 7922, "Cable/DSL/ISP"),
+		"1.0.0.2": at(40.68, -73.94, 7922, "Cable/DSL/ISP"),
+		"1.0.0.3": at(42.36, -71.06, 7922, "Cable/DSL/ISP"),
+		"2.0.0.1": at(51.51, -0.13, 5089, "Cable/DSL/ISP"),
+		"2.0.0.2": at(51.51, -0.13, 9009, "NSP"),
+		"2.0.0.3": at(51.51, -0.13, 16509, "Content"),
+		"3.0.0.1": at(0, 0, 0, ""),
+	}
+}
+
+// errStore is the SightingStore failing with the error.
+type errStore struct {
+	err error
+}
+
+// LastSeen returns the error.
+func (s errStore) LastSeen(context.Context, string) (*Sighting, error) {
+	return nil, s.err
+}
+
+// SetLastSeen returns the error.
+func (s errStore) SetLastSeen(context.Context, string, Sighting) error {
+	return s.err
+}
+
+// TestTravelDetector tests detecting impossible travel between two events.
+func TestTravelDetector(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		fromIP    string
+		toIP      string
+		elapsed   time.Duration
+		wantAlert bool
+		recorded  bool
+	}{
+		{name: "transatlantic in an hour", fromIP: "1.0.0.1", toIP: "2.0.0.1", elapsed: time.Hour, wantAlert: true, recorded: true},
+		{name: "transatlantic flight", fromIP: "1.0.0.1", toIP: "2.0.0.1", elapsed: 10 * time.Hour, recorded: true},
+		{name: "same city at once", fromIP: "1.0.0.1", toIP: "1.0.0.2", recorded: true},
+		{name: "Boston in 10 minutes", fromIP: "1.0.0.1", toIP: "1.0.0.3", elapsed: 10 * time.Minute, wantAlert: true, recorded: true},
+		{name: "Boston in an hour", fromIP: "1.0.0.1", toIP: "1.0.0.3", elapsed: time.Hour, recorded: true},
+		{name: "VPN", fromIP: "1.0.0.1", toIP: "2.0.0.2", elapsed: time.Minute},
+		{name: "hosting", fromIP: "1.0.0.1", toIP: "2.0.0.3", elapsed: time.Minute},
+		{name: "unknown location", fromIP: "1.0.0.1", toIP: "3.0.0.1", elapsed: time.Minute},
+		{name: "older event", fromIP: "1.0.0.1", toIP: "2.0.0.1", elapsed: -time.Hour, wantAlert: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemorySightingStore()
+
+			detector, err := NewTravelDetector(TravelDetectorParams{
+				Service:       newTravelService(),
+				Store:         store,
+				IgnoreASNs:    []int{9009},
+				IgnoreASTypes: []string{"Content"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+
+			alert, err := detector.Check(ctx, TravelEvent{UserID: "alice", Time: start, IP: tt.fromIP})
+			if err != nil || alert != nil {
+				t.Fatalf("Check() of the first event = %+v, %v", alert, err)
+			}
+
+			to := start.Add(tt.elapsed)
+
+			alert, err = detector.Check(ctx, TravelEvent{UserID: "alice", Time: to, IP: tt.toIP})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (alert != nil) != tt.wantAlert {
+				t.Fatalf("Check() = %+v, want alert %v", alert, tt.wantAlert)
+			}
+
+			if alert != nil {
+				if alert.UserID != "alice" || !alert.From.Time.Before(alert.To.Time) || alert.Speed <= defaultTravelMaxSpeed {
+					t.Errorf("Check() = %+v", alert)
+				}
+
+				if want := alert.From.Location.Distance(alert.To.Location); alert.Distance != want {
+					t.Errorf("Distance = %v, want %v", alert.Distance, want)
+				}
+			}
+
+			last, err := store.LastSeen(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantLast := start
+			if tt.recorded {
+				wantLast = to
+			}
+
+			if !last.Time.Equal(wantLast) {
+				t.Errorf("last seen at %v, want %v", last.Time, wantLast)
+			}
+		})
+	}
+}
+
+// TestTravelDetectorSameTime tests events at the same time from distant locations.
+func TestTravelDetectorSameTime(t *testing.T) {
+	detector, err := NewTravelDetector(TravelDetectorParams{Service: newTravelService()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	if _, err := detector.Check(context.Background(), TravelEvent{UserID: "bob", Time: now, IP: "1.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	alert, err := detector.Check(context.Background(), TravelEvent{UserID: "bob", Time: now, IP: "1.0.0.3"})
+	if err != nil || alert == nil || !math.IsInf(alert.Speed, 1) {
+		t.Errorf("Check() = %+v, %v, want the infinite speed", alert, err)
+	}
+}
+
+// TestTravelDetectorErrors tests lookup, store and parameter errors.
+func TestTravelDetectorErrors(t *testing.T) {
+	event := TravelEvent{UserID: "alice", Time: time.Now(), IP: "1.0.0.1"}
+
+	detector, err := NewTravelDetector(TravelDetectorParams{Service: newTravelService()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = detector.Check(context.Background(), TravelEvent{UserID: "alice", Time: time.Now(), IP: "9.9.9.9"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Check() error = %v, want %v", err, ErrNotFound)
+	}
+
+	detector, err = NewTravelDetector(TravelDetectorParams{Service: newTravelService(), Store: errStore{errors.New("down")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = detector.Check(context.Background(), event)
+	checkErr(t, err, "cannot read last seen location: down")
+
+	tests := []struct {
+		name   string
+		params TravelDetectorParams
+		want   string
+	}{
+		{name: "no service", params: TravelDetectorParams{}, want: `invalid argument: "Service" cannot be nil`},
+		{
+			name:   "negative speed",
+			params: TravelDetectorParams{Service: newTravelService(), MaxSpeed: -1},
+			want:   `invalid argument: "MaxSpeed" cannot be negative`,
+		},
+		{
+			name:   "negative radius",
+			params: TravelDetectorParams{Service: newTravelService(), AccuracyRadius: -1},
+			want:   `invalid argument: "AccuracyRadius" cannot be negative`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTravelDetector(tt.params)
+			checkErr(t, err, tt.want)
+		})
+	}
+}
+
+// TestTravelDetectorStream tests checking the stream of events of several users.
+func TestTravelDetectorStream(t *testing.T) {
+	detector, err := NewTravelDetector(TravelDetectorParams{Service: newTravelService(), Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	events := make(chan TravelEvent)
+
+	go func() {
+		defer close(events)
+
+		for i := 0; i < 20; i++ {
+			user := fmt.Sprintf("user%d", i)
+
+			// every user flies to London, odd users are too fast
+			elapsed := 10 * time.Hour
+			if i%2 == 1 {
+				elapsed = time.Hour
+			}
+
+			events <- TravelEvent{UserID: user, Time: start, IP: "1.0.0.1"}
+			events <- TravelEvent{UserID: user, Time: start.Add(elapsed), IP: "2.0.0.1"}
+		}
+	}()
+
+	alerts := map[string]bool{}
+	count := 0
+
+	for result := range detector.Stream(context.Background(), events) {
+		count++
+
+		if result.Err != nil {
+			t.Errorf("%+v: %v", result.Event, result.Err)
+		}
+
+		if result.Alert != nil {
+			alerts[result.Alert.UserID] = true
+
+			if result.Event.IP != "2.0.0.1" {
+				t.Errorf("the alert of %+v, want events in order", result.Event)
+			}
+		}
+	}
+
+	if count != 40 {
+		t.Errorf("got %d results, want 40", count)
+	}
+
+	for i := 0; i < 20; i++ {
+		if user := fmt.Sprintf("user%d", i); alerts[user] != (i%2 == 1) {
+			t.Errorf("alert of %s = %v", user, alerts[user])
+		}
+	}
+}